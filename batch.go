@@ -0,0 +1,141 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"sync"
+)
+
+// nonTransactionSeqNo 非批量写入数据的序列号，这些记录的header中不编码序列号，和最初的数据格式一致
+const nonTransactionSeqNo uint64 = 0
+
+// txnFinKey 批量写入完成标识记录的key
+var txnFinKey = []byte("txn-fin")
+
+// WriteBatch 原子批量写入数据，保证一个批次中的数据要么全部生效，要么全部不生效
+type WriteBatch struct {
+	options       WriteBatchOptions
+	mu            *sync.Mutex
+	db            *DB
+	pendingWrites map[string]*data.LogRecord // 暂存用户写入的数据
+}
+
+// NewWriteBatch 初始化WriteBatch
+func (db *DB) NewWriteBatch(opts WriteBatchOptions) *WriteBatch {
+	return &WriteBatch{
+		options:       opts,
+		mu:            &sync.Mutex{},
+		db:            db,
+		pendingWrites: make(map[string]*data.LogRecord),
+	}
+}
+
+// Put 批量写入数据
+func (wb *WriteBatch) Put(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	// 暂存LogRecord，同一个key只保留最后一次写入
+	logRecord := &data.LogRecord{Key: key, Value: value}
+	wb.pendingWrites[string(key)] = logRecord
+	return nil
+}
+
+// Delete 批量删除数据
+func (wb *WriteBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	// 数据不存在则直接返回，如果暂存中有这个key，也需要一起删除
+	logRecordPos := wb.db.index.Get(key)
+	if logRecordPos == nil {
+		if wb.pendingWrites[string(key)] != nil {
+			delete(wb.pendingWrites, string(key))
+		}
+		return nil
+	}
+
+	// 暂存LogRecord
+	logRecord := &data.LogRecord{Key: key, Type: data.LogRecordDeleted}
+	wb.pendingWrites[string(key)] = logRecord
+	return nil
+}
+
+// Commit 提交批量写入，将暂存的数据全部写到磁盘，并更新内存索引
+func (wb *WriteBatch) Commit() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if len(wb.pendingWrites) == 0 {
+		return nil
+	}
+	if uint(len(wb.pendingWrites)) > wb.options.MaxBatchNum {
+		return ErrExceedMaxBatchNum
+	}
+
+	// 加锁保证批量写入的串行化
+	wb.db.lock.Lock()
+	defer wb.db.lock.Unlock()
+	if err := wb.db.writeBatchRecords(wb.pendingWrites, wb.options.SyncWrites); err != nil {
+		return err
+	}
+
+	// 清空暂存数据
+	wb.pendingWrites = make(map[string]*data.LogRecord)
+	return nil
+}
+
+// writeBatchRecords 使用新的序列号写入一批数据以及完成标识，然后更新内存索引，调用方需要持有db.lock
+func (db *DB) writeBatchRecords(records map[string]*data.LogRecord, syncWrites bool) error {
+	// 获取最新的序列号，先递增序列号，即使这次提交失败，写入的半批数据也不会和后续批次混淆
+	db.seqNo++
+	seqNo := db.seqNo
+
+	// 写数据到数据文件中
+	positions := make(map[string]*data.LogRecordPos)
+	for _, record := range records {
+		logRecordPos, err := db.appendLogRecord(&data.LogRecord{
+			Key:    record.Key,
+			Value:  record.Value,
+			Type:   record.Type,
+			Expire: record.Expire,
+			SeqNo:  seqNo,
+		})
+		if err != nil {
+			return err
+		}
+		positions[string(record.Key)] = logRecordPos
+	}
+
+	// 写一条标识批量写入完成的数据
+	finishedRecord := &data.LogRecord{
+		Key:   txnFinKey,
+		Type:  data.LogRecordTxnFinished,
+		SeqNo: seqNo,
+	}
+	finishedPos, err := db.appendLogRecord(finishedRecord)
+	if err != nil {
+		return err
+	}
+	db.addDeadBytes(finishedPos.Fid, int64(finishedPos.Size))
+
+	// 根据配置决定是否持久化
+	if syncWrites && db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+	// 更新内存索引
+	for _, record := range records {
+		pos := positions[string(record.Key)]
+		if err := db.updateIndex(record.Key, record.Type, pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
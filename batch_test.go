@@ -0,0 +1,109 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBatch_Commit(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, db *DB)
+		after  func(t *testing.T, db *DB)
+
+		wantErr error
+	}{
+		{
+			name: "提交之后数据可见",
+			before: func(t *testing.T, db *DB) {
+				wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+				assert.Nil(t, wb.Put([]byte("order"), []byte("1")))
+				assert.Nil(t, wb.Put([]byte("inventory"), []byte("99")))
+				// 提交之前数据不可见
+				_, err := db.Get([]byte("order"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				assert.Nil(t, wb.Commit())
+			},
+			after: func(t *testing.T, db *DB) {
+				value, err := db.Get([]byte("order"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				value, err = db.Get([]byte("inventory"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("99"), value)
+				assert.Equal(t, uint64(1), db.seqNo)
+			},
+		},
+		{
+			name: "批量删除数据",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("order"), []byte("1")))
+				wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+				assert.Nil(t, wb.Delete([]byte("order")))
+				// 删除不存在的key，同时撤销暂存的写入
+				assert.Nil(t, wb.Put([]byte("tmp"), []byte("1")))
+				assert.Nil(t, wb.Delete([]byte("tmp")))
+				assert.Nil(t, wb.Commit())
+			},
+			after: func(t *testing.T, db *DB) {
+				_, err := db.Get([]byte("order"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				_, err = db.Get([]byte("tmp"))
+				assert.Equal(t, ErrKeyNotFound, err)
+			},
+		},
+		{
+			name: "未写入完成标识的批次在重启之后不生效",
+			before: func(t *testing.T, db *DB) {
+				// 模拟写到一半宕机：只写入了数据，没有写入完成标识
+				_, err := db.appendLogRecordWithLock(&data.LogRecord{
+					Key:   []byte("order"),
+					Value: []byte("1"),
+					SeqNo: 5,
+				})
+				assert.Nil(t, err)
+			},
+			after: func(t *testing.T, db *DB) {
+				_, err := db.Get([]byte("order"))
+				assert.Equal(t, ErrKeyNotFound, err)
+			},
+		},
+		{
+			name: "超过批次最大数据量",
+			before: func(t *testing.T, db *DB) {
+				wb := db.NewWriteBatch(WriteBatchOptions{MaxBatchNum: 2})
+				for i := 0; i < 3; i++ {
+					assert.Nil(t, wb.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v")))
+				}
+				assert.Equal(t, ErrExceedMaxBatchNum, wb.Commit())
+			},
+			after: func(t *testing.T, db *DB) {
+				_, err := db.Get([]byte("key_0"))
+				assert.Equal(t, ErrKeyNotFound, err)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-batch")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			tc.before(t, db)
+			tc.after(t, db)
+
+			// 重启之后结果保持一致
+			assert.Nil(t, db.Close())
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			tc.after(t, db)
+			assert.Nil(t, db.Close())
+		})
+	}
+}
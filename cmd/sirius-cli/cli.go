@@ -0,0 +1,343 @@
+package main
+
+import (
+	sirius "Sirius"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	formatUTF8 = "utf8"
+	formatHex  = "hex"
+	formatJSON = "json"
+
+	// defaultScanLimit scan默认返回的数量
+	defaultScanLimit = 100
+)
+
+var (
+	// errExit 用户输入了exit或者quit
+	errExit = errors.New("exit")
+
+	errUnknownFormat = errors.New("unknown format, must be utf8, hex or json")
+	errUnclosedQuote = errors.New("unclosed quote")
+	errNoHistory     = errors.New("no such command in history")
+)
+
+// cliCommand 命令的用法、参数个数限制以及处理函数，maxArgs为-1表示不限制
+type cliCommand struct {
+	usage   string
+	minArgs int
+	maxArgs int
+	handler func(c *CLI, args []string) error
+}
+
+var cliCommands map[string]*cliCommand
+
+func init() {
+	cliCommands = map[string]*cliCommand{
+		"get":     {usage: "get <key>", minArgs: 1, maxArgs: 1, handler: (*CLI).get},
+		"put":     {usage: "put <key> <value> [ttl]", minArgs: 2, maxArgs: 3, handler: (*CLI).put},
+		"delete":  {usage: "delete <key>", minArgs: 1, maxArgs: 1, handler: (*CLI).delete},
+		"scan":    {usage: "scan [prefix] [limit]", minArgs: 0, maxArgs: 2, handler: (*CLI).scan},
+		"count":   {usage: "count [prefix]", minArgs: 0, maxArgs: 1, handler: (*CLI).count},
+		"format":  {usage: "format [utf8|hex|json]", minArgs: 0, maxArgs: 1, handler: (*CLI).setFormat},
+		"history": {usage: "history", minArgs: 0, maxArgs: 0, handler: (*CLI).printHistory},
+		"help":    {usage: "help", minArgs: 0, maxArgs: 0, handler: (*CLI).help},
+		"exit":    {usage: "exit", minArgs: 0, maxArgs: 0, handler: (*CLI).exit},
+		"quit":    {usage: "quit", minArgs: 0, maxArgs: 0, handler: (*CLI).exit},
+	}
+}
+
+// CLI 命令行客户端，解析并执行一行命令，结果按照format输出到out
+type CLI struct {
+	db      *sirius.DB
+	out     io.Writer
+	format  string
+	history []string
+}
+
+// NewCLI 初始化命令行客户端
+func NewCLI(db *sirius.DB, out io.Writer, format string) (*CLI, error) {
+	if !validFormat(format) {
+		return nil, errUnknownFormat
+	}
+	return &CLI{db: db, out: out, format: format}, nil
+}
+
+// Execute 执行一行命令，空行直接忽略
+// !!表示上一条命令，!N表示history中的第N条命令，执行过的命令会加入history
+func (c *CLI) Execute(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "!") {
+		expanded, err := c.expandHistory(line)
+		if err != nil {
+			return err
+		}
+		line = expanded
+		fmt.Fprintln(c.out, line)
+	}
+	c.history = append(c.history, line)
+
+	args, err := splitArgs(line)
+	if err != nil {
+		return err
+	}
+	return c.Run(args)
+}
+
+// Run 执行已经拆分好参数的命令，一次性执行模式直接使用命令行参数
+func (c *CLI) Run(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name := strings.ToLower(args[0])
+	cmd, ok := cliCommands[name]
+	if !ok {
+		return fmt.Errorf("unknown command '%s', type help for usage", args[0])
+	}
+	args = args[1:]
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	return cmd.handler(c, args)
+}
+
+// History 返回执行过的命令
+func (c *CLI) History() []string {
+	return c.history
+}
+
+// LoadHistory 加载之前保存的命令
+func (c *CLI) LoadHistory(history []string) {
+	c.history = append(c.history, history...)
+}
+
+// expandHistory 将!!和!N替换为history中的命令
+func (c *CLI) expandHistory(line string) (string, error) {
+	if line == "!!" {
+		if len(c.history) == 0 {
+			return "", errNoHistory
+		}
+		return c.history[len(c.history)-1], nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n <= 0 || n > len(c.history) {
+		return "", errNoHistory
+	}
+	return c.history[n-1], nil
+}
+
+// get get <key>
+func (c *CLI) get(args []string) error {
+	value, err := c.db.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	c.printValue(value)
+	return nil
+}
+
+// put put <key> <value> [ttl]，ttl使用time.ParseDuration的格式，例如10s、5m
+func (c *CLI) put(args []string) error {
+	key, value := []byte(args[0]), []byte(args[1])
+	var err error
+	if len(args) == 3 {
+		ttl, parseErr := time.ParseDuration(args[2])
+		if parseErr != nil {
+			return sirius.ErrInvalidTTL
+		}
+		err = c.db.PutWithTTL(key, value, ttl)
+	} else {
+		err = c.db.Put(key, value)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "OK")
+	return nil
+}
+
+// delete delete <key>
+func (c *CLI) delete(args []string) error {
+	if err := c.db.Delete([]byte(args[0])); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "OK")
+	return nil
+}
+
+// scan scan [prefix] [limit]，按照key的顺序输出key和value
+func (c *CLI) scan(args []string) error {
+	var prefix []byte
+	if len(args) > 0 {
+		prefix = []byte(args[0])
+	}
+	limit := defaultScanLimit
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid limit '%s'", args[1])
+		}
+		limit = n
+	}
+
+	iter := c.db.NewIterator(sirius.IteratorOptions{Prefix: prefix})
+	defer iter.Close()
+	for n := 0; iter.Valid() && n < limit; iter.Next() {
+		value, err := iter.Value()
+		if err == sirius.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.printPair(iter.Key(), value)
+		n++
+	}
+	return nil
+}
+
+// count count [prefix]
+func (c *CLI) count(args []string) error {
+	var prefix []byte
+	if len(args) > 0 {
+		prefix = []byte(args[0])
+	}
+	iter := c.db.NewIterator(sirius.IteratorOptions{Prefix: prefix})
+	defer iter.Close()
+	var n int
+	for ; iter.Valid(); iter.Next() {
+		n++
+	}
+	fmt.Fprintln(c.out, n)
+	return nil
+}
+
+// setFormat format [utf8|hex|json]，不带参数时输出当前的格式
+func (c *CLI) setFormat(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.out, c.format)
+		return nil
+	}
+	format := strings.ToLower(args[0])
+	if !validFormat(format) {
+		return errUnknownFormat
+	}
+	c.format = format
+	return nil
+}
+
+// printHistory history
+func (c *CLI) printHistory(args []string) error {
+	for i, line := range c.history {
+		fmt.Fprintf(c.out, "%5d  %s\n", i+1, line)
+	}
+	return nil
+}
+
+// help help
+func (c *CLI) help(args []string) error {
+	for _, name := range []string{"get", "put", "delete", "scan", "count", "format", "history", "help", "exit"} {
+		fmt.Fprintf(c.out, "  %s\n", cliCommands[name].usage)
+	}
+	fmt.Fprintln(c.out, "  !! / !N      rerun the last / N-th command in history")
+	return nil
+}
+
+// exit exit
+func (c *CLI) exit(args []string) error {
+	return errExit
+}
+
+// printValue 按照当前的格式输出value
+func (c *CLI) printValue(value []byte) {
+	if c.format == formatJSON {
+		c.printJSON(map[string]string{"value": string(value)})
+		return
+	}
+	fmt.Fprintln(c.out, c.encode(value))
+}
+
+// printPair 按照当前的格式输出一对key和value
+func (c *CLI) printPair(key, value []byte) {
+	if c.format == formatJSON {
+		c.printJSON(map[string]string{"key": string(key), "value": string(value)})
+		return
+	}
+	fmt.Fprintf(c.out, "%s\t%s\n", c.encode(key), c.encode(value))
+}
+
+// encode 将数据编码为utf8或者hex的格式，不是合法utf8的数据会转义输出
+func (c *CLI) encode(b []byte) string {
+	if c.format == formatHex {
+		return hex.EncodeToString(b)
+	}
+	if !utf8.Valid(b) {
+		s := strconv.Quote(string(b))
+		return s[1 : len(s)-1]
+	}
+	return string(b)
+}
+
+// printJSON 输出一行JSON，不是合法utf8的字节会被替换为U+FFFD
+func (c *CLI) printJSON(v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintln(c.out, string(data))
+}
+
+func validFormat(format string) bool {
+	return format == formatUTF8 || format == formatHex || format == formatJSON
+}
+
+// splitArgs 按照空白字符拆分参数，双引号中的参数可以包含空白字符和\x00这样的转义
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return args, nil
+		}
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			args = append(args, line[:end])
+			line = line[end:]
+			continue
+		}
+
+		// 找到没有被转义的结束引号
+		end := -1
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, errUnclosedQuote
+		}
+		arg, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted argument %s", line[:end+1])
+		}
+		args = append(args, arg)
+		line = line[end+1:]
+	}
+}
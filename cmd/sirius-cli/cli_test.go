@@ -0,0 +1,117 @@
+package main
+
+import (
+	sirius "Sirius"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestCLI 打开测试数据库，测试结束时关闭并删除
+func openTestCLI(t *testing.T, readOnly bool) (*CLI, *bytes.Buffer) {
+	opts := sirius.DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-cli-test")
+	if readOnly {
+		// 只读模式要求数据目录已经存在
+		db, err := sirius.Open(opts)
+		assert.Nil(t, err)
+		assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+		assert.Nil(t, db.Close())
+	}
+	opts.ReadOnly = readOnly
+	db, err := sirius.Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		assert.Nil(t, db.Close())
+		_ = os.RemoveAll(opts.DirPath)
+	})
+
+	out := &bytes.Buffer{}
+	cli, err := NewCLI(db, out, formatUTF8)
+	assert.Nil(t, err)
+	return cli, out
+}
+
+func TestCLI_Execute(t *testing.T) {
+	cli, out := openTestCLI(t, false)
+
+	testCases := []struct {
+		name string
+		line string
+		want string
+		err  string
+	}{
+		{name: "空行", line: "  ", want: ""},
+		{name: "put", line: "put a 1", want: "OK\n"},
+		{name: "put带引号", line: `put "b c" "hello world"`, want: "OK\n"},
+		{name: "put转义字符", line: `put bin "\x00\xff"`, want: "OK\n"},
+		{name: "put ttl", line: "put session x 1h", want: "OK\n"},
+		{name: "put非法的ttl", line: "put session x abc", err: sirius.ErrInvalidTTL.Error()},
+		{name: "get", line: "get a", want: "1\n"},
+		{name: "命令不区分大小写", line: `GET "b c"`, want: "hello world\n"},
+		{name: "get不存在的key", line: "get d", err: sirius.ErrKeyNotFound.Error()},
+		{name: "get非utf8的value", line: "get bin", want: `\x00\xff` + "\n"},
+		{name: "scan", line: "scan", want: "a\t1\nb c\thello world\nbin\t\\x00\\xff\nsession\tx\n"},
+		{name: "scan prefix", line: "scan b", want: "b c\thello world\nbin\t\\x00\\xff\n"},
+		{name: "scan limit", line: `scan "" 1`, want: "a\t1\n"},
+		{name: "scan非法的limit", line: "scan a x", err: "invalid limit 'x'"},
+		{name: "count", line: "count", want: "4\n"},
+		{name: "count prefix", line: "count b", want: "2\n"},
+		{name: "format hex", line: "format hex", want: ""},
+		{name: "hex格式get", line: "get bin", want: "00ff\n"},
+		{name: "hex格式scan", line: "scan a", want: "61\t31\n"},
+		{name: "format json", line: "format json", want: ""},
+		{name: "json格式get", line: "get a", want: `{"value":"1"}` + "\n"},
+		{name: "json格式scan", line: "scan a", want: `{"key":"a","value":"1"}` + "\n"},
+		{name: "查看format", line: "format", want: "json\n"},
+		{name: "未知的format", line: "format xml", err: errUnknownFormat.Error()},
+		{name: "delete", line: "delete a", want: "OK\n"},
+		{name: "delete之后count", line: "count", want: "3\n"},
+		{name: "参数个数不对", line: "get", err: "usage: get <key>"},
+		{name: "未知命令", line: "foo", err: "unknown command 'foo', type help for usage"},
+		{name: "引号不匹配", line: `get "a`, err: errUnclosedQuote.Error()},
+		{name: "exit", line: "exit", err: errExit.Error()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out.Reset()
+			err := cli.Execute(tc.line)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out.String())
+		})
+	}
+}
+
+func TestCLI_History(t *testing.T) {
+	cli, out := openTestCLI(t, false)
+	cli.LoadHistory([]string{"put a 1"})
+
+	assert.Nil(t, cli.Execute("!!"))
+	assert.Equal(t, "put a 1\nOK\n", out.String())
+	assert.Nil(t, cli.Execute("get a"))
+
+	out.Reset()
+	assert.Nil(t, cli.Execute("!3"))
+	assert.Equal(t, "get a\n1\n", out.String())
+	assert.Equal(t, errNoHistory, cli.Execute("!100"))
+
+	out.Reset()
+	assert.Nil(t, cli.Execute("history"))
+	assert.Equal(t, "    1  put a 1\n    2  put a 1\n    3  get a\n    4  get a\n    5  history\n", out.String())
+}
+
+func TestCLI_ReadOnly(t *testing.T) {
+	cli, out := openTestCLI(t, true)
+
+	assert.Nil(t, cli.Run([]string{"get", "a"}))
+	assert.Equal(t, "1\n", out.String())
+	assert.Equal(t, sirius.ErrReadOnly, cli.Run([]string{"put", "a", "2"}))
+	assert.Equal(t, sirius.ErrReadOnly, cli.Run([]string{"delete", "a"}))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	sirius "Sirius"
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxHistorySize 最多保存的历史命令数量
+const maxHistorySize = 1000
+
+func main() {
+	dirPath := flag.String("dir", "", "database directory")
+	write := flag.Bool("write", false, "open the database in read-write mode")
+	format := flag.String("format", formatUTF8, "output format: utf8, hex or json")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sirius-cli -dir <path> [-write] [-format utf8|hex|json] [command [args...]]\n")
+		fmt.Fprintf(os.Stderr, "without a command, an interactive shell is started\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *dirPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// 默认以只读模式打开，避免误操作修改数据目录中的数据文件
+	opts := sirius.DefaultOptions
+	opts.DirPath = *dirPath
+	opts.ReadOnly = !*write
+	db, err := sirius.Open(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open database failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	cli, err := NewCLI(db, os.Stdout, *format)
+	if err != nil {
+		_ = db.Close()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var code int
+	if flag.NArg() > 0 {
+		// 一次性执行模式，命令出错时返回非0的退出码，方便在脚本中使用
+		if err := cli.Run(flag.Args()); err != nil && err != errExit {
+			fmt.Fprintf(os.Stderr, "(error) %v\n", err)
+			code = 1
+		}
+	} else {
+		repl(cli, opts.ReadOnly)
+	}
+	if err := db.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "close database failed: %v\n", err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// repl 交互模式，逐行读取并执行命令，退出时保存历史命令
+func repl(cli *CLI, readOnly bool) {
+	historyPath := historyFilePath()
+	cli.LoadHistory(loadHistory(historyPath))
+	loaded := len(cli.History())
+
+	prompt := "sirius> "
+	if readOnly {
+		prompt = "sirius(read-only)> "
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for {
+		fmt.Print(prompt)
+		if !scanner.Scan() {
+			fmt.Println()
+			break
+		}
+		err := cli.Execute(scanner.Text())
+		if err == errExit {
+			break
+		}
+		if err != nil {
+			fmt.Printf("(error) %v\n", err)
+		}
+	}
+
+	if historyPath != "" {
+		if err := saveHistory(historyPath, cli.History()[loaded:]); err != nil {
+			fmt.Fprintf(os.Stderr, "save history failed: %v\n", err)
+		}
+	}
+}
+
+// historyFilePath 历史命令保存在用户目录下，获取不到用户目录时不保存
+func historyFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".sirius_cli_history")
+}
+
+// loadHistory 读取最近的maxHistorySize条历史命令
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxHistorySize {
+		lines = lines[len(lines)-maxHistorySize:]
+	}
+	var history []string
+	for _, line := range lines {
+		if line != "" {
+			history = append(history, line)
+		}
+	}
+	return history
+}
+
+// saveHistory 将本次执行的命令追加到历史文件中
+func saveHistory(path string, history []string) error {
+	if len(history) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(strings.Join(history, "\n") + "\n")
+	return err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"Sirius/data"
+	"Sirius/fio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dumpOptions 过滤以及输出的配置
+type dumpOptions struct {
+	// Prefix 只输出真实key以Prefix开头的记录，为空时输出所有记录
+	Prefix []byte
+	// FileId 只输出指定数据文件中的记录，小于0时输出所有数据文件
+	FileId int64
+	// MaxLen key和value最多输出的字节数，超过时截断，0表示不截断
+	MaxLen int
+	// KeyProvider 解密加密的数据文件使用的密钥，为nil时跳过加密的数据文件，只输出文件头
+	KeyProvider data.KeyProvider
+}
+
+// dumpStats 遍历过的记录的统计信息，包含被过滤掉的记录
+type dumpStats struct {
+	Files       int
+	Records     int
+	Normal      int
+	Deleted     int
+	TxnFinished int
+	InvalidCRC  int
+	// Truncated 文件末尾无法解析的记录数量，一般是写入时进程崩溃留下的
+	Truncated int
+	// Encrypted 没有密钥而跳过的加密数据文件数量，不计入Files
+	Encrypted int
+}
+
+// dumpDir 按照文件id从小到大遍历目录中所有的数据文件，输出每一条记录
+func dumpDir(dirPath string, opts dumpOptions, w io.Writer) (*dumpStats, error) {
+	fileIds, err := listDataFiles(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &dumpStats{}
+	fmt.Fprintf(w, "%-9s %-10s %-8s %-12s %-6s %-7s %-20s %s\n",
+		"FID", "OFFSET", "SIZE", "TYPE", "SEQ", "CRC", "EXPIRE", "KEY / VALUE")
+	for _, fid := range fileIds {
+		if opts.FileId >= 0 && int64(fid) != opts.FileId {
+			continue
+		}
+		err := dumpFile(dirPath, fid, opts, w, stats)
+		if err == data.ErrEncryptedFile {
+			if err := dumpEncryptedHeader(dirPath, fid, w); err != nil {
+				return stats, err
+			}
+			stats.Encrypted++
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Files++
+	}
+	return stats, nil
+}
+
+// dumpFile 从头到尾读取一个数据文件
+// CRC校验失败的记录会标记出来并且跳过继续读取，读到无法解析的文件末尾时停止
+func dumpFile(dirPath string, fid uint32, opts dumpOptions, w io.Writer, stats *dumpStats) error {
+	// 使用MMap以只读的方式打开，不会修改数据文件
+	dataFile, err := data.OpenDataFileWithOptions(dirPath, fid, fio.MemoryMap, data.DataFileOptions{KeyProvider: opts.KeyProvider})
+	if err != nil {
+		return err
+	}
+	defer dataFile.Close()
+
+	var offset int64 = 0
+	for {
+		record, size, err := dataFile.ReadLogRecord(offset)
+		crcValid := true
+		if err == data.ErrInvalidCRC {
+			crcValid = false
+		} else if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		stats.Records++
+		switch record.Type {
+		case data.LogRecordNormal:
+			stats.Normal++
+		case data.LogRecordDeleted:
+			stats.Deleted++
+		case data.LogRecordTxnFinished:
+			stats.TxnFinished++
+		}
+		if !crcValid {
+			stats.InvalidCRC++
+		}
+
+		key, seqNo := record.Key, record.SeqNo
+		if bytes.HasPrefix(key, opts.Prefix) {
+			crc := "ok"
+			if !crcValid {
+				crc = "INVALID"
+			}
+			fmt.Fprintf(w, "%-9d %-10d %-8d %-12s %-6d %-7s %-20s %s = %s\n",
+				fid, offset, size, recordTypeName(record.Type), seqNo, crc, formatExpire(record.Expire),
+				truncate(key, opts.MaxLen), truncate(record.Value, opts.MaxLen))
+		}
+		offset += size
+	}
+
+	// 正常情况下所有的数据都能被解析，剩余的数据是写了一半的记录或者被破坏的数据
+	if offset < dataFile.WriteOff {
+		stats.Truncated++
+		fmt.Fprintf(w, "%-9d %-10d %-8d %-12s unreadable data at the end of the file\n",
+			fid, offset, dataFile.WriteOff-offset, "TRUNCATED")
+	}
+	return nil
+}
+
+// dumpEncryptedHeader 没有密钥时无法解析加密的数据文件，只输出文件头中记录的密钥id
+func dumpEncryptedHeader(dirPath string, fid uint32, w io.Writer) error {
+	header, err := data.ReadFileHeader(data.GetDataFileName(dirPath, fid))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%-9d %-10d %-8d %-12s encrypted with key id %d, skipped, use -key to decrypt\n",
+		fid, 0, data.FileHeaderSize, "ENCRYPTED", header.KeyID)
+	return nil
+}
+
+// listDataFiles 获取目录中所有数据文件的id
+func listDataFiles(dirPath string) ([]uint32, error) {
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var fileIds []uint32
+	for _, entry := range dirEntries {
+		if !strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
+			continue
+		}
+		fileId, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), data.DataFileNameSuffix), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data file name %s", entry.Name())
+		}
+		fileIds = append(fileIds, uint32(fileId))
+	}
+	sort.Slice(fileIds, func(i, j int) bool { return fileIds[i] < fileIds[j] })
+	return fileIds, nil
+}
+
+func recordTypeName(typ data.LogRecordType) string {
+	switch typ {
+	case data.LogRecordNormal:
+		return "Normal"
+	case data.LogRecordDeleted:
+		return "Deleted"
+	case data.LogRecordTxnFinished:
+		return "TxnFinished"
+	default:
+		return fmt.Sprintf("Unknown(%d)", typ)
+	}
+}
+
+// formatExpire 没有过期时间时输出-
+func formatExpire(expire int64) string {
+	if expire == 0 {
+		return "-"
+	}
+	return time.Unix(0, expire).UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// truncate 转义输出数据，超过maxLen字节时截断并注明总长度
+func truncate(b []byte, maxLen int) string {
+	if maxLen > 0 && len(b) > maxLen {
+		return fmt.Sprintf("%s...(%d bytes)", strconv.Quote(string(b[:maxLen])), len(b))
+	}
+	return strconv.Quote(string(b))
+}
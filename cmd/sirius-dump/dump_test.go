@@ -0,0 +1,160 @@
+package main
+
+import (
+	sirius "Sirius"
+	"Sirius/data"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// prepareTestDir 写入一些数据之后关闭数据库，返回数据目录
+func prepareTestDir(t *testing.T) string {
+	opts := sirius.DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-dump-test")
+	t.Cleanup(func() {
+		_ = os.RemoveAll(opts.DirPath)
+	})
+	db, err := sirius.Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("user:1"), []byte("alice")))
+	assert.Nil(t, db.Put([]byte("user:2"), []byte("bob")))
+	assert.Nil(t, db.Put([]byte("user:1"), []byte(strings.Repeat("a", 100))))
+	assert.Nil(t, db.Delete([]byte("user:2")))
+	wb := db.NewWriteBatch(sirius.DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("order:1"), []byte("book")))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Close())
+	return opts.DirPath
+}
+
+func TestDumpDir(t *testing.T) {
+	dirPath := prepareTestDir(t)
+
+	testCases := []struct {
+		name      string
+		opts      dumpOptions
+		wantLines []string
+		wantStats dumpStats
+	}{
+		{
+			name: "所有记录",
+			opts: dumpOptions{FileId: -1, MaxLen: 8},
+			wantLines: []string{
+				`Normal       0      ok      -                    "user:1" = "alice"`,
+				`Normal       0      ok      -                    "user:2" = "bob"`,
+				`Normal       0      ok      -                    "user:1" = "aaaaaaaa"...(100 bytes)`,
+				`Deleted      0      ok      -                    "user:2" = ""`,
+				`Normal       1      ok      -                    "order:1" = "book"`,
+				`TxnFinished  1      ok      -                    "txn-fin" = ""`,
+			},
+			wantStats: dumpStats{Files: 1, Records: 6, Normal: 4, Deleted: 1, TxnFinished: 1},
+		},
+		{
+			name: "按照key前缀过滤",
+			opts: dumpOptions{Prefix: []byte("user:2"), FileId: -1},
+			wantLines: []string{
+				`0         18         16       Normal       0      ok      -                    "user:2" = "bob"`,
+				`0         148        13       Deleted      0      ok      -                    "user:2" = ""`,
+			},
+			wantStats: dumpStats{Files: 1, Records: 6, Normal: 4, Deleted: 1, TxnFinished: 1},
+		},
+		{
+			name:      "按照文件id过滤",
+			opts:      dumpOptions{FileId: 1},
+			wantLines: nil,
+			wantStats: dumpStats{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			stats, err := dumpDir(dirPath, tc.opts, out)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantStats, *stats)
+
+			// 第一行是表头
+			lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")[1:]
+			assert.Equal(t, len(tc.wantLines), len(lines))
+			for i := range lines {
+				assert.Contains(t, lines[i], tc.wantLines[i])
+			}
+		})
+	}
+}
+
+func TestDumpDir_Corrupted(t *testing.T) {
+	dirPath := prepareTestDir(t)
+	fileName := data.GetDataFileName(dirPath, 0)
+
+	// 修改第一条记录value的最后一个字节，并且在文件末尾写入写了一半的记录
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	// 文件头之后是第一条记录，记录头部7字节
+	content[data.FileHeaderSize+7+len("user:1")+len("alice")-1] = 'x'
+	content = append(content, 1, 2, 3, 4, 0, 10)
+	assert.Nil(t, os.WriteFile(fileName, content, 0644))
+
+	out := &bytes.Buffer{}
+	stats, err := dumpDir(dirPath, dumpOptions{FileId: -1}, out)
+	assert.Nil(t, err)
+	assert.Equal(t, dumpStats{Files: 1, Records: 6, Normal: 4, Deleted: 1, TxnFinished: 1, InvalidCRC: 1, Truncated: 1}, *stats)
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	assert.Equal(t, 8, len(lines))
+	assert.Contains(t, lines[1], `INVALID`)
+	assert.Contains(t, lines[1], `"user:1" = "alicx"`)
+	assert.Contains(t, lines[2], `"user:2" = "bob"`)
+	assert.Contains(t, lines[7], "TRUNCATED")
+	assert.Contains(t, lines[7], " 6 ")
+}
+
+func TestDumpDir_Encrypted(t *testing.T) {
+	keyProvider := &sirius.StaticKeyProvider{ActiveID: 3, Keys: map[uint32][]byte{3: bytes.Repeat([]byte{3}, 16)}}
+	opts := sirius.DefaultOptions
+	opts.DirPath = t.TempDir()
+	opts.Encryption.KeyProvider = keyProvider
+	db, err := sirius.Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("user:1"), []byte("alice")))
+	assert.Nil(t, db.Close())
+
+	testCases := []struct {
+		name      string
+		opts      dumpOptions
+		wantLines []string
+		wantStats dumpStats
+	}{
+		{
+			name:      "没有密钥时跳过加密的数据文件",
+			opts:      dumpOptions{FileId: -1},
+			wantLines: []string{"ENCRYPTED    encrypted with key id 3, skipped"},
+			wantStats: dumpStats{Encrypted: 1},
+		},
+		{
+			name:      "使用密钥解密",
+			opts:      dumpOptions{FileId: -1, KeyProvider: keyProvider},
+			wantLines: []string{`Normal       0      ok      -                    "user:1" = "alice"`},
+			wantStats: dumpStats{Files: 1, Records: 1, Normal: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			stats, err := dumpDir(opts.DirPath, tc.opts, out)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantStats, *stats)
+
+			lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")[1:]
+			assert.Equal(t, len(tc.wantLines), len(lines))
+			for i := range lines {
+				assert.Contains(t, lines[i], tc.wantLines[i])
+			}
+		})
+	}
+}
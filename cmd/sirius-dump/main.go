@@ -0,0 +1,50 @@
+package main
+
+import (
+	"Sirius/data"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	dirPath := flag.String("dir", "", "database directory")
+	prefix := flag.String("prefix", "", "only dump records whose key has this prefix")
+	fileId := flag.Int64("fid", -1, "only dump records in this data file, -1 for all files")
+	maxLen := flag.Int("max", 64, "truncate keys and values longer than this many bytes, 0 to disable")
+	key := flag.String("key", "", "hex encoded AES key to decrypt encrypted data files, encrypted files are skipped without it")
+	keyID := flag.Uint("keyid", 0, "id of the key given by -key, as recorded in the data file header")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sirius-dump -dir <path> [-prefix <key prefix>] [-fid <file id>] [-max <bytes>] [-key <hex> -keyid <id>]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *dirPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// 直接读取数据文件，不打开数据库，也不需要获取数据目录的文件锁
+	opts := dumpOptions{Prefix: []byte(*prefix), FileId: *fileId, MaxLen: *maxLen}
+	if *key != "" {
+		keyBytes, err := hex.DecodeString(*key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -key: %v\n", err)
+			os.Exit(2)
+		}
+		opts.KeyProvider = &data.StaticKeyProvider{
+			ActiveID: uint32(*keyID),
+			Keys:     map[uint32][]byte{uint32(*keyID): keyBytes},
+		}
+	}
+	stats, err := dumpDir(*dirPath, opts, os.Stdout)
+	if stats != nil {
+		fmt.Printf("\nfiles: %d, records: %d (normal: %d, deleted: %d, txn finished: %d), invalid crc: %d, truncated: %d, encrypted skipped: %d\n",
+			stats.Files, stats.Records, stats.Normal, stats.Deleted, stats.TxnFinished, stats.InvalidCRC, stats.Truncated, stats.Encrypted)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dump failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	sirius "Sirius"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultListLimit 范围查询默认返回的数量
+	defaultListLimit = 100
+	// maxListLimit 范围查询最多返回的数量
+	maxListLimit = 1000
+	// maxRequestBodySize 请求体的最大长度
+	maxRequestBodySize = 64 * 1024 * 1024
+)
+
+var (
+	errInvalidBody   = errors.New("invalid request body")
+	errInvalidLimit  = errors.New("invalid limit")
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidOp     = errors.New("invalid batch op, must be put or delete")
+)
+
+// kvItem 一条kv数据，key和value都使用base64编码，JSON字符串不能保存不是UTF-8的二进制数据
+type kvItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// putRequest PUT /kv/{key}的请求体，ttl以秒为单位，0表示永不过期
+type putRequest struct {
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl,omitempty"`
+}
+
+// listResponse GET /kv的返回值，NextCursor为空表示已经遍历完
+type listResponse struct {
+	Items      []kvItem `json:"items"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// batchOp 批量写入中的一个操作，key和value都使用base64编码
+type batchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// batchRequest POST /batch的请求体
+type batchRequest struct {
+	Ops []batchOp `json:"ops"`
+}
+
+// errorResponse 出错时的返回值
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler 基于sirius.DB的HTTP/JSON接口
+type Handler struct {
+	db  *sirius.DB
+	mux *http.ServeMux
+}
+
+// NewHandler 初始化HTTP接口
+func NewHandler(db *sirius.DB) *Handler {
+	h := &Handler{db: db, mux: http.NewServeMux()}
+	h.mux.HandleFunc("PUT /kv/{key}", h.put)
+	h.mux.HandleFunc("GET /kv/{key}", h.get)
+	h.mux.HandleFunc("DELETE /kv/{key}", h.delete)
+	h.mux.HandleFunc("GET /kv", h.list)
+	h.mux.HandleFunc("POST /batch", h.batch)
+	h.mux.HandleFunc("GET /healthz", h.healthz)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// put PUT /kv/{key} {"value": "base64", "ttl": 60}
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	var req putRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	value, err := base64.StdEncoding.DecodeString(req.Value)
+	if err != nil {
+		writeError(w, errInvalidBody)
+		return
+	}
+
+	key := []byte(r.PathValue("key"))
+	if req.TTL > 0 {
+		err = h.db.PutWithTTL(key, value, time.Duration(req.TTL)*time.Second)
+	} else if req.TTL < 0 {
+		err = sirius.ErrInvalidTTL
+	} else {
+		err = h.db.Put(key, value)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get GET /kv/{key}
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, err := h.db.Get([]byte(key))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newKVItem([]byte(key), value))
+}
+
+// delete DELETE /kv/{key}，key不存在时也返回成功
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.db.Delete([]byte(r.PathValue("key"))); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list GET /kv?prefix=&limit=&cursor=
+// cursor是上一页返回的next_cursor，也就是下一页第一个key的base64编码
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultListLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxListLimit {
+			writeError(w, errInvalidLimit)
+			return
+		}
+		limit = n
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(query.Get("cursor"))
+	if err != nil {
+		writeError(w, errInvalidCursor)
+		return
+	}
+
+	iter := h.db.NewIterator(sirius.IteratorOptions{Prefix: []byte(query.Get("prefix"))})
+	defer iter.Close()
+	if len(cursor) > 0 {
+		iter.Seek(cursor)
+	}
+
+	resp := listResponse{Items: []kvItem{}}
+	for ; iter.Valid(); iter.Next() {
+		if len(resp.Items) == limit {
+			resp.NextCursor = base64.RawURLEncoding.EncodeToString(iter.Key())
+			break
+		}
+		value, err := iter.Value()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resp.Items = append(resp.Items, newKVItem(iter.Key(), value))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// batch POST /batch {"ops": [{"op": "put", "key": "base64", "value": "base64"}, {"op": "delete", "key": "base64"}]}
+// 所有的操作使用WriteBatch原子写入
+func (h *Handler) batch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	wb := h.db.NewWriteBatch(sirius.DefaultWriteBatchOptions)
+	for _, op := range req.Ops {
+		key, err := base64.StdEncoding.DecodeString(op.Key)
+		if err != nil {
+			writeError(w, errInvalidBody)
+			return
+		}
+		switch op.Op {
+		case "put":
+			var value []byte
+			value, err = base64.StdEncoding.DecodeString(op.Value)
+			if err != nil {
+				writeError(w, errInvalidBody)
+				return
+			}
+			err = wb.Put(key, value)
+		case "delete":
+			err = wb.Delete(key)
+		default:
+			err = errInvalidOp
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// healthz GET /healthz
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.db.Stat(); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// newKVItem 编码返回的kv数据
+func newKVItem(key, value []byte) kvItem {
+	return kvItem{Key: base64.StdEncoding.EncodeToString(key), Value: base64.StdEncoding.EncodeToString(value)}
+}
+
+// decodeBody 解析JSON请求体
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errInvalidBody
+	}
+	return nil
+}
+
+// statusCode 将错误映射为HTTP状态码
+func statusCode(err error) int {
+	switch err {
+	case sirius.ErrKeyNotFound:
+		return http.StatusNotFound
+	case sirius.ErrKeyIsEmpty, sirius.ErrInvalidTTL, sirius.ErrExceedMaxBatchNum,
+		errInvalidBody, errInvalidLimit, errInvalidCursor, errInvalidOp:
+		return http.StatusBadRequest
+	case sirius.ErrDatabaseClosed:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError 返回错误信息
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusCode(err), errorResponse{Error: err.Error()})
+}
+
+// writeJSON 返回JSON数据
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	sirius "Sirius"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestHandler 在临时目录中打开数据库，测试结束时清理
+func newTestHandler(t *testing.T) (*Handler, *sirius.DB) {
+	opts := sirius.DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-http-test")
+	db, err := sirius.Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+		_ = os.RemoveAll(opts.DirPath)
+	})
+	return NewHandler(db), db
+}
+
+func doRequest(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestHandler_KV(t *testing.T) {
+	h, db := newTestHandler(t)
+
+	testCases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "GET不存在的key", method: http.MethodGet, target: "/kv/a", wantStatus: http.StatusNotFound, wantBody: `{"error":"key not found"}`},
+		{name: "PUT", method: http.MethodPut, target: "/kv/a", body: `{"value":"` + b64("\x00\x01binary") + `"}`, wantStatus: http.StatusNoContent},
+		{name: "GET", method: http.MethodGet, target: "/kv/a", wantStatus: http.StatusOK, wantBody: `{"key":"` + b64("a") + `","value":"` + b64("\x00\x01binary") + `"}`},
+		{name: "PUT带ttl", method: http.MethodPut, target: "/kv/b", body: `{"value":"` + b64("2") + `","ttl":60}`, wantStatus: http.StatusNoContent},
+		{name: "PUT非法ttl", method: http.MethodPut, target: "/kv/b", body: `{"value":"` + b64("2") + `","ttl":-1}`, wantStatus: http.StatusBadRequest},
+		{name: "PUT非法value", method: http.MethodPut, target: "/kv/b", body: `{"value":"!!"}`, wantStatus: http.StatusBadRequest},
+		{name: "PUT非法JSON", method: http.MethodPut, target: "/kv/b", body: `value`, wantStatus: http.StatusBadRequest},
+		{name: "DELETE", method: http.MethodDelete, target: "/kv/a", wantStatus: http.StatusNoContent},
+		{name: "DELETE之后GET", method: http.MethodGet, target: "/kv/a", wantStatus: http.StatusNotFound},
+		{name: "DELETE不存在的key", method: http.MethodDelete, target: "/kv/a", wantStatus: http.StatusNoContent},
+		{name: "不支持的方法", method: http.MethodPost, target: "/kv/a", wantStatus: http.StatusMethodNotAllowed},
+		{name: "healthz", method: http.MethodGet, target: "/healthz", wantStatus: http.StatusOK, wantBody: `{"status":"ok"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doRequest(h, tc.method, tc.target, tc.body)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantBody != "" {
+				assert.JSONEq(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+
+	// 数据库关闭之后返回503
+	assert.Nil(t, db.Close())
+	rec := doRequest(h, http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHandler_ListAndBatch(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rec := doRequest(h, http.MethodPost, "/batch", `{"ops":[
+		{"op":"put","key":"`+b64("user:1")+`","value":"`+b64("a")+`"},
+		{"op":"put","key":"`+b64("user:2")+`","value":"`+b64("b")+`"},
+		{"op":"put","key":"`+b64("user:3")+`","value":"`+b64("c")+`"},
+		{"op":"put","key":"`+b64("order:1")+`","value":"`+b64("d")+`"},
+		{"op":"delete","key":"`+b64("user:3")+`"}
+	]}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(h, http.MethodPost, "/batch", `{"ops":[{"op":"get","key":"`+b64("user:1")+`"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(h, http.MethodPost, "/batch", `{"ops":[{"op":"delete","key":"user:1"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// 分页遍历前缀为user:的key
+	var keys []string
+	var cursor string
+	for {
+		rec = doRequest(h, http.MethodGet, "/kv?prefix=user:&limit=1&cursor="+cursor, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp listResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		for _, item := range resp.Items {
+			key, err := base64.StdEncoding.DecodeString(item.Key)
+			assert.Nil(t, err)
+			keys = append(keys, string(key))
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+
+	rec = doRequest(h, http.MethodGet, "/kv", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"items":[
+		{"key":"`+b64("order:1")+`","value":"`+b64("d")+`"},
+		{"key":"`+b64("user:1")+`","value":"`+b64("a")+`"},
+		{"key":"`+b64("user:2")+`","value":"`+b64("b")+`"}
+	]}`, rec.Body.String())
+
+	rec = doRequest(h, http.MethodGet, "/kv?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(h, http.MethodGet, "/kv?cursor=!!", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_BinaryKey(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	// 不是UTF-8的key
+	key := "\xff\x00key"
+	rec := doRequest(h, http.MethodPost, "/batch", `{"ops":[{"op":"put","key":"`+b64(key)+`","value":"`+b64("v")+`"}]}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	testCases := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{name: "GET", target: "/kv/%FF%00key", want: `{"key":"` + b64(key) + `","value":"` + b64("v") + `"}`},
+		{name: "遍历", target: "/kv", want: `{"items":[{"key":"` + b64(key) + `","value":"` + b64("v") + `"}]}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doRequest(h, http.MethodGet, tc.target, "")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, tc.want, rec.Body.String())
+		})
+	}
+
+	// 返回的key可以原样用于删除
+	rec = doRequest(h, http.MethodPost, "/batch", `{"ops":[{"op":"delete","key":"`+b64(key)+`"}]}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(h, http.MethodGet, "/kv/%FF%00key", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
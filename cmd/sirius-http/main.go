@@ -0,0 +1,58 @@
+package main
+
+import (
+	sirius "Sirius"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address")
+	dirPath := flag.String("dir", "/tmp/sirius-http", "database directory")
+	flag.Parse()
+
+	opts := sirius.DefaultOptions
+	opts.DirPath = *dirPath
+	db, err := sirius.Open(opts)
+	if err != nil {
+		log.Fatalf("open database failed: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           NewHandler(db),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// 收到退出信号之后，等待正在处理的请求完成再关闭数据库
+	done := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Printf("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("shutdown server failed: %v", err)
+		}
+		close(done)
+	}()
+
+	log.Printf("sirius-http is listening on %s", *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("serve failed: %v", err)
+	} else {
+		<-done
+	}
+	if err := db.Close(); err != nil {
+		log.Fatalf("close database failed: %v", err)
+	}
+}
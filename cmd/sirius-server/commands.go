@@ -0,0 +1,309 @@
+package main
+
+import (
+	sirius "Sirius"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command 命令的参数个数限制以及处理函数，maxArgs为-1表示不限制
+type command struct {
+	minArgs int
+	maxArgs int
+	handler func(db *sirius.DB, w *respWriter, args [][]byte)
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"ping":    {minArgs: 0, maxArgs: 1, handler: ping},
+		"command": {minArgs: 0, maxArgs: -1, handler: commandInfo},
+		"set":     {minArgs: 2, maxArgs: 4, handler: set},
+		"get":     {minArgs: 1, maxArgs: 1, handler: get},
+		"del":     {minArgs: 1, maxArgs: -1, handler: del},
+		"exists":  {minArgs: 1, maxArgs: -1, handler: exists},
+		"mget":    {minArgs: 1, maxArgs: -1, handler: mget},
+		"mset":    {minArgs: 2, maxArgs: -1, handler: mset},
+		"incr":    {minArgs: 1, maxArgs: 1, handler: incr},
+		"scan":    {minArgs: 1, maxArgs: 5, handler: scan},
+		"dbsize":  {minArgs: 0, maxArgs: 0, handler: dbsize},
+	}
+}
+
+// writeDBError 将存储引擎返回的错误写回客户端
+func writeDBError(w *respWriter, err error) {
+	w.writeError("ERR " + err.Error())
+}
+
+// ping PING [message]
+func ping(db *sirius.DB, w *respWriter, args [][]byte) {
+	if len(args) == 1 {
+		w.writeBulk(args[0])
+		return
+	}
+	w.writeSimpleString("PONG")
+}
+
+// commandInfo COMMAND，redis-cli启动时会调用，返回空数组即可
+func commandInfo(db *sirius.DB, w *respWriter, args [][]byte) {
+	w.writeArrayHeader(0)
+}
+
+// set SET key value [EX seconds|PX milliseconds]
+func set(db *sirius.DB, w *respWriter, args [][]byte) {
+	key, value := args[0], args[1]
+	if len(args) == 2 {
+		if err := db.Put(key, value); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.writeSimpleString("OK")
+		return
+	}
+	if len(args) != 4 {
+		w.writeError("ERR syntax error")
+		return
+	}
+
+	n, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil || n <= 0 {
+		w.writeError("ERR invalid expire time in 'set' command")
+		return
+	}
+	var ttl time.Duration
+	switch strings.ToLower(string(args[2])) {
+	case "ex":
+		ttl = time.Duration(n) * time.Second
+	case "px":
+		ttl = time.Duration(n) * time.Millisecond
+	default:
+		w.writeError("ERR syntax error")
+		return
+	}
+	if err := db.PutWithTTL(key, value, ttl); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.writeSimpleString("OK")
+}
+
+// get GET key
+func get(db *sirius.DB, w *respWriter, args [][]byte) {
+	value, err := db.Get(args[0])
+	if err == sirius.ErrKeyNotFound {
+		w.writeBulk(nil)
+		return
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	w.writeBulk(value)
+}
+
+// del DEL key [key ...]，返回被删除的key的数量
+func del(db *sirius.DB, w *respWriter, args [][]byte) {
+	var deleted int64
+	for _, key := range args {
+		if _, err := db.Get(key); err == sirius.ErrKeyNotFound {
+			continue
+		} else if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if err := db.Delete(key); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		deleted++
+	}
+	w.writeInteger(deleted)
+}
+
+// exists EXISTS key [key ...]，返回存在的key的数量，重复的key会重复计算
+func exists(db *sirius.DB, w *respWriter, args [][]byte) {
+	var count int64
+	for _, key := range args {
+		if _, err := db.Get(key); err == nil {
+			count++
+		} else if err != sirius.ErrKeyNotFound {
+			writeDBError(w, err)
+			return
+		}
+	}
+	w.writeInteger(count)
+}
+
+// mget MGET key [key ...]
+func mget(db *sirius.DB, w *respWriter, args [][]byte) {
+	values := make([][]byte, len(args))
+	for i, key := range args {
+		value, err := db.Get(key)
+		if err != nil && err != sirius.ErrKeyNotFound {
+			writeDBError(w, err)
+			return
+		}
+		if err == nil && value == nil {
+			value = []byte{}
+		}
+		values[i] = value
+	}
+	w.writeArrayHeader(len(values))
+	for _, value := range values {
+		w.writeBulk(value)
+	}
+}
+
+// mset MSET key value [key value ...]，使用WriteBatch保证所有的key一起生效
+func mset(db *sirius.DB, w *respWriter, args [][]byte) {
+	if len(args)%2 != 0 {
+		w.writeError("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	wb := db.NewWriteBatch(sirius.DefaultWriteBatchOptions)
+	for i := 0; i < len(args); i += 2 {
+		if err := wb.Put(args[i], args[i+1]); err != nil {
+			writeDBError(w, err)
+			return
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.writeSimpleString("OK")
+}
+
+// incr INCR key，在事务中完成读-改-写，和其他写入冲突时重试
+func incr(db *sirius.DB, w *respWriter, args [][]byte) {
+	for {
+		n, err := incrOnce(db, args[0])
+		if err == sirius.ErrTxnConflict {
+			continue
+		}
+		if err == strconv.ErrSyntax || err == strconv.ErrRange {
+			w.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.writeInteger(n)
+		return
+	}
+}
+
+// incrOnce 执行一次INCR事务，和Redis一样保留key原来的过期时间
+func incrOnce(db *sirius.DB, key []byte) (int64, error) {
+	txn, err := db.Begin(false)
+	if err != nil {
+		return 0, err
+	}
+	defer txn.Rollback()
+
+	// value和过期时间使用同一个时间点读取，key不会在两次读取之间过期而变成永不过期的key
+	var n int64
+	value, ttl, err := txn.GetWithTTL(key)
+	if err != nil && err != sirius.ErrKeyNotFound {
+		return 0, err
+	}
+	if err == nil {
+		n, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return 0, err.(*strconv.NumError).Err
+		}
+	}
+	if n == 1<<63-1 {
+		return 0, strconv.ErrRange
+	}
+	n++
+	value = []byte(strconv.FormatInt(n, 10))
+	if ttl > 0 {
+		err = txn.PutWithTTL(key, value, ttl)
+	} else {
+		err = txn.Put(key, value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, txn.Commit()
+}
+
+// scan SCAN cursor [MATCH pattern] [COUNT count]
+// cursor是下一次开始遍历的key的base64编码，0表示从头开始，遍历完所有的key之后返回0
+// 每次调用都从cursor对应的key开始Seek，最多检查count个key
+func scan(db *sirius.DB, w *respWriter, args [][]byte) {
+	var start []byte
+	if cursor := string(args[0]); cursor != "0" {
+		var err error
+		start, err = base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(start) == 0 {
+			w.writeError("ERR invalid cursor")
+			return
+		}
+	}
+	var err error
+	var pattern = []byte("*")
+	var count = 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.writeError("ERR syntax error")
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				w.writeError("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			w.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	iter := db.NewIterator(sirius.DefaultIteratorOptions)
+	defer iter.Close()
+	if start != nil {
+		iter.Seek(start)
+	}
+	var keys [][]byte
+	for i := 0; iter.Valid() && i < count; iter.Next() {
+		if globMatch(pattern, iter.Key()) {
+			keys = append(keys, iter.Key())
+		}
+		i++
+	}
+	// 遍历完所有的key之后cursor返回0
+	var next = "0"
+	if iter.Valid() {
+		next = base64.RawURLEncoding.EncodeToString(iter.Key())
+	}
+
+	w.writeArrayHeader(2)
+	w.writeBulk([]byte(next))
+	w.writeArrayHeader(len(keys))
+	for _, key := range keys {
+		w.writeBulk(key)
+	}
+}
+
+// dbsize DBSIZE
+func dbsize(db *sirius.DB, w *respWriter, args [][]byte) {
+	keys, err := db.ListKeys()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.writeInteger(int64(len(keys)))
+}
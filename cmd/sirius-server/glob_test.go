@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		str     string
+		want    bool
+	}{
+		{name: "任意字符串", pattern: "*", str: "user:1", want: true},
+		{name: "前缀", pattern: "user:*", str: "user:1", want: true},
+		{name: "*匹配/", pattern: "user*", str: "user/1/profile", want: true},
+		{name: "中间的*", pattern: "a*b*c", str: "axxbyyc", want: true},
+		{name: "中间的*不匹配", pattern: "a*b*c", str: "axxbyy", want: false},
+		{name: "连续的*", pattern: "a**c", str: "abc", want: true},
+		{name: "?匹配一个字符", pattern: "h?llo", str: "hello", want: true},
+		{name: "?匹配/", pattern: "a?b", str: "a/b", want: true},
+		{name: "?不匹配空", pattern: "h?llo", str: "hllo", want: false},
+		{name: "字符集合", pattern: "h[ae]llo", str: "hallo", want: true},
+		{name: "字符集合不匹配", pattern: "h[ae]llo", str: "hillo", want: false},
+		{name: "取反的字符集合", pattern: "h[^e]llo", str: "hallo", want: true},
+		{name: "取反的字符集合不匹配", pattern: "h[^e]llo", str: "hello", want: false},
+		{name: "字符范围", pattern: "key[0-9]", str: "key5", want: true},
+		{name: "反向的字符范围", pattern: "key[9-0]", str: "key5", want: true},
+		{name: "字符范围不匹配", pattern: "key[0-9]", str: "keyx", want: false},
+		{name: "转义*", pattern: `a\*b`, str: "a*b", want: true},
+		{name: "转义*不匹配", pattern: `a\*b`, str: "axb", want: false},
+		{name: "字符集合中的转义", pattern: `[\]]`, str: "]", want: true},
+		{name: "没有闭合的[", pattern: "a[bc", str: "ac", want: true},
+		{name: "完全相同", pattern: "abc", str: "abc", want: true},
+		{name: "模式更长", pattern: "abcd", str: "abc", want: false},
+		{name: "字符串更长", pattern: "abc", str: "abcd", want: false},
+		{name: "末尾的*匹配空", pattern: "abc*", str: "abc", want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, globMatch([]byte(tc.pattern), []byte(tc.str)))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	sirius "Sirius"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6380", "listen address")
+	dirPath := flag.String("dir", "/tmp/sirius-server", "database directory")
+	flag.Parse()
+
+	opts := sirius.DefaultOptions
+	opts.DirPath = *dirPath
+	db, err := sirius.Open(opts)
+	if err != nil {
+		log.Fatalf("open database failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		_ = db.Close()
+		log.Fatalf("listen on %s failed: %v", *addr, err)
+	}
+	server := NewServer(db)
+
+	// 收到退出信号之后，先停止服务，等所有命令处理完成再关闭数据库
+	done := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Printf("shutting down")
+		if err := server.Shutdown(); err != nil {
+			log.Printf("shutdown server failed: %v", err)
+		}
+		close(done)
+	}()
+
+	log.Printf("sirius-server is listening on %s", listener.Addr())
+	if err := server.Serve(listener); err != ErrServerClosed {
+		log.Printf("serve failed: %v", err)
+		_ = server.Shutdown()
+	} else {
+		<-done
+	}
+	if err := db.Close(); err != nil {
+		log.Fatalf("close database failed: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	ErrProtocol = errors.New("ERR Protocol error")
+)
+
+const (
+	// maxBulkLen 单个bulk string的最大长度，和Redis的proto-max-bulk-len默认值一致
+	maxBulkLen = 512 * 1024 * 1024
+	// maxArrayLen 一条命令中最多的参数数量
+	maxArrayLen = 1024 * 1024
+)
+
+// readCommand 读取一条命令，支持RESP数组格式以及telnet使用的inline格式
+// *<参数数量>\r\n$<参数长度>\r\n<参数>\r\n...
+func readCommand(reader *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		// inline命令，使用空白分割参数
+		return bytes.Fields(line), nil
+	}
+
+	// 命令不能是空数组(*-1)，负数的长度直接拒绝，否则分配参数时会panic
+	argc, err := strconv.Atoi(string(line[1:]))
+	if err != nil || argc < 0 || argc > maxArrayLen {
+		return nil, ErrProtocol
+	}
+	args := make([][]byte, 0, argc)
+	for i := 0; i < argc; i++ {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, ErrProtocol
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, ErrProtocol
+		}
+		// 参数后面还有\r\n
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, ErrProtocol
+		}
+		args = append(args, buf[:size])
+	}
+	return args, nil
+}
+
+// readLine 读取以\r\n结尾的一行，返回的数据不包含\r\n
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+// respWriter 将回复编码为RESP2格式
+type respWriter struct {
+	*bufio.Writer
+}
+
+// writeSimpleString +OK\r\n
+func (w *respWriter) writeSimpleString(s string) {
+	_, _ = w.WriteString("+" + s + "\r\n")
+}
+
+// writeError -ERR message\r\n
+func (w *respWriter) writeError(msg string) {
+	_, _ = w.WriteString("-" + msg + "\r\n")
+}
+
+// writeInteger :1\r\n
+func (w *respWriter) writeInteger(n int64) {
+	_, _ = w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// writeBulk $5\r\nhello\r\n，value为nil时写入空值$-1\r\n
+func (w *respWriter) writeBulk(value []byte) {
+	if value == nil {
+		_, _ = w.WriteString("$-1\r\n")
+		return
+	}
+	_, _ = w.WriteString("$" + strconv.Itoa(len(value)) + "\r\n")
+	_, _ = w.Write(value)
+	_, _ = w.WriteString("\r\n")
+}
+
+// writeArrayHeader *2\r\n，后面需要再写入数组中的每个元素
+func (w *respWriter) writeArrayHeader(n int) {
+	_, _ = w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	sirius "Sirius"
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrServerClosed = errors.New("sirius-server: server closed")
+
+// Server RESP协议服务，将Redis的字符串以及keyspace命令映射到sirius.DB
+type Server struct {
+	db       *sirius.DB
+	listener net.Listener
+	mu       *sync.Mutex
+	conns    map[net.Conn]struct{} // 正在处理的连接
+	closed   bool
+	wg       sync.WaitGroup // 等待所有连接处理完成
+}
+
+// NewServer 初始化RESP服务
+func NewServer(db *sirius.DB) *Server {
+	return &Server{
+		db:    db,
+		mu:    &sync.Mutex{},
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve 在listener上接受连接，每个连接使用一个goroutine处理，Shutdown之后返回ErrServerClosed
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// Shutdown 停止接受新的连接，已经读到的命令处理完成之后关闭所有连接
+// 返回之后不会再有命令访问sirius.DB，调用方可以安全地关闭数据库
+func (s *Server) Shutdown() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	// 让阻塞在读命令的连接立即返回，正在执行的命令不受影响
+	for conn := range s.conns {
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// handleConn 处理一个客户端连接
+// 支持pipeline，客户端一次发送的多条命令全部处理完之后再一起写回
+// 处理命令时panic只关闭这个连接，不影响其他连接
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("serve %s panic: %v\n%s", conn.RemoteAddr(), r, debug.Stack())
+		}
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := &respWriter{bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			if err == ErrProtocol {
+				writer.writeError(err.Error())
+				_ = writer.Flush()
+			} else if err != io.EOF && !isTimeout(err) {
+				log.Printf("read command from %s failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(string(args[0]))
+		if name == "quit" {
+			writer.writeSimpleString("OK")
+			_ = writer.Flush()
+			return
+		}
+		s.execute(writer, name, args[1:])
+
+		// 缓冲区中没有更多的命令时再写回，减少pipeline场景下的系统调用
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// execute 执行一条命令
+func (s *Server) execute(writer *respWriter, name string, args [][]byte) {
+	cmd, ok := commands[name]
+	if !ok {
+		writer.writeError("ERR unknown command '" + name + "'")
+		return
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		writer.writeError("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+	cmd.handler(s.db, writer, args)
+}
+
+// isTimeout 判断是否是Shutdown设置的读超时
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
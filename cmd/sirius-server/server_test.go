@@ -0,0 +1,300 @@
+package main
+
+import (
+	sirius "Sirius"
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClient 测试使用的RESP客户端
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	return &testClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send 发送一条命令，不等待回复
+func (c *testClient) send(args ...string) error {
+	buf := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		buf += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write([]byte(buf))
+	return err
+}
+
+// receive 读取一条回复，数组回复返回[]interface{}，空值返回nil
+func (c *testClient) receive() (interface{}, error) {
+	line, err := readLine(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return fmt.Errorf("%s", line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		size, _ := strconv.Atoi(string(line[1:]))
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		size, _ := strconv.Atoi(string(line[1:]))
+		items := make([]interface{}, size)
+		for i := range items {
+			if items[i], err = c.receive(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply %q", line)
+}
+
+// do 发送命令并等待回复
+func (c *testClient) do(t *testing.T, args ...string) interface{} {
+	assert.Nil(t, c.send(args...))
+	reply, err := c.receive()
+	assert.Nil(t, err)
+	return reply
+}
+
+// startTestServer 在随机端口上启动服务，测试结束时关闭服务和数据库
+func startTestServer(t *testing.T) (*Server, string) {
+	opts := sirius.DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-server-test")
+	db, err := sirius.Open(opts)
+	assert.Nil(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := NewServer(db)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		assert.Nil(t, server.Shutdown())
+		assert.Equal(t, ErrServerClosed, <-served)
+		assert.Nil(t, db.Close())
+		_ = os.RemoveAll(opts.DirPath)
+	})
+	return server, listener.Addr().String()
+}
+
+func TestServer_Commands(t *testing.T) {
+	_, addr := startTestServer(t)
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+
+	testCases := []struct {
+		name string
+		args []string
+		want interface{}
+	}{
+		{name: "PING", args: []string{"PING"}, want: "PONG"},
+		{name: "PING message", args: []string{"ping", "hello"}, want: "hello"},
+		{name: "GET不存在的key", args: []string{"GET", "a"}, want: nil},
+		{name: "SET", args: []string{"SET", "a", "1"}, want: "OK"},
+		{name: "GET", args: []string{"GET", "a"}, want: "1"},
+		{name: "SET空value", args: []string{"SET", "empty", ""}, want: "OK"},
+		{name: "GET空value", args: []string{"GET", "empty"}, want: ""},
+		{name: "SET EX", args: []string{"SET", "session", "x", "EX", "100"}, want: "OK"},
+		{name: "SET非法的过期时间", args: []string{"SET", "session", "x", "EX", "-1"}, want: fmt.Errorf("ERR invalid expire time in 'set' command")},
+		{name: "MSET", args: []string{"MSET", "b", "2", "c", "3"}, want: "OK"},
+		{name: "MSET参数个数不对", args: []string{"MSET", "b", "2", "c"}, want: fmt.Errorf("ERR wrong number of arguments for 'mset' command")},
+		{name: "MGET", args: []string{"MGET", "a", "b", "d"}, want: []interface{}{"1", "2", nil}},
+		{name: "EXISTS", args: []string{"EXISTS", "a", "b", "d", "a"}, want: int64(3)},
+		{name: "INCR", args: []string{"INCR", "a"}, want: int64(2)},
+		{name: "INCR不存在的key", args: []string{"INCR", "counter"}, want: int64(1)},
+		{name: "INCR非整数", args: []string{"INCR", "session"}, want: fmt.Errorf("ERR value is not an integer or out of range")},
+		{name: "DBSIZE", args: []string{"DBSIZE"}, want: int64(6)},
+		// cursor是下一页第一个key empty的base64编码
+		{name: "SCAN", args: []string{"SCAN", "0", "COUNT", "4"}, want: []interface{}{"ZW1wdHk", []interface{}{"a", "b", "c", "counter"}}},
+		{name: "SCAN下一页", args: []string{"SCAN", "ZW1wdHk", "COUNT", "4"}, want: []interface{}{"0", []interface{}{"empty", "session"}}},
+		{name: "SCAN MATCH", args: []string{"SCAN", "0", "MATCH", "c*", "COUNT", "100"}, want: []interface{}{"0", []interface{}{"c", "counter"}}},
+		{name: "SCAN非法的cursor", args: []string{"SCAN", "!"}, want: fmt.Errorf("ERR invalid cursor")},
+		{name: "DEL", args: []string{"DEL", "a", "b", "d"}, want: int64(2)},
+		{name: "DEL之后GET", args: []string{"GET", "a"}, want: nil},
+		{name: "SET带/的key", args: []string{"SET", "user/1", "x"}, want: "OK"},
+		{name: "SCAN MATCH匹配/", args: []string{"SCAN", "0", "MATCH", "user*", "COUNT", "100"}, want: []interface{}{"0", []interface{}{"user/1"}}},
+		{name: "未知命令", args: []string{"FOO"}, want: fmt.Errorf("ERR unknown command 'foo'")},
+		{name: "参数个数不对", args: []string{"GET"}, want: fmt.Errorf("ERR wrong number of arguments for 'get' command")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, client.do(t, tc.args...))
+		})
+	}
+}
+
+func TestServer_Pipeline(t *testing.T) {
+	_, addr := startTestServer(t)
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+
+	// 一次发送所有的命令，再依次读取回复
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, client.send("SET", fmt.Sprintf("key_%d", i), strconv.Itoa(i)))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, client.send("GET", fmt.Sprintf("key_%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		reply, err := client.receive()
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", reply)
+	}
+	for i := 0; i < 100; i++ {
+		reply, err := client.receive()
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), reply)
+	}
+
+	// inline命令
+	_, err := client.conn.Write([]byte("PING\r\n"))
+	assert.Nil(t, err)
+	reply, err := client.receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", reply)
+}
+
+func TestServer_ConcurrentClients(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	// 多个客户端并发INCR同一个key，结果不能丢失
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := dialTestClient(t, addr)
+			defer client.conn.Close()
+			for j := 0; j < 50; j++ {
+				_, ok := client.do(t, "INCR", "counter").(int64)
+				assert.True(t, ok)
+			}
+		}()
+	}
+	wg.Wait()
+
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	assert.Equal(t, "500", client.do(t, "GET", "counter"))
+	assert.Equal(t, "OK", client.do(t, "QUIT"))
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server, addr := startTestServer(t)
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	assert.Equal(t, "PONG", client.do(t, "PING"))
+
+	// 关闭之后空闲的连接被断开，也不再接受新的连接
+	assert.Nil(t, server.Shutdown())
+	_, err := client.receive()
+	assert.NotNil(t, err)
+	_, err = net.Dial("tcp", addr)
+	assert.NotNil(t, err)
+}
+
+func TestServer_ProtocolError(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{name: "参数数量是负数", input: "*-1\r\n"},
+		{name: "参数长度是负数", input: "*1\r\n$-5\r\n"},
+		{name: "参数数量不是整数", input: "*x\r\n"},
+		{name: "参数不是bulk string", input: "*1\r\n:1\r\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := dialTestClient(t, addr)
+			defer client.conn.Close()
+			_, err := client.conn.Write([]byte(tc.input))
+			assert.Nil(t, err)
+			reply, err := client.receive()
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Errorf("ERR Protocol error"), reply)
+			// 协议错误之后服务端关闭连接
+			_, err = client.receive()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	// 服务端仍然可以处理新的连接
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	assert.Equal(t, "PONG", client.do(t, "PING"))
+}
+
+func TestServer_HandlerPanic(t *testing.T) {
+	_, addr := startTestServer(t)
+	commands["panic"] = &command{minArgs: 0, maxArgs: 0, handler: func(db *sirius.DB, w *respWriter, args [][]byte) {
+		panic("boom")
+	}}
+	defer delete(commands, "panic")
+
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+	assert.Nil(t, client.send("PANIC"))
+	// panic的连接被关闭
+	_, err := client.receive()
+	assert.Equal(t, io.EOF, err)
+
+	other := dialTestClient(t, addr)
+	defer other.conn.Close()
+	assert.Equal(t, "PONG", other.do(t, "PING"))
+}
+
+func TestServer_IncrKeepTTL(t *testing.T) {
+	server, addr := startTestServer(t)
+	client := dialTestClient(t, addr)
+	defer client.conn.Close()
+
+	assert.Equal(t, "OK", client.do(t, "SET", "counter", "1", "EX", "100"))
+	assert.Equal(t, int64(2), client.do(t, "INCR", "counter"))
+	ttl, err := server.db.TTL([]byte("counter"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 99*time.Second && ttl <= 100*time.Second)
+
+	// 没有过期时间的key仍然永不过期
+	assert.Equal(t, int64(1), client.do(t, "INCR", "forever"))
+	ttl, err = server.db.TTL([]byte("forever"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	// 已经过期的key从0开始计数，不会变成永不过期的旧值
+	assert.Nil(t, server.db.PutWithTTL([]byte("expired"), []byte("10"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, int64(1), client.do(t, "INCR", "expired"))
+	ttl, err = server.db.TTL([]byte("expired"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+}
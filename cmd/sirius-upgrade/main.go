@@ -0,0 +1,38 @@
+package main
+
+import (
+	sirius "Sirius"
+	"Sirius/data"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	dirPath := flag.String("dir", "", "database directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sirius-upgrade -dir <path>\n")
+		fmt.Fprintf(os.Stderr, "rewrites data files in older formats to format version %d, the database must not be open\n\n", data.FormatVersion)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *dirPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := sirius.DefaultOptions
+	opts.DirPath = *dirPath
+	upgraded, err := sirius.Upgrade(opts)
+	for _, file := range upgraded {
+		fmt.Printf("upgraded %s from format version %d to %d\n",
+			data.GetDataFileName(*dirPath, file.Fid), file.FromVersion, data.FormatVersion)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upgrade failed: %v\n", err)
+		os.Exit(1)
+	}
+	if len(upgraded) == 0 {
+		fmt.Printf("all data files are already in format version %d\n", data.FormatVersion)
+	}
+}
@@ -0,0 +1,252 @@
+package sirius
+
+import (
+	"Sirius/fio/fiotest"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+// crashDB 模拟进程崩溃，不持久化数据也不写入索引快照，只释放文件描述符和数据目录的文件锁
+func crashDB(db *DB) {
+	db.stopAutoMerge()
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.closed = true
+	_ = db.closeFiles()
+	_ = db.fileLock.Unlock()
+}
+
+// crashModel 记录每个key在重启之后可能的值，空字符串表示key不存在
+type crashModel struct {
+	possible map[string]map[string]bool
+	current  map[string]string // 数据库当前看到的值
+}
+
+// apply 写入成功之后更新模型，synced表示这次写入已经持久化
+func (m *crashModel) apply(key, value string, synced bool) {
+	if m.possible[key] == nil {
+		m.possible[key] = map[string]bool{"": true}
+	}
+	if synced {
+		m.possible[key] = map[string]bool{value: true}
+	} else {
+		m.possible[key][value] = true
+	}
+	m.current[key] = value
+}
+
+// sync 所有写入都已经持久化
+func (m *crashModel) sync() {
+	for key, value := range m.current {
+		m.possible[key] = map[string]bool{value: true}
+	}
+}
+
+// crashSeed 随机测试使用的种子，默认固定方便复现，可以通过go test -run TestDB_CrashConsistency -args -crash.seed=N修改
+var crashSeed = flag.Int64("crash.seed", 1, "seed of TestDB_CrashConsistency")
+
+// crashChange 一次写入对一个key的修改，value为空表示删除
+type crashChange struct {
+	key   string
+	value string
+}
+
+// maybe 操作进行到一半时断电，修改可能生效也可能没有生效
+func (m *crashModel) maybe(key, value string) {
+	if m.possible[key] == nil {
+		m.possible[key] = map[string]bool{"": true}
+	}
+	m.possible[key][value] = true
+}
+
+// crashOp 测试中随机执行的操作，run返回操作修改的key以及修改是否已经持久化
+type crashOp struct {
+	name   string
+	weight int // 被选中的权重
+	maxIOs int // 在操作的前maxIOs次Write或者Sync中随机选择一次断电，merge需要重写所有的有效数据，IO次数比较多
+	run    func(t *testing.T, db *DB, rnd *rand.Rand, round, i int) ([]crashChange, bool, error)
+	// syncAll 操作成功之后之前所有的写入都已经持久化
+	syncAll bool
+	// reopen 操作会关闭数据库，之后需要重新打开
+	reopen bool
+}
+
+var crashOps = []crashOp{
+	{
+		name: "put", weight: 12, maxIOs: 3,
+		run: func(t *testing.T, db *DB, rnd *rand.Rand, round, i int) ([]crashChange, bool, error) {
+			change := crashChange{key: fmt.Sprintf("key_%d", rnd.Intn(50)), value: fmt.Sprintf("value_%d_%d", round, i)}
+			return []crashChange{change}, db.options.SyncWrites, db.Put([]byte(change.key), []byte(change.value))
+		},
+	},
+	{
+		name: "delete", weight: 4, maxIOs: 3,
+		run: func(t *testing.T, db *DB, rnd *rand.Rand, round, i int) ([]crashChange, bool, error) {
+			change := crashChange{key: fmt.Sprintf("key_%d", rnd.Intn(50))}
+			return []crashChange{change}, db.options.SyncWrites, db.Delete([]byte(change.key))
+		},
+	},
+	{
+		name: "write batch", weight: 3, maxIOs: 16,
+		run: func(t *testing.T, db *DB, rnd *rand.Rand, round, i int) ([]crashChange, bool, error) {
+			wbOptions := DefaultWriteBatchOptions
+			wbOptions.SyncWrites = rnd.Intn(2) == 0
+			wb := db.NewWriteBatch(wbOptions)
+			var changes []crashChange
+			for j := rnd.Intn(5); j >= 0; j-- {
+				change := crashChange{key: fmt.Sprintf("key_%d", rnd.Intn(50))}
+				var err error
+				if rnd.Intn(4) == 0 {
+					err = wb.Delete([]byte(change.key))
+				} else {
+					change.value = fmt.Sprintf("value_%d_%d_%d", round, i, j)
+					err = wb.Put([]byte(change.key), []byte(change.value))
+				}
+				if err != nil {
+					t.Fatalf("stage write batch failed: %v", err)
+				}
+				changes = append(changes, change)
+			}
+			return changes, wbOptions.SyncWrites || db.options.SyncWrites, wb.Commit()
+		},
+	},
+	{
+		name: "merge", weight: 1, maxIOs: 64, syncAll: true,
+		run: func(t *testing.T, db *DB, rnd *rand.Rand, round, i int) ([]crashChange, bool, error) {
+			return nil, true, db.Merge()
+		},
+	},
+	{
+		// 关闭时写入索引快照，重新打开时加载索引快照以及merge的结果
+		name: "close", weight: 1, maxIOs: 4, syncAll: true, reopen: true,
+		run: func(t *testing.T, db *DB, rnd *rand.Rand, round, i int) ([]crashChange, bool, error) {
+			return nil, true, db.Close()
+		},
+	},
+}
+
+func TestDB_CrashConsistency(t *testing.T) {
+	seed := *crashSeed
+	rnd := rand.New(rand.NewSource(seed))
+	fs := fiotest.NewFaultFS(seed)
+
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-crash")
+	opts.DataFileSize = 4 * 1024
+	// 自动merge的时机不确定，测试中显式调用Merge
+	opts.MergeRatio = 0
+	opts.IOManagerFactory = fs.NewIOManager
+	defer os.RemoveAll(opts.DirPath)
+	_ = os.RemoveAll(opts.DirPath)
+
+	var totalWeight int
+	for _, op := range crashOps {
+		totalWeight += op.weight
+	}
+	pickOp := func() crashOp {
+		n := rnd.Intn(totalWeight)
+		for _, op := range crashOps {
+			if n < op.weight {
+				return op
+			}
+			n -= op.weight
+		}
+		return crashOps[len(crashOps)-1]
+	}
+
+	model := &crashModel{possible: make(map[string]map[string]bool), current: make(map[string]string)}
+	// 上一轮断电时正在执行的操作，用于排查问题
+	cutOp := "none"
+	for round := 0; round < 30; round++ {
+		opts.SyncWrites = rnd.Intn(2) == 0
+		db, err := Open(opts)
+		if err != nil {
+			t.Fatalf("round %d: open after power cut during %s failed: %v (seed %d)", round, cutOp, err, seed)
+		}
+
+		// 重启之后校验数据，已经持久化的写入不能丢失，写入失败的数据也不能出现
+		keys := make([]string, 0, len(model.possible))
+		for key := range model.possible {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, err := db.Get([]byte(key))
+			if err != nil && err != ErrKeyNotFound {
+				t.Fatalf("round %d: get %s failed: %v (seed %d)", round, key, err, seed)
+			}
+			if !model.possible[key][string(value)] {
+				t.Fatalf("round %d: after power cut during %s, %s = %q, want one of %v (seed %d)",
+					round, cutOp, key, value, model.possible[key], seed)
+			}
+			model.possible[key] = map[string]bool{string(value): true}
+			model.current[key] = string(value)
+		}
+
+		// 在某一个操作进行到一半时断电，cutAt等于ops时在所有操作结束之后断电
+		ops := rnd.Intn(200)
+		cutAt := rnd.Intn(ops + 1)
+		cutOp = "none"
+		for i := 0; i < ops; i++ {
+			op := pickOp()
+			if i == cutAt {
+				cutOp = op.name
+				fs.PowerCutAfter(rnd.Intn(op.maxIOs))
+			} else if opts.SyncWrites && rnd.Intn(10) == 0 {
+				// 每次写入都持久化时随机注入写入失败、磁盘空间不足以及持久化失败
+				switch rnd.Intn(3) {
+				case 0:
+					fs.FailWrite(0, -1, io.ErrShortWrite)
+				case 1:
+					fs.FailWrite(0, -1, syscall.ENOSPC)
+				case 2:
+					fs.FailSync(0, syscall.EIO)
+				}
+			}
+
+			// 注入的故障导致写入失败时数据库的状态不变，断电导致失败时操作的结果不确定
+			changes, synced, err := op.run(t, db, rnd, round, i)
+			if err == nil {
+				for _, change := range changes {
+					model.apply(change.key, change.value, synced)
+				}
+				if op.syncAll {
+					model.sync()
+				}
+			} else if i == cutAt {
+				for _, change := range changes {
+					model.maybe(change.key, change.value)
+				}
+			}
+			// 操作的IO次数比较少时不会在中途断电，操作结束之后断电
+			if i == cutAt {
+				break
+			}
+			// 关闭失败时数据库也已经关闭了
+			if op.reopen {
+				if db, err = Open(opts); err != nil {
+					t.Fatalf("round %d: reopen failed: %v (seed %d)", round, err, seed)
+				}
+			}
+
+			if !opts.SyncWrites && rnd.Intn(20) == 0 {
+				if err := db.Sync(); err != nil {
+					t.Fatalf("round %d: sync failed: %v (seed %d)", round, err, seed)
+				}
+				model.sync()
+			}
+		}
+
+		if err := fs.PowerCut(); err != nil {
+			t.Fatalf("round %d: power cut failed: %v (seed %d)", round, err, seed)
+		}
+		crashDB(db)
+	}
+}
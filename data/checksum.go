@@ -0,0 +1,24 @@
+package data
+
+import "hash/crc32"
+
+// Checksum 记录的crc校验算法，每个数据文件使用的算法记录在文件头中
+type Checksum = uint8
+
+const (
+	// ChecksumCRC32C Castagnoli多项式，支持SSE4.2或者ARMv8 CRC指令的CPU上有硬件加速，是新数据文件默认使用的算法
+	ChecksumCRC32C Checksum = iota
+
+	// ChecksumIEEE IEEE多项式，版本0的数据文件以及没有记录算法的数据文件使用这个算法
+	ChecksumIEEE
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumTable 返回校验算法对应的crc表，crc32包会根据表选择硬件加速的实现
+func checksumTable(checksum Checksum) *crc32.Table {
+	if checksum == ChecksumCRC32C {
+		return castagnoliTable
+	}
+	return crc32.IEEETable
+}
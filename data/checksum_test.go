@@ -0,0 +1,74 @@
+package data
+
+import (
+	"Sirius/fio"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestDataFile_Checksum(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 写入时配置的校验算法
+		writeChecksum Checksum
+		// 重新打开时配置的校验算法，已经存在的数据文件应该使用文件头中记录的算法
+		readChecksum Checksum
+		// 读取之前修改记录中的数据
+		corrupt bool
+
+		wantErr error
+	}{
+		{
+			name:          "CRC32C",
+			writeChecksum: ChecksumCRC32C,
+			readChecksum:  ChecksumCRC32C,
+		},
+		{
+			name:          "IEEE",
+			writeChecksum: ChecksumIEEE,
+			readChecksum:  ChecksumIEEE,
+		},
+		{
+			name:          "修改配置之后仍然使用文件头中的算法",
+			writeChecksum: ChecksumIEEE,
+			readChecksum:  ChecksumCRC32C,
+		},
+		{
+			name:          "CRC32C校验失败",
+			writeChecksum: ChecksumCRC32C,
+			readChecksum:  ChecksumCRC32C,
+			corrupt:       true,
+			wantErr:       ErrInvalidCRC,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirPath := t.TempDir()
+			dataFile, err := OpenDataFileWithOptions(dirPath, 0, fio.StandardFIO, DataFileOptions{Checksum: tc.writeChecksum})
+			assert.Nil(t, err)
+			encRecord, size := dataFile.EncodeLogRecord(&LogRecord{Key: []byte("name"), Value: []byte("zhangsan")})
+			assert.Nil(t, dataFile.Write(encRecord))
+			assert.Nil(t, dataFile.Close())
+			if tc.corrupt {
+				fileName := GetDataFileName(dirPath, 0)
+				content, err := os.ReadFile(fileName)
+				assert.Nil(t, err)
+				content[len(content)-1] ^= 0xff
+				assert.Nil(t, os.WriteFile(fileName, content, 0644))
+			}
+
+			dataFile, err = OpenDataFileWithOptions(dirPath, 0, fio.MemoryMap, DataFileOptions{Checksum: tc.readChecksum})
+			assert.Nil(t, err)
+			defer dataFile.Close()
+			assert.Equal(t, tc.writeChecksum, dataFile.Header().Checksum)
+			record, readSize, err := dataFile.ReadLogRecord(0)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, size, readSize)
+			if err == nil {
+				assert.Equal(t, []byte("zhangsan"), record.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Codec value的压缩算法，编码在Type字段的第5、6位，没有压缩的记录和原来的格式完全一致
+type Codec = uint8
+
+const (
+	// CodecNone 不压缩
+	CodecNone Codec = iota
+
+	// CodecFlate 使用deflate压缩，压缩率高
+	CodecFlate
+
+	// CodecLZ 简单的LZ77压缩，压缩率不如deflate，但是速度快很多
+	CodecLZ
+)
+
+const (
+	logRecordCodecShift = 5
+	logRecordCodecMask  = 0x3 << logRecordCodecShift
+)
+
+// compressValue 使用codec压缩value
+func compressValue(codec Codec, value []byte) []byte {
+	switch codec {
+	case CodecFlate:
+		var buf bytes.Buffer
+		writer, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		_, _ = writer.Write(value)
+		_ = writer.Close()
+		return buf.Bytes()
+	case CodecLZ:
+		return lzCompress(value)
+	default:
+		return value
+	}
+}
+
+// decompressValue 使用codec解压value
+func decompressValue(codec Codec, value []byte) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return value, nil
+	case CodecFlate:
+		reader := flate.NewReader(bytes.NewReader(value))
+		defer reader.Close()
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, ErrDecompressFailed
+		}
+		return decompressed, nil
+	case CodecLZ:
+		return lzDecompress(value)
+	default:
+		return nil, ErrDecompressFailed
+	}
+}
+
+const (
+	// lzMinMatch 最短的重复数据长度，更短的重复数据直接作为字面量写入
+	lzMinMatch = 4
+	// lzHashBits 查找重复数据的哈希表大小
+	lzHashBits = 14
+)
+
+// lzCompress LZ77压缩，格式为解压后的长度(uvarint)，然后是若干个字面量或者拷贝
+// 每一项的第一个字节最低位为0表示字面量，为1表示拷贝，其余7位是长度，长度不小于128时这7位为0，长度以uvarint写在后面
+// 字面量之后是原始数据，拷贝之后是距离当前位置的偏移(uvarint)
+func lzCompress(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+
+	// table中记录每个4字节序列最后一次出现的位置+1，0表示没有出现过
+	var table [1 << lzHashBits]int32
+	var literalStart = 0
+	for i := 0; i+lzMinMatch <= len(src); {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 0x1e35a7bd) >> (32 - lzHashBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != seq {
+			i++
+			continue
+		}
+
+		length := lzMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = appendLZItem(dst, 0, src[literalStart:i], len(src[literalStart:i]))
+		dst = appendLZItem(dst, 1, nil, length)
+		dst = binary.AppendUvarint(dst, uint64(i-candidate))
+		i += length
+		literalStart = i
+	}
+	return appendLZItem(dst, 0, src[literalStart:], len(src[literalStart:]))
+}
+
+// appendLZItem 写入一个字面量或者拷贝，长度为0的字面量不需要写入
+func appendLZItem(dst []byte, typ byte, literal []byte, length int) []byte {
+	if length == 0 {
+		return dst
+	}
+	if length < 128 {
+		dst = append(dst, byte(length<<1)|typ)
+	} else {
+		dst = append(dst, typ)
+		dst = binary.AppendUvarint(dst, uint64(length))
+	}
+	return append(dst, literal...)
+}
+
+// lzDecompress 解压lzCompress压缩的数据
+func lzDecompress(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > math.MaxUint32 {
+		return nil, ErrDecompressFailed
+	}
+	dst := make([]byte, 0, size)
+	for i := n; i < len(src); {
+		tag := src[i]
+		i++
+		length := int(tag >> 1)
+		if length == 0 {
+			l, n := binary.Uvarint(src[i:])
+			if n <= 0 || l > size {
+				return nil, ErrDecompressFailed
+			}
+			length = int(l)
+			i += n
+		}
+		if uint64(len(dst)+length) > size {
+			return nil, ErrDecompressFailed
+		}
+
+		if tag&1 == 0 {
+			if i+length > len(src) {
+				return nil, ErrDecompressFailed
+			}
+			dst = append(dst, src[i:i+length]...)
+			i += length
+			continue
+		}
+
+		offset, n := binary.Uvarint(src[i:])
+		if n <= 0 || offset == 0 || offset > uint64(len(dst)) {
+			return nil, ErrDecompressFailed
+		}
+		i += n
+		// 拷贝的数据可能和正在写入的数据重叠，需要逐字节拷贝
+		start := len(dst) - int(offset)
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, ErrDecompressFailed
+	}
+	return dst, nil
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestCompressValue(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	values := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "空value", value: []byte{}},
+		{name: "短value", value: []byte("abc")},
+		{name: "重复数据", value: bytes.Repeat([]byte("a"), 1000)},
+		{name: "json", value: []byte(strings.Repeat(`{"id":1,"name":"zhangsan","tags":["a","b"]},`, 100))},
+		{name: "随机数据", value: random},
+	}
+
+	for _, codec := range []Codec{CodecNone, CodecFlate, CodecLZ} {
+		for _, v := range values {
+			t.Run(v.name, func(t *testing.T) {
+				compressed := compressValue(codec, v.value)
+				value, err := decompressValue(codec, compressed)
+				assert.Nil(t, err)
+				assert.Equal(t, len(v.value), len(value))
+				assert.True(t, bytes.Equal(v.value, value))
+			})
+		}
+	}
+}
+
+func TestDecompressValue_Corrupted(t *testing.T) {
+	value := []byte(strings.Repeat("hello world,", 20))
+	testCases := []struct {
+		name  string
+		codec Codec
+		data  []byte
+	}{
+		{name: "lz长度不一致", codec: CodecLZ, data: append([]byte{200, 1}, lzCompress(value)[2:]...)},
+		{name: "lz数据被截断", codec: CodecLZ, data: lzCompress(value)[:10]},
+		{name: "lz拷贝偏移超出范围", codec: CodecLZ, data: []byte{8, 3, 100}},
+		{name: "flate数据被截断", codec: CodecFlate, data: compressValue(CodecFlate, value)[:5]},
+		{name: "未知的压缩算法", codec: CodecLZ + 1, data: value},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decompressValue(tc.codec, tc.data)
+			assert.Equal(t, ErrDecompressFailed, err)
+		})
+	}
+}
+
+func TestEncodeLogRecord_Compression(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     []byte
+		codec     Codec
+		wantCodec Codec
+	}{
+		{name: "flate压缩", value: bytes.Repeat([]byte("zhangsan"), 100), codec: CodecFlate, wantCodec: CodecFlate},
+		{name: "lz压缩", value: bytes.Repeat([]byte("zhangsan"), 100), codec: CodecLZ, wantCodec: CodecLZ},
+		{name: "压缩之后没有变小时原样写入", value: []byte("zhangsan"), codec: CodecLZ, wantCodec: CodecNone},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			record := &LogRecord{Key: []byte("name"), Value: tc.value, Codec: tc.codec}
+			encBytes, size := EncodeLogRecord(record)
+			assert.Equal(t, tc.wantCodec, record.Codec)
+
+			header, headerSize := decodeLogRecordHeader(encBytes)
+			assert.NotNil(t, header)
+			assert.Equal(t, LogRecordNormal, header.recordType)
+			assert.Equal(t, tc.wantCodec, header.codec)
+			assert.Equal(t, size, headerSize+int64(header.keySize)+int64(header.valueSize))
+			if tc.wantCodec != CodecNone {
+				assert.Less(t, int(header.valueSize), len(tc.value))
+			}
+		})
+	}
+}
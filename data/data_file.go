@@ -10,45 +10,174 @@ import (
 )
 
 var (
-	ErrInvalidCRC = errors.New("invalid crc value,log record maybe corrupted")
+	ErrInvalidCRC       = errors.New("invalid crc value,log record maybe corrupted")
+	ErrDecompressFailed = errors.New("decompress value failed, log record maybe corrupted")
 )
 
-const DataFileNameSuffix = ".data"
+const (
+	DataFileNameSuffix    = ".data"
+	UpgradeTmpFileSuffix  = ".upgrade" // 升级数据文件格式时写入的临时文件的后缀
+	MergeFinishedFileName = "merge-finished"
+	HintFileName          = "hint-index"
+)
 
 // DataFile 磁盘中的数据文件
 type DataFile struct {
 	FileId    uint32
 	WriteOff  int64         // 写入偏移,就是文件写到了哪个位置
 	IoManager fio.IOManager //io 读写操作
+
+	newIOManager fio.IOManagerFactory // 切换IO类型时用来创建新的IOManager
+
+	header        *FileHeader   // 文件头，版本0的数据文件没有文件头
+	cipher        *recordCipher // 加密记录的key和value，为nil时不加密
+	headerPending bool          // 文件头还没有写入，会在第一次写入时一起写入
+}
+
+// DataFileOptions 打开数据文件的配置项
+type DataFileOptions struct {
+	// 创建IOManager的方法，为nil时使用fio.NewIOManager
+	NewIOManager fio.IOManagerFactory
+
+	// 加密使用的密钥，为nil时不加密，但是仍然不能打开加密的数据文件
+	KeyProvider KeyProvider
+
+	// 写入新文件头的配置项指纹
+	Fingerprint uint64
+
+	// 新数据文件使用的crc校验算法，已经存在的数据文件使用文件头中记录的算法
+	Checksum Checksum
 }
 
 // OpenDataFile 根据路径和文件id打开数据文件，如果文件不存在则创建
 // 根据对应的文件id，路径拼上数据文件的后缀.data，构造出完整的数据文件路径
 // 然后调用IOManager的创建方法打开文件，拿到IOManager的实例
-func OpenDataFile(dirPath string, fileId uint32) (*DataFile, error) {
-	// 1. 构造数据文件名
-	// 这里的09d代表9位数字，不足9位的前面补0，例如1->000000001，之所以是9位数字，是因为我们的文件id是uint32类型，最大值为4294967295，刚好是9位数字
-	fileName := filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileNameSuffix)
+func OpenDataFile(dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+	return OpenDataFileWithOptions(dirPath, fileId, ioType, DataFileOptions{})
+}
+
+// OpenDataFileWithOptions 和OpenDataFile一样，但是可以指定创建IOManager的方法以及加密使用的密钥
+func OpenDataFileWithOptions(dirPath string, fileId uint32, ioType fio.FileIOType, options DataFileOptions) (*DataFile, error) {
+	fileName := GetDataFileName(dirPath, fileId)
+	return newDataFile(fileName, fileId, ioType, options)
+}
+
+// OpenMergeFinishedFile 打开标识merge完成的文件
+func OpenMergeFinishedFile(dirPath string) (*DataFile, error) {
+	fileName := filepath.Join(dirPath, MergeFinishedFileName)
+	return newDataFile(fileName, 0, fio.StandardFIO, DataFileOptions{})
+}
+
+// OpenHintFile 打开索引快照文件，索引快照中保存了所有的key，开启加密时和数据文件一样加密
+func OpenHintFile(fileName string, keyProvider KeyProvider) (*DataFile, error) {
+	return newDataFile(fileName, 0, fio.StandardFIO, DataFileOptions{KeyProvider: keyProvider})
+}
+
+// WriteHintRecord 写入一条索引记录，key是真实的key，value是数据在文件中的位置
+func (f *DataFile) WriteHintRecord(key []byte, pos *LogRecordPos) error {
+	return f.WriteHintRecordRaw(key, EncodeLogRecordPos(pos))
+}
+
+// WriteHintRecordRaw 写入一条key和value都由调用方编码的记录，用于写入索引快照的元数据
+func (f *DataFile) WriteHintRecordRaw(key []byte, value []byte) error {
+	record := &LogRecord{
+		Key:   key,
+		Value: value,
+	}
+	encRecord, _ := f.EncodeLogRecord(record)
+	return f.Write(encRecord)
+}
+
+// EncodeLogRecord 编码写入这个数据文件的LogRecord，使用数据文件的crc校验算法，数据文件开启了加密时加密key和value
+func (f *DataFile) EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
+	return encodeLogRecord(logRecord, f.cipher, f.crcTable())
+}
+
+// KeyID 返回加密这个数据文件使用的密钥id，没有加密时返回false
+func (f *DataFile) KeyID() (uint32, bool) {
+	if f.cipher == nil {
+		return 0, false
+	}
+	return f.cipher.keyID, true
+}
+
+// Header 返回数据文件头，版本0的数据文件返回的Version为0
+func (f *DataFile) Header() FileHeader {
+	return *f.header
+}
+
+// GetDataFileName 构造数据文件名
+// 这里的09d代表9位数字，不足9位的前面补0，例如1->000000001，之所以是9位数字，是因为我们的文件id是uint32类型，最大值为4294967295，刚好是9位数字
+func GetDataFileName(dirPath string, fileId uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileNameSuffix)
+}
 
-	// 2. 创建IOManager
-	ioManager, err := fio.NewIOManager(fileName)
+func newDataFile(fileName string, fileId uint32, ioType fio.FileIOType, options DataFileOptions) (*DataFile, error) {
+	newIOManager := options.NewIOManager
+	if newIOManager == nil {
+		newIOManager = fio.NewIOManager
+	}
+
+	// 1. 创建IOManager
+	ioManager, err := newIOManager(fileName, ioType)
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. 获取文件大小，设置初始写入偏移量
-	fileSize, err := ioManager.Size()
+	// 2. 读取文件头，校验格式版本以及加密的密钥
+	header, cipher, headerPending, err := openFileHeader(ioManager, options)
 	if err != nil {
+		_ = ioManager.Close()
 		return nil, err
 	}
 
-	// 4. 返回DataFile实例
-	return &DataFile{
-		FileId:    fileId,
-		WriteOff:  fileSize,
-		IoManager: ioManager,
-	}, nil
+	// 3. 创建DataFile实例，设置初始写入偏移量
+	dataFile := &DataFile{
+		FileId:        fileId,
+		IoManager:     ioManager,
+		newIOManager:  newIOManager,
+		header:        header,
+		cipher:        cipher,
+		headerPending: headerPending,
+	}
+	if dataFile.WriteOff, err = dataFile.size(); err != nil {
+		_ = ioManager.Close()
+		return nil, err
+	}
+	return dataFile, nil
+}
+
+// headerSize 数据文件头的长度，记录的偏移都不包括文件头，第一条记录的偏移是0
+func (f *DataFile) headerSize() int64 {
+	if f.header.Version == 0 {
+		return 0
+	}
+	return FileHeaderSize
+}
+
+// crcTable 数据文件中记录使用的crc表
+func (f *DataFile) crcTable() *crc32.Table {
+	return checksumTable(f.header.Checksum)
+}
+
+// size 数据文件中记录部分的长度
+func (f *DataFile) size() (int64, error) {
+	if f.headerPending {
+		return 0, nil
+	}
+	fileSize, err := f.IoManager.Size()
+	if err != nil {
+		return 0, err
+	}
+	return fileSize - f.headerSize(), nil
+}
 
+// fileOffset 将记录的偏移转换成文件中的偏移
+func (f *DataFile) fileOffset(offset int64) int64 {
+	if f.headerPending {
+		return offset
+	}
+	return offset + f.headerSize()
 }
 
 // Sync 将数据文件持久化到磁盘
@@ -57,12 +186,38 @@ func (f *DataFile) Sync() error {
 }
 
 // Write 写入数据到文件,需要更新我们维护的writeoff字段，表示当前写到了哪个位置，内存索引中需要保存这个信息，方便后续读取
+// 写入失败时已经写入的部分数据会被截断，避免后续写入的数据追加在半条记录之后，和WriteOff对不上
+// 文件头和第一次写入的数据一起写入，写入失败时一起截断
 func (f *DataFile) Write(data []byte) error {
+	var headerSize = 0
+	if f.headerPending {
+		// 清除上一次写入文件头时崩溃留下的数据
+		if err := f.IoManager.Truncate(0); err != nil {
+			return err
+		}
+		header := encodeFileHeader(f.header, f.cipher)
+		headerSize = len(header)
+		data = append(header, data...)
+	}
+
 	writeSize, err := f.IoManager.Write(data)
+	if err == nil && writeSize < len(data) {
+		err = io.ErrShortWrite
+	}
 	if err != nil {
+		if writeSize > 0 {
+			// 截断失败时只能保留写入的数据，WriteOff仍然要和文件的实际长度一致
+			// 文件头没有写完时下一次写入会重新写入文件头
+			truncateErr := f.IoManager.Truncate(f.fileOffset(f.WriteOff))
+			if truncateErr != nil && writeSize >= headerSize {
+				f.headerPending = false
+				f.WriteOff += int64(writeSize - headerSize)
+			}
+		}
 		return err
 	}
-	f.WriteOff += int64(writeSize)
+	f.headerPending = false
+	f.WriteOff += int64(writeSize - headerSize)
 	return nil
 }
 
@@ -81,8 +236,8 @@ func (f *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	// 但有时候key可能很小，例如长度为5，只需要一个字节就够了
 	// 读的时候，需要判断读取的偏移offset加上logRecord的最大头部字节数，是否超过了文件的大小，如果超过了，说明读到文件末尾了，这个case需要特殊处理
 
-	// 0. 读取文件大小
-	fileSize, err := f.IoManager.Size()
+	// 0. 读取文件大小，不包括文件头
+	fileSize, err := f.size()
 	if err != nil {
 		return nil, 0, err
 	}
@@ -106,34 +261,86 @@ func (f *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
 		return nil, 0, io.EOF
 	}
-	// 4. 读取key和value
+	// 4. 读取key和value，加密的记录中还有nonce和认证标签
 	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
-	var recordSize = headerSize + keySize + valueSize
+	var bodySize = keySize + valueSize
+	if f.cipher != nil {
+		bodySize += int64(f.cipher.overhead())
+	}
+	var recordSize = headerSize + bodySize
+	// 记录超出了文件末尾，说明是写了一半的记录或者header已经损坏
+	if offset+recordSize > fileSize {
+		return nil, 0, io.EOF
+	}
 
-	logRecord := &LogRecord{Type: header.recordType}
+	logRecord := &LogRecord{Type: header.recordType, Expire: header.expire, Codec: header.codec, SeqNo: header.seqNo}
 	// 5. 开始读取key和value
-	if keySize > 0 || valueSize > 0 {
+	if bodySize > 0 {
 		// 读取key和value,从offset+headerSize开始读取，读取keySize+valueSize个字节
-		kvBuf, err := f.readNBytes(keySize+valueSize, offset+headerSize)
+		kvBuf, err := f.readNBytes(bodySize, offset+headerSize)
 		if err != nil {
 			return nil, 0, err
 		}
 
+		// 加密的记录先校验磁盘上的数据，再解密，头部信息也参与认证
+		if f.cipher != nil {
+			crcTable := f.crcTable()
+			crc := crc32.Update(crc32.Checksum(haderBuf[crc32.Size:headerSize], crcTable), crcTable, kvBuf)
+			if crc != header.crc {
+				return logRecord, recordSize, ErrInvalidCRC
+			}
+			if kvBuf, err = f.cipher.open(kvBuf, haderBuf[crc32.Size:headerSize]); err != nil {
+				return nil, 0, err
+			}
+		}
+
 		logRecord.Key = kvBuf[:keySize]
 		logRecord.Value = kvBuf[keySize:]
 	}
 
-	// 校验数据的有效性,这里截取了crc32.Size个字节，因为crc32.Size是4字节，crc32.ChecksumIEEE返回的是uint32类型
-	crc := getLogRecordCRC(logRecord, haderBuf[crc32.Size:headerSize])
-	if crc != header.crc {
-		return nil, 0, ErrInvalidCRC
+	// 校验数据的有效性,这里截取了crc32.Size个字节，因为crc32.Size是4字节，crc校验值是uint32类型
+	// 校验失败时仍然返回读到的记录和长度，方便排查问题的工具跳过这条记录继续读取
+	if f.cipher == nil {
+		crc := getLogRecordCRC(logRecord, haderBuf[crc32.Size:headerSize], f.crcTable())
+		if crc != header.crc {
+			return logRecord, recordSize, ErrInvalidCRC
+		}
+	}
+
+	// 6. crc校验的是磁盘上压缩后的数据，校验通过之后再解压value
+	if logRecord.Codec != CodecNone {
+		if logRecord.Value, err = decompressValue(logRecord.Codec, logRecord.Value); err != nil {
+			return nil, 0, err
+		}
 	}
 
-	// 6. 返回LogRecord
+	// 7. 返回LogRecord
 	return logRecord, recordSize, nil
 
 }
 
+// SetIOManager 切换数据文件的IO类型，例如启动时使用MMap加载，加载完成之后切换回标准文件IO
+func (f *DataFile) SetIOManager(dirPath string, ioType fio.FileIOType) error {
+	if err := f.IoManager.Close(); err != nil {
+		return err
+	}
+	ioManager, err := f.newIOManager(GetDataFileName(dirPath, f.FileId), ioType)
+	if err != nil {
+		return err
+	}
+	f.IoManager = ioManager
+	return nil
+}
+
+// Truncate 将数据文件截断到指定长度，用于丢弃文件末尾损坏的数据
+func (f *DataFile) Truncate(size int64) error {
+	if err := f.IoManager.Truncate(f.fileOffset(size)); err != nil {
+		return err
+	}
+	f.WriteOff = size
+	return f.IoManager.Sync()
+}
+
 func (f *DataFile) Close() error {
 	return f.IoManager.Close()
 }
@@ -141,6 +348,6 @@ func (f *DataFile) Close() error {
 // readNBytes 从文件中读取n个字节
 func (f *DataFile) readNBytes(n int64, offset int64) ([]byte, error) {
 	bytes := make([]byte, n)
-	_, err := f.IoManager.Read(bytes, offset)
+	_, err := f.IoManager.Read(bytes, f.fileOffset(offset))
 	return bytes, err
 }
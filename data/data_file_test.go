@@ -1,10 +1,14 @@
 package data
 
 import (
+	"Sirius/fio"
+	"Sirius/fio/fiotest"
+	"bytes"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 )
 
@@ -64,7 +68,7 @@ func TestOpenDataFile(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			file, err := OpenDataFile(tc.dirPath, tc.fileId)
+			file, err := OpenDataFile(tc.dirPath, tc.fileId, fio.StandardFIO)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantFileId, file.FileId)
 			assert.Equal(t, tc.wantWriteOff, file.WriteOff)
@@ -133,7 +137,7 @@ func TestDataFile_Write(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			file, err := OpenDataFile(tc.dirPath, tc.fileId)
+			file, err := OpenDataFile(tc.dirPath, tc.fileId, fio.StandardFIO)
 			assert.Nil(t, err)
 			err = file.Write(tc.data)
 			assert.Equal(t, tc.wantErr, err)
@@ -196,7 +200,7 @@ func TestDataFile_Close(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			file, err := OpenDataFile(tc.dirPath, tc.fileId)
+			file, err := OpenDataFile(tc.dirPath, tc.fileId, fio.StandardFIO)
 			assert.Nil(t, err)
 			err = file.Close()
 			assert.Equal(t, tc.wantErr, err)
@@ -245,7 +249,7 @@ func TestDataFile_Sync(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			file, err := OpenDataFile(tc.dirPath, tc.fileId)
+			file, err := OpenDataFile(tc.dirPath, tc.fileId, fio.StandardFIO)
 			assert.Nil(t, err)
 			err = file.Sync()
 			assert.Equal(t, tc.wantErr, err)
@@ -390,12 +394,86 @@ func TestDataFile_ReadLogRecord(t *testing.T) {
 			wantErr:  nil,
 			wantSize: 4 + 1 + 1 + 1 + 5 + 5,
 		},
+		{
+			name: "crc校验失败",
+
+			before: func(t *testing.T) {
+				// 创建文件
+				fileName := filepath.Join(os.TempDir(), fmt.Sprintf("%09d", 0)+DataFileNameSuffix)
+				fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+				assert.Nil(t, err)
+				// 构造logRecord，修改value的最后一个字节
+				record := &LogRecord{
+					Key:   []byte("hello"),
+					Value: []byte("world"),
+					Type:  LogRecordNormal,
+				}
+				encodeLogRecord, _ := EncodeLogRecord(record)
+				encodeLogRecord[len(encodeLogRecord)-1] = 'x'
+				// 写入数据
+				_, err = fd.Write(encodeLogRecord)
+				assert.Nil(t, err)
+				err = fd.Close()
+				assert.Nil(t, err)
+			},
+			after: func(t *testing.T) {
+				// 删除测试文件
+				err := os.Remove(filepath.Join(os.TempDir(), fmt.Sprintf("%09d", 0)+DataFileNameSuffix))
+				assert.Nil(t, err)
+			},
+			offset: 0,
+			// 校验失败时仍然返回记录和长度
+			wantRecord: &LogRecord{
+				Key:   []byte("hello"),
+				Value: []byte("worlx"),
+				Type:  LogRecordNormal,
+			},
+			wantErr:  ErrInvalidCRC,
+			wantSize: 17,
+		},
+		{
+			name: "读取压缩的记录",
+
+			before: func(t *testing.T) {
+				// 创建文件
+				fileName := filepath.Join(os.TempDir(), fmt.Sprintf("%09d", 0)+DataFileNameSuffix)
+				fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+				assert.Nil(t, err)
+				// 100字节的value压缩之后只有9字节
+				record := &LogRecord{
+					Key:   []byte("hello"),
+					Value: bytes.Repeat([]byte("world"), 20),
+					Type:  LogRecordNormal,
+					Codec: CodecLZ,
+				}
+				encodeLogRecord, _ := EncodeLogRecord(record)
+				// 写入数据
+				_, err = fd.Write(encodeLogRecord)
+				assert.Nil(t, err)
+				err = fd.Close()
+				assert.Nil(t, err)
+			},
+			after: func(t *testing.T) {
+				// 删除测试文件
+				err := os.Remove(filepath.Join(os.TempDir(), fmt.Sprintf("%09d", 0)+DataFileNameSuffix))
+				assert.Nil(t, err)
+			},
+			offset: 0,
+			wantRecord: &LogRecord{
+				Key:   []byte("hello"),
+				Value: bytes.Repeat([]byte("world"), 20),
+				Type:  LogRecordNormal,
+				Codec: CodecLZ,
+			},
+			wantErr:  nil,
+			wantSize: 4 + 1 + 1 + 1 + 5 + 9,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			file, err := OpenDataFile(os.TempDir(), 0)
+			file, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
 			assert.Nil(t, err)
 			record, size, err := file.ReadLogRecord(tc.offset)
 			assert.Equal(t, tc.wantErr, err)
@@ -407,3 +485,36 @@ func TestDataFile_ReadLogRecord(t *testing.T) {
 	}
 
 }
+
+func TestDataFile_WriteFailed(t *testing.T) {
+	fs := fiotest.NewFaultFS(1)
+	file, err := OpenDataFileWithOptions(t.TempDir(), 0, fio.StandardFIO, DataFileOptions{NewIOManager: fs.NewIOManager})
+	assert.Nil(t, err)
+	defer file.Close()
+
+	// 第一次写入时文件头只写入了一部分，下一次写入重新写入完整的文件头
+	fs.FailWrite(0, 10, syscall.ENOSPC)
+	assert.Equal(t, syscall.ENOSPC, file.Write([]byte("hello")))
+	assert.Equal(t, int64(0), file.WriteOff)
+	assert.Nil(t, file.Write([]byte("hello")))
+	// 写入失败时已经写入的部分数据会被截断
+	fs.FailWrite(0, 3, syscall.ENOSPC)
+	assert.Equal(t, syscall.ENOSPC, file.Write([]byte("world")))
+	assert.Equal(t, int64(5), file.WriteOff)
+	assert.Nil(t, file.Write([]byte("!")))
+	assert.Equal(t, int64(6), file.WriteOff)
+
+	size, err := file.IoManager.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, FileHeaderSize+file.WriteOff, size)
+	header, err := decodeFileHeader(readFileHeader(t, file))
+	assert.Nil(t, err)
+	assert.Equal(t, FormatVersion, header.Version)
+}
+
+func readFileHeader(t *testing.T, file *DataFile) []byte {
+	buf := make([]byte, FileHeaderSize)
+	_, err := file.IoManager.Read(buf, 0)
+	assert.Nil(t, err)
+	return buf
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+var (
+	ErrEncryptedFile      = errors.New("data file is encrypted, but no key provider is configured")
+	ErrWrongEncryptionKey = errors.New("wrong encryption key, data file cannot be decrypted")
+	ErrDecryptFailed      = errors.New("decrypt log record failed, log record maybe corrupted or tampered")
+)
+
+// KeyProvider 提供加密数据文件使用的密钥，密钥长度必须是16、24或者32字节，分别对应AES-128、AES-192和AES-256
+// 每个加密的数据文件在文件头中记录创建时使用的密钥id，轮换密钥之后旧的密钥仍然需要能够通过Key获取，直到merge使用新的密钥重写所有数据
+type KeyProvider interface {
+	// ActiveKeyID 新创建的数据文件使用的密钥id
+	ActiveKeyID() uint32
+
+	// Key 获取密钥id对应的密钥
+	Key(keyID uint32) ([]byte, error)
+}
+
+// StaticKeyProvider 保存在内存中的一组密钥
+type StaticKeyProvider struct {
+	ActiveID uint32
+	Keys     map[uint32][]byte
+}
+
+var errKeyNotFound = errors.New("encryption key not found")
+
+func (p *StaticKeyProvider) ActiveKeyID() uint32 {
+	return p.ActiveID
+}
+
+func (p *StaticKeyProvider) Key(keyID uint32) ([]byte, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return key, nil
+}
+
+const (
+	noncePrefixSize = 4
+	recordNonceSize = 8
+)
+
+// recordCipher 使用AES-GCM加密一个数据文件中每条记录的key和value
+// 每条记录的nonce由文件的nonce前缀和记录中保存的8字节随机数组成，截断之后重新写入的记录也不会重复使用nonce
+type recordCipher struct {
+	keyID       uint32
+	aead        cipher.AEAD
+	noncePrefix []byte
+}
+
+func newRecordCipher(keyProvider KeyProvider, keyID uint32, noncePrefix []byte) (*recordCipher, error) {
+	key, err := keyProvider.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &recordCipher{keyID: keyID, aead: aead, noncePrefix: noncePrefix}, nil
+}
+
+// overhead 加密之后增加的长度
+func (c *recordCipher) overhead() int {
+	return recordNonceSize + c.aead.Overhead()
+}
+
+// seal 加密数据，返回nonce随机部分以及加密之后的数据，additional是需要一起认证的记录头部
+func (c *recordCipher) seal(plaintext, additional []byte) []byte {
+	nonce := make([]byte, noncePrefixSize+recordNonceSize)
+	copy(nonce, c.noncePrefix)
+	_, _ = rand.Read(nonce[noncePrefixSize:])
+	sealed := make([]byte, recordNonceSize, recordNonceSize+len(plaintext)+c.aead.Overhead())
+	copy(sealed, nonce[noncePrefixSize:])
+	return c.aead.Seal(sealed, nonce, plaintext, additional)
+}
+
+// open 解密seal加密的数据
+func (c *recordCipher) open(sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < c.overhead() {
+		return nil, ErrDecryptFailed
+	}
+	nonce := make([]byte, 0, noncePrefixSize+recordNonceSize)
+	nonce = append(append(nonce, c.noncePrefix...), sealed[:recordNonceSize]...)
+	plaintext, err := c.aead.Open(nil, nonce, sealed[recordNonceSize:], additional)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+// keyTag 使用密钥加密空数据得到的认证标签，写入文件头，打开文件时用来校验密钥是否正确
+// nonce的随机部分全部为0，记录的nonce和它相同的概率可以忽略
+func (c *recordCipher) keyTag(additional []byte) []byte {
+	nonce := make([]byte, noncePrefixSize+recordNonceSize)
+	copy(nonce, c.noncePrefix)
+	return c.aead.Seal(nil, nonce, nil, additional)
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"Sirius/fio"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+)
+
+func testKeyProvider(activeID uint32) *StaticKeyProvider {
+	return &StaticKeyProvider{
+		ActiveID: activeID,
+		Keys: map[uint32][]byte{
+			1: bytes.Repeat([]byte{1}, 16),
+			2: bytes.Repeat([]byte{2}, 32),
+		},
+	}
+}
+
+// writeTestRecords 写入两条记录，返回第二条记录的偏移
+func writeTestRecords(t *testing.T, dirPath string, keyProvider KeyProvider) int64 {
+	dataFile, err := OpenDataFileWithOptions(dirPath, 0, fio.StandardFIO, DataFileOptions{KeyProvider: keyProvider})
+	assert.Nil(t, err)
+	defer dataFile.Close()
+	encRecord, _ := dataFile.EncodeLogRecord(&LogRecord{Key: []byte("name"), Value: []byte("zhangsan")})
+	assert.Nil(t, dataFile.Write(encRecord))
+	offset := dataFile.WriteOff
+	encRecord, _ = dataFile.EncodeLogRecord(&LogRecord{Key: []byte("phone"), Value: []byte("13800000000"), Expire: 1})
+	assert.Nil(t, dataFile.Write(encRecord))
+	assert.Nil(t, dataFile.Sync())
+	return offset
+}
+
+func TestDataFile_Encryption(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 写入时使用的密钥，为nil时写入明文
+		writeKeyProvider KeyProvider
+		readKeyProvider  KeyProvider
+		// 读取之前修改数据文件
+		modify func(t *testing.T, fileName string, offset int64)
+
+		wantOpenErr error
+		wantReadErr error
+		wantKeyID   uint32
+		wantCipher  bool
+	}{
+		{
+			name:             "加密之后使用相同的密钥读取",
+			writeKeyProvider: testKeyProvider(1),
+			readKeyProvider:  testKeyProvider(1),
+			wantKeyID:        1,
+			wantCipher:       true,
+		},
+		{
+			name:             "轮换密钥之后使用文件头中记录的密钥读取",
+			writeKeyProvider: testKeyProvider(1),
+			readKeyProvider:  testKeyProvider(2),
+			wantKeyID:        1,
+			wantCipher:       true,
+		},
+		{
+			name:             "密钥错误",
+			writeKeyProvider: testKeyProvider(1),
+			readKeyProvider:  &StaticKeyProvider{Keys: map[uint32][]byte{1: bytes.Repeat([]byte{3}, 16)}},
+			wantOpenErr:      ErrWrongEncryptionKey,
+		},
+		{
+			name:             "没有配置密钥",
+			writeKeyProvider: testKeyProvider(1),
+			wantOpenErr:      ErrEncryptedFile,
+		},
+		{
+			name:            "开启加密之前创建的文件仍然以明文读取",
+			readKeyProvider: testKeyProvider(1),
+		},
+		{
+			name:             "加密的数据被篡改",
+			writeKeyProvider: testKeyProvider(1),
+			readKeyProvider:  testKeyProvider(1),
+			modify: func(t *testing.T, fileName string, offset int64) {
+				// 修改密文之后重新计算crc，只有认证标签能够发现数据被修改
+				content, err := os.ReadFile(fileName)
+				assert.Nil(t, err)
+				record := content[FileHeaderSize+offset:]
+				record[len(record)-1] ^= 0xff
+				binary.LittleEndian.PutUint32(record, crc32.Checksum(record[4:], checksumTable(ChecksumCRC32C)))
+				assert.Nil(t, os.WriteFile(fileName, content, 0644))
+			},
+			wantReadErr: ErrDecryptFailed,
+			wantKeyID:   1,
+			wantCipher:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirPath := t.TempDir()
+			offset := writeTestRecords(t, dirPath, tc.writeKeyProvider)
+			fileName := GetDataFileName(dirPath, 0)
+			content, err := os.ReadFile(fileName)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.writeKeyProvider == nil, bytes.Contains(content, []byte("zhangsan")))
+			if tc.modify != nil {
+				tc.modify(t, fileName, offset)
+			}
+
+			dataFile, err := OpenDataFileWithOptions(dirPath, 0, fio.MemoryMap, DataFileOptions{KeyProvider: tc.readKeyProvider})
+			assert.Equal(t, tc.wantOpenErr, err)
+			if err != nil {
+				return
+			}
+			defer dataFile.Close()
+			keyID, ok := dataFile.KeyID()
+			assert.Equal(t, tc.wantKeyID, keyID)
+			assert.Equal(t, tc.wantCipher, ok)
+
+			record, size, err := dataFile.ReadLogRecord(0)
+			assert.Nil(t, err)
+			assert.Equal(t, offset, size)
+			assert.Equal(t, &LogRecord{Key: []byte("name"), Value: []byte("zhangsan")}, record)
+			record, size, err = dataFile.ReadLogRecord(offset)
+			assert.Equal(t, tc.wantReadErr, err)
+			if err == nil {
+				assert.Equal(t, &LogRecord{Key: []byte("phone"), Value: []byte("13800000000"), Expire: 1}, record)
+				_, _, err = dataFile.ReadLogRecord(offset + size)
+				assert.Equal(t, io.EOF, err)
+			}
+		})
+	}
+}
+
+func TestDataFile_EncryptionHeaderWriteFailed(t *testing.T) {
+	dirPath := t.TempDir()
+	fileName := GetDataFileName(dirPath, 0)
+	// 写入文件头时崩溃，只留下了一部分文件头
+	assert.Nil(t, os.WriteFile(fileName, []byte(fileHeaderMagic[:2]), 0644))
+
+	dataFile, err := OpenDataFileWithOptions(dirPath, 0, fio.StandardFIO, DataFileOptions{KeyProvider: testKeyProvider(2)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), dataFile.WriteOff)
+	_, _, err = dataFile.ReadLogRecord(0)
+	assert.Equal(t, io.EOF, err)
+
+	// 第一次写入时重新写入完整的文件头
+	encRecord, size := dataFile.EncodeLogRecord(&LogRecord{Key: []byte("name"), Value: []byte("zhangsan")})
+	assert.Nil(t, dataFile.Write(encRecord))
+	assert.Equal(t, size, dataFile.WriteOff)
+	assert.Nil(t, dataFile.Close())
+	info, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, FileHeaderSize+size, info.Size())
+
+	dataFile, err = OpenDataFileWithOptions(dirPath, 0, fio.StandardFIO, DataFileOptions{KeyProvider: testKeyProvider(1)})
+	assert.Nil(t, err)
+	defer dataFile.Close()
+	keyID, _ := dataFile.KeyID()
+	assert.Equal(t, uint32(2), keyID)
+	record, _, err := dataFile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("zhangsan"), record.Value)
+}
@@ -0,0 +1,266 @@
+package data
+
+import (
+	"Sirius/fio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	ErrUnsupportedFormat   = errors.New("data file format version is not supported, please upgrade sirius")
+	ErrFileHeaderCorrupted = errors.New("data file header is corrupted")
+)
+
+// FormatVersion 当前的数据文件格式版本，修改LogRecord的格式时需要增加版本号，并且在sirius-upgrade中支持从旧的版本升级
+// 版本0是没有文件头的数据文件，仍然可以读取
+const FormatVersion uint16 = 1
+
+// 数据文件以固定长度的文件头开始，记录的偏移都不包括文件头
+// +-----------+-------------+-----------+---------------+-----------------+-----------+-----------------+-------------+---------+
+// | Magic(4B) | Version(2B) | Flags(2B) | CreatedAt(8B) | Fingerprint(8B) | KeyID(4B) | NoncePrefix(4B) | KeyTag(16B) | CRC(4B) |
+// +-----------+-------------+-----------+---------------+-----------------+-----------+-----------------+-------------+---------+
+// KeyID、NoncePrefix和KeyTag只有加密的数据文件才会使用，KeyTag是使用密钥加密空数据得到的认证标签，打开文件时用来校验密钥是否正确
+// CRC校验的是前面所有的字段，文件头的CRC总是使用IEEE算法，读取文件头之前不知道文件使用的校验算法
+const (
+	fileHeaderMagic = "SRSD"
+	FileHeaderSize  = 4 + 2 + 2 + 8 + 8 + 4 + noncePrefixSize + 16 + 4
+
+	fileHeaderKeyTagOffset = 32
+	fileHeaderCRCOffset    = FileHeaderSize - 4
+)
+
+const (
+	// fileFlagEncrypted 数据文件中记录的key和value都已经加密
+	fileFlagEncrypted uint16 = 1 << iota
+
+	// fileFlagCRC32C 记录的crc使用CRC32C算法，没有这个标识的数据文件使用IEEE算法
+	fileFlagCRC32C
+
+	fileFlagsKnown = fileFlagEncrypted | fileFlagCRC32C
+)
+
+// FileHeader 数据文件头
+type FileHeader struct {
+	Version uint16
+	// CreatedAt 创建时间，unix纳秒时间戳
+	CreatedAt int64
+	// Fingerprint 创建数据文件时影响写入格式的配置项的指纹，用于排查问题，配置项修改之后旧的文件仍然可以读取
+	Fingerprint uint64
+	Encrypted   bool
+	KeyID       uint32
+	// Checksum 记录的crc校验算法
+	Checksum Checksum
+
+	noncePrefix []byte
+}
+
+// encodeFileHeader 编码文件头，加密的数据文件需要传入cipher计算KeyTag
+func encodeFileHeader(header *FileHeader, cipher *recordCipher) []byte {
+	buf := make([]byte, FileHeaderSize)
+	copy(buf, fileHeaderMagic)
+	binary.LittleEndian.PutUint16(buf[4:], header.Version)
+	var flags uint16
+	if header.Encrypted {
+		flags |= fileFlagEncrypted
+	}
+	if header.Checksum == ChecksumCRC32C {
+		flags |= fileFlagCRC32C
+	}
+	binary.LittleEndian.PutUint16(buf[6:], flags)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(header.CreatedAt))
+	binary.LittleEndian.PutUint64(buf[16:], header.Fingerprint)
+	if cipher != nil {
+		binary.LittleEndian.PutUint32(buf[24:], header.KeyID)
+		copy(buf[28:], header.noncePrefix)
+		copy(buf[fileHeaderKeyTagOffset:], cipher.keyTag(buf[:fileHeaderKeyTagOffset]))
+	}
+	binary.LittleEndian.PutUint32(buf[fileHeaderCRCOffset:], crc32.ChecksumIEEE(buf[:fileHeaderCRCOffset]))
+	return buf
+}
+
+// decodeFileHeader 解码文件头，不校验KeyTag
+func decodeFileHeader(buf []byte) (*FileHeader, error) {
+	if binary.LittleEndian.Uint32(buf[fileHeaderCRCOffset:]) != crc32.ChecksumIEEE(buf[:fileHeaderCRCOffset]) {
+		return nil, ErrFileHeaderCorrupted
+	}
+	header := &FileHeader{
+		Version:     binary.LittleEndian.Uint16(buf[4:]),
+		CreatedAt:   int64(binary.LittleEndian.Uint64(buf[8:])),
+		Fingerprint: binary.LittleEndian.Uint64(buf[16:]),
+	}
+	if header.Version == 0 || header.Version > FormatVersion {
+		return nil, ErrUnsupportedFormat
+	}
+	flags := binary.LittleEndian.Uint16(buf[6:])
+	if flags&^fileFlagsKnown != 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	header.Checksum = ChecksumIEEE
+	if flags&fileFlagCRC32C != 0 {
+		header.Checksum = ChecksumCRC32C
+	}
+	if flags&fileFlagEncrypted != 0 {
+		header.Encrypted = true
+		header.KeyID = binary.LittleEndian.Uint32(buf[24:])
+		header.noncePrefix = append([]byte(nil), buf[28:28+noncePrefixSize]...)
+	}
+	return header, nil
+}
+
+// newFileHeader 创建新的数据文件使用的文件头，使用配置的校验算法，开启加密时使用当前的密钥
+func newFileHeader(options DataFileOptions) (*FileHeader, *recordCipher, error) {
+	header := &FileHeader{
+		Version:     FormatVersion,
+		CreatedAt:   time.Now().UnixNano(),
+		Fingerprint: options.Fingerprint,
+		Checksum:    options.Checksum,
+	}
+	if options.KeyProvider == nil {
+		return header, nil, nil
+	}
+	header.Encrypted = true
+	header.KeyID = options.KeyProvider.ActiveKeyID()
+	header.noncePrefix = make([]byte, noncePrefixSize)
+	if _, err := rand.Read(header.noncePrefix); err != nil {
+		return nil, nil, err
+	}
+	cipher, err := newRecordCipher(options.KeyProvider, header.KeyID, header.noncePrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, cipher, nil
+}
+
+// openFileHeader 读取数据文件的文件头，返回文件头、解密使用的cipher，以及文件头是否还没有写入
+// 空文件以及写入文件头时崩溃留下的不完整的文件头会使用新的文件头，在第一次写入时一起写入
+// 没有文件头的文件是版本0的数据文件，返回Version为0的文件头
+func openFileHeader(ioManager fio.IOManager, options DataFileOptions) (*FileHeader, *recordCipher, bool, error) {
+	fileSize, err := ioManager.Size()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	var size int64 = FileHeaderSize
+	if fileSize < size {
+		size = fileSize
+	}
+	buf := make([]byte, size)
+	if size > 0 {
+		if _, err := ioManager.Read(buf, 0); err != nil && err != io.EOF {
+			return nil, nil, false, err
+		}
+	}
+	magic := []byte(fileHeaderMagic)
+	if len(buf) < len(magic) {
+		magic = magic[:len(buf)]
+	}
+	if fileSize > 0 && !bytes.Equal(buf[:len(magic)], magic) {
+		// 版本0的数据文件，开启加密之前就已经存在，仍然以明文读写，使用IEEE算法校验
+		return &FileHeader{Checksum: ChecksumIEEE}, nil, false, nil
+	}
+	if fileSize < FileHeaderSize {
+		header, cipher, err := newFileHeader(options)
+		return header, cipher, true, err
+	}
+
+	header, err := decodeFileHeader(buf)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !header.Encrypted {
+		return header, nil, false, nil
+	}
+	if options.KeyProvider == nil {
+		return nil, nil, false, ErrEncryptedFile
+	}
+	cipher, err := newRecordCipher(options.KeyProvider, header.KeyID, header.noncePrefix)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !bytes.Equal(cipher.keyTag(buf[:fileHeaderKeyTagOffset]), buf[fileHeaderKeyTagOffset:fileHeaderCRCOffset]) {
+		return nil, nil, false, ErrWrongEncryptionKey
+	}
+	return header, cipher, false, nil
+}
+
+// ReadFileHeader 只读取数据文件的文件头，不需要密钥，可以用来查看加密的数据文件使用的密钥id
+// 版本0的数据文件返回Version为0的文件头，文件头还没有完整写入时返回ErrFileHeaderCorrupted
+func ReadFileHeader(fileName string) (FileHeader, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return FileHeader{}, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, FileHeaderSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileHeader{}, err
+	}
+	magic := []byte(fileHeaderMagic)
+	if n < len(magic) || !bytes.Equal(buf[:len(magic)], magic) {
+		return FileHeader{Checksum: ChecksumIEEE}, nil
+	}
+	if n < FileHeaderSize {
+		return FileHeader{}, ErrFileHeaderCorrupted
+	}
+	header, err := decodeFileHeader(buf)
+	if err != nil {
+		return FileHeader{}, err
+	}
+	return *header, nil
+}
+
+// UpgradeDataFile 将旧版本的数据文件重写为当前的格式，返回原来的格式版本，已经是当前格式的文件不会修改
+// 升级时在原来的数据之前加上文件头，记录的内容以及偏移都不变，所以索引不需要更新
+// 不知道旧文件创建时的配置，文件头中的指纹为0，旧的记录使用IEEE算法校验，升级之后仍然使用IEEE算法
+// 先写入临时文件再rename，升级过程中崩溃时数据文件要么是旧的，要么是完整的新文件
+func UpgradeDataFile(fileName string) (uint16, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	magic := make([]byte, len(fileHeaderMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if n > 0 && bytes.Equal(magic[:n], []byte(fileHeaderMagic)[:n]) {
+		return FormatVersion, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	tmpFileName := fileName + UpgradeTmpFileSuffix
+	tmpFile, err := os.OpenFile(tmpFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fio.DATA_FILE_PERM)
+	if err != nil {
+		return 0, err
+	}
+	defer tmpFile.Close()
+	header := &FileHeader{Version: FormatVersion, CreatedAt: stat.ModTime().UnixNano(), Checksum: ChecksumIEEE}
+	if _, err := tmpFile.Write(encodeFileHeader(header, nil)); err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(tmpFile, file); err != nil {
+		return 0, err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpFileName, fileName); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
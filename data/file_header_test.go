@@ -0,0 +1,175 @@
+package data
+
+import (
+	"Sirius/fio"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+// writeLegacyFile 写入没有文件头的版本0数据文件，返回第二条记录的偏移
+func writeLegacyFile(t *testing.T, fileName string) int64 {
+	first, size := EncodeLogRecord(&LogRecord{Key: []byte("name"), Value: []byte("zhangsan")})
+	second, _ := EncodeLogRecord(&LogRecord{Key: []byte("age"), Value: []byte("18")})
+	assert.Nil(t, os.WriteFile(fileName, append(first, second...), 0644))
+	return size
+}
+
+func TestOpenFileHeader(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(header []byte)
+
+		wantErr error
+	}{
+		{
+			name:   "当前版本",
+			modify: func(header []byte) {},
+		},
+		{
+			name: "更新的版本",
+			modify: func(header []byte) {
+				binary.LittleEndian.PutUint16(header[4:], FormatVersion+1)
+			},
+			wantErr: ErrUnsupportedFormat,
+		},
+		{
+			name: "未知的标识位",
+			modify: func(header []byte) {
+				binary.LittleEndian.PutUint16(header[6:], 1<<15)
+			},
+			wantErr: ErrUnsupportedFormat,
+		},
+		{
+			name: "文件头损坏",
+			modify: func(header []byte) {
+				header[10] ^= 0xff
+			},
+			wantErr: ErrFileHeaderCorrupted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirPath := t.TempDir()
+			dataFile, err := OpenDataFileWithOptions(dirPath, 0, fio.StandardFIO, DataFileOptions{Fingerprint: 42})
+			assert.Nil(t, err)
+			encRecord, _ := dataFile.EncodeLogRecord(&LogRecord{Key: []byte("name"), Value: []byte("zhangsan")})
+			assert.Nil(t, dataFile.Write(encRecord))
+			assert.Nil(t, dataFile.Close())
+
+			fileName := GetDataFileName(dirPath, 0)
+			content, err := os.ReadFile(fileName)
+			assert.Nil(t, err)
+			tc.modify(content)
+			// 修改文件头之后重新计算CRC，只测试CRC损坏时不重新计算
+			if tc.wantErr != ErrFileHeaderCorrupted {
+				binary.LittleEndian.PutUint32(content[fileHeaderCRCOffset:], crc32.ChecksumIEEE(content[:fileHeaderCRCOffset]))
+			}
+			assert.Nil(t, os.WriteFile(fileName, content, 0644))
+
+			dataFile, err = OpenDataFile(dirPath, 0, fio.StandardFIO)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			defer dataFile.Close()
+			header := dataFile.Header()
+			assert.Equal(t, FormatVersion, header.Version)
+			assert.Equal(t, uint64(42), header.Fingerprint)
+			assert.NotZero(t, header.CreatedAt)
+			assert.False(t, header.Encrypted)
+			assert.Equal(t, int64(len(encRecord)), dataFile.WriteOff)
+			record, _, err := dataFile.ReadLogRecord(0)
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("zhangsan"), record.Value)
+		})
+	}
+}
+
+func TestUpgradeDataFile(t *testing.T) {
+	dirPath := t.TempDir()
+	fileName := GetDataFileName(dirPath, 0)
+	offset := writeLegacyFile(t, fileName)
+
+	// 版本0的数据文件仍然可以读取
+	dataFile, err := OpenDataFile(dirPath, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0), dataFile.Header().Version)
+	assert.Nil(t, dataFile.Close())
+
+	version, err := UpgradeDataFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0), version)
+	_, err = os.Stat(fileName + UpgradeTmpFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// 升级之后记录的偏移不变
+	dataFile, err = OpenDataFile(dirPath, 0, fio.MemoryMap)
+	assert.Nil(t, err)
+	assert.Equal(t, FormatVersion, dataFile.Header().Version)
+	record, _, err := dataFile.ReadLogRecord(offset)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("18"), record.Value)
+	assert.Nil(t, dataFile.Close())
+
+	// 已经是当前版本的数据文件不会修改
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	version, err = UpgradeDataFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, FormatVersion, version)
+	upgraded, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, content, upgraded)
+}
+
+func TestReadFileHeader(t *testing.T) {
+	testCases := []struct {
+		name    string
+		prepare func(t *testing.T, dirPath string)
+
+		wantVersion   uint16
+		wantEncrypted bool
+		wantKeyID     uint32
+		wantErr       error
+	}{
+		{
+			name: "加密的数据文件不需要密钥也能读取文件头",
+			prepare: func(t *testing.T, dirPath string) {
+				writeTestRecords(t, dirPath, testKeyProvider(2))
+			},
+			wantVersion:   FormatVersion,
+			wantEncrypted: true,
+			wantKeyID:     2,
+		},
+		{
+			name: "没有文件头的版本0数据文件",
+			prepare: func(t *testing.T, dirPath string) {
+				writeLegacyFile(t, GetDataFileName(dirPath, 0))
+			},
+		},
+		{
+			name: "不完整的文件头",
+			prepare: func(t *testing.T, dirPath string) {
+				writeTestRecords(t, dirPath, nil)
+				assert.Nil(t, os.Truncate(GetDataFileName(dirPath, 0), FileHeaderSize-1))
+			},
+			wantErr: ErrFileHeaderCorrupted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dirPath := t.TempDir()
+			tc.prepare(t, dirPath)
+			header, err := ReadFileHeader(GetDataFileName(dirPath, 0))
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVersion, header.Version)
+			assert.Equal(t, tc.wantEncrypted, header.Encrypted)
+			assert.Equal(t, tc.wantKeyID, header.KeyID)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"time"
 )
 
 type LogRecordType = uint8
@@ -11,65 +12,145 @@ const (
 	LogRecordNormal LogRecordType = iota
 
 	LogRecordDeleted
+
+	// LogRecordTxnFinished 批量写入完成的标识记录，只有读到这条记录，同一批次的数据才会生效
+	LogRecordTxnFinished
 )
 
-// | CRC(4B) | Type(1B) | KeySize | ValueSize |
+// logRecordExpireFlag Type字段的最高位，表示header中带有过期时间
+// 没有过期时间的记录和原来的格式完全一致，旧的数据文件仍然可以正常读取
+const logRecordExpireFlag LogRecordType = 1 << 7
+
+// logRecordSeqFlag Type字段的第4位，表示header中带有批量写入的序列号
+// 非批量写入的记录不设置这个标识，和原来的格式完全一致
+const logRecordSeqFlag LogRecordType = 1 << 4
+
+// | CRC(4B) | Type(1B) | KeySize | ValueSize | Expire | SeqNo |
 // 变长编码中32位整数最多使用5字节表示，其中每字节的最高位表示继续位，其余7位表示数据位
 // 例如：0000 0001 二进制表示1，129表示为1000 0001 0000 0001
-const maxLogHeaderRecordSize = 4 + 1 + binary.MaxVarintLen32 + binary.MaxVarintLen32
+const maxLogHeaderRecordSize = 4 + 1 + binary.MaxVarintLen32 + binary.MaxVarintLen32 + binary.MaxVarintLen64 + binary.MaxVarintLen64
 
 // LogRecordPos 内存数据索引，主要是内存中维护的描述数据在磁盘上的位置的结构
 type LogRecordPos struct {
 	Fid    uint32 // 文件id,表示数据存储在哪个文件中
 	Offset int64  // 偏移，表示数据在文件中的哪个位置
+	Size   uint32 // 数据在磁盘上占用的大小
+	Expire int64  // 过期时间，unix纳秒时间戳，0表示永不过期
+}
+
+// IsExpired 判断数据在now时刻是否已经过期
+func (pos *LogRecordPos) IsExpired(now time.Time) bool {
+	return pos.Expire > 0 && pos.Expire <= now.UnixNano()
 }
 
 // LogRecord 记录到磁盘的数据记录
 type LogRecord struct {
-	Key   []byte
-	Value []byte
-	Type  LogRecordType // 记录类型是否被删除
+	Key    []byte
+	Value  []byte
+	Type   LogRecordType // 记录类型是否被删除
+	Expire int64         // 过期时间，unix纳秒时间戳，0表示永不过期
+	Codec  Codec         // value的压缩算法，读取时已经解压，这里记录的是磁盘上使用的算法
+	SeqNo  uint64        // 批量写入的序列号，0表示不是批量写入的数据
+}
+
+// TransactionRecord 暂存的批量写入数据，加载索引时读到完成标识之后才会更新到内存索引
+type TransactionRecord struct {
+	Record *LogRecord
+	Pos    *LogRecordPos
 }
 
 // logRecordHeader LogRecord头部信息
 type logRecordHeader struct {
 	crc        uint32        // crc校验值
 	recordType LogRecordType // 记录类型
+	codec      Codec         // value的压缩算法
 	keySize    uint32        // key大小,变长编码，最大5字节
 	valueSize  uint32        // value大小，变长编码，最大5字节，
+	expire     int64         // 过期时间，只有Type带有过期标识时才会编码
+	seqNo      uint64        // 批量写入的序列号，只有Type带有序列号标识时才会编码
 }
 
 // EncodeLogRecord 编码LogRecord,返回字节数组以及长度
-// +---------+----------+---------+-----------+-----+-------+
-// | CRC(4B) | Type(1B) | KeySize | ValueSize | Key | Value |
-// +---------+----------+---------+-----------+-----+-------+
+// +---------+----------+---------+-----------+----------+---------+-----+-------+
+// | CRC(4B) | Type(1B) | KeySize | ValueSize | [Expire] | [SeqNo] | Key | Value |
+// +---------+----------+---------+-----------+----------+---------+-----+-------+
+// 设置了过期时间时，Type的最高位置为1，并在ValueSize之后以变长编码写入过期时间
+// 批量写入的记录Type的第4位置为1，并在过期时间之后以变长编码写入序列号
+// 设置了压缩算法时，value压缩后写入，Type的第5、6位记录压缩算法，ValueSize是压缩后的长度
+// 压缩之后没有变小的value仍然原样写入，这时Codec会被重置为CodecNone
+// crc使用IEEE算法，和版本0的数据文件一致，写入有文件头的数据文件时需要使用DataFile.EncodeLogRecord
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
+	return encodeLogRecord(logRecord, nil, crc32.IEEETable)
+}
+
+// encodeLogRecord 编码LogRecord，使用crcTable计算crc校验值，cipher不为nil时加密key和value
+// +---------+----------+---------+-----------+----------+---------+----------+----------------------+
+// | CRC(4B) | Type(1B) | KeySize | ValueSize | [Expire] | [SeqNo] | Nonce(8B)| Encrypted(Key+Value) |
+// +---------+----------+---------+-----------+----------+---------+----------+----------------------+
+// KeySize和ValueSize是加密之前的长度，crc校验的是加密之后的数据
+func encodeLogRecord(logRecord *LogRecord, cipher *recordCipher, crcTable *crc32.Table) ([]byte, int64) {
+	value := logRecord.Value
+	if logRecord.Codec != CodecNone {
+		compressed := compressValue(logRecord.Codec, value)
+		if len(compressed) < len(value) {
+			value = compressed
+		} else {
+			logRecord.Codec = CodecNone
+		}
+	}
+
 	// 初始化一个header
 	header := make([]byte, maxLogHeaderRecordSize)
 	// 第五个字节存储type
-	header[4] = logRecord.Type
+	header[4] = logRecord.Type | logRecord.Codec<<logRecordCodecShift
+	if logRecord.Expire > 0 {
+		header[4] |= logRecordExpireFlag
+	}
+	if logRecord.SeqNo > 0 {
+		header[4] |= logRecordSeqFlag
+	}
 	var index = 5
 	// 5字节之后，存储keySize和valueSize
 	index += binary.PutVarint(header[index:], int64(len(logRecord.Key)))
-	index += binary.PutVarint(header[index:], int64(len(logRecord.Value)))
+	index += binary.PutVarint(header[index:], int64(len(value)))
+	if logRecord.Expire > 0 {
+		index += binary.PutVarint(header[index:], logRecord.Expire)
+	}
+	if logRecord.SeqNo > 0 {
+		index += binary.PutUvarint(header[index:], logRecord.SeqNo)
+	}
+
+	if cipher != nil {
+		kvBuf := append(append(make([]byte, 0, len(logRecord.Key)+len(value)), logRecord.Key...), value...)
+		return encodeSealedLogRecord(header[:index], cipher.seal(kvBuf, header[4:index]), crcTable)
+	}
 
-	var size = index + len(logRecord.Key) + len(logRecord.Value)
+	var size = index + len(logRecord.Key) + len(value)
 	encBytes := make([]byte, size)
 
 	// 将header部分拷贝过来
 	copy(encBytes[:index], header[:index])
 	// 将key和value拷贝过来
 	copy(encBytes[index:], logRecord.Key)
-	copy(encBytes[index+len(logRecord.Key):], logRecord.Value)
+	copy(encBytes[index+len(logRecord.Key):], value)
 
 	// 计算crc校验值
-	crc := crc32.ChecksumIEEE(encBytes[4:])
+	crc := crc32.Checksum(encBytes[4:], crcTable)
 
 	binary.LittleEndian.PutUint32(encBytes[:4], crc)
 
 	return encBytes, int64(size)
 }
 
+// encodeSealedLogRecord 拼接头部信息和加密之后的数据，并计算crc校验值
+func encodeSealedLogRecord(header []byte, sealed []byte, crcTable *crc32.Table) ([]byte, int64) {
+	encBytes := make([]byte, len(header)+len(sealed))
+	copy(encBytes, header)
+	copy(encBytes[len(header):], sealed)
+	binary.LittleEndian.PutUint32(encBytes[:4], crc32.Checksum(encBytes[4:], crcTable))
+	return encBytes, int64(len(encBytes))
+}
+
 // decodeLogRecordHeader 解码LogRecord头部信息,返回header和header长度
 func decodeLogRecordHeader(data []byte) (*logRecordHeader, int64) {
 	// 如果数据长度小于5，说明数据不完整
@@ -78,30 +159,84 @@ func decodeLogRecordHeader(data []byte) (*logRecordHeader, int64) {
 	}
 	header := &logRecordHeader{
 		crc:        binary.LittleEndian.Uint32(data[:4]),
-		recordType: data[4],
+		recordType: data[4] &^ (logRecordExpireFlag | logRecordSeqFlag | logRecordCodecMask),
+		codec:      (data[4] & logRecordCodecMask) >> logRecordCodecShift,
 	}
 
 	// 读取keySize和valueSize，前面4个字节是crc，第5个字节是type，所以从第6个字节开始读取
+	// 数据不完整或者已经损坏时n<=0，和数据长度不足一样处理
 	var index = 5
 	keySize, n := binary.Varint(data[index:])
+	if n <= 0 || keySize < 0 {
+		return nil, 0
+	}
 	header.keySize = uint32(keySize)
 	index += n
 	valueSize, n := binary.Varint(data[index:])
+	if n <= 0 || valueSize < 0 {
+		return nil, 0
+	}
 	header.valueSize = uint32(valueSize)
 	index += n
+	if data[4]&logRecordExpireFlag != 0 {
+		expire, n := binary.Varint(data[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.expire = expire
+		index += n
+	}
+	if data[4]&logRecordSeqFlag != 0 {
+		seqNo, n := binary.Uvarint(data[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.seqNo = seqNo
+		index += n
+	}
 
 	return header, int64(index)
 }
 
-// getLogRecordCRC 获取LogRecord的crc校验值
-func getLogRecordCRC(r *LogRecord, header []byte) uint32 {
+// EncodeLogRecordPos 编码LogRecordPos，用于写入索引快照文件
+// 过期时间只有设置了才会编码，没有过期时间的索引和原来的格式一致
+func EncodeLogRecordPos(pos *LogRecordPos) []byte {
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64*2)
+	var index = 0
+	index += binary.PutVarint(buf[index:], int64(pos.Fid))
+	index += binary.PutVarint(buf[index:], pos.Offset)
+	index += binary.PutVarint(buf[index:], int64(pos.Size))
+	if pos.Expire > 0 {
+		index += binary.PutVarint(buf[index:], pos.Expire)
+	}
+	return buf[:index]
+}
+
+// DecodeLogRecordPos 解码LogRecordPos
+func DecodeLogRecordPos(buf []byte) *LogRecordPos {
+	var index = 0
+	fileId, n := binary.Varint(buf[index:])
+	index += n
+	offset, n := binary.Varint(buf[index:])
+	index += n
+	size, n := binary.Varint(buf[index:])
+	index += n
+	pos := &LogRecordPos{Fid: uint32(fileId), Offset: offset, Size: uint32(size)}
+	if index < len(buf) {
+		pos.Expire, _ = binary.Varint(buf[index:])
+	}
+	return pos
+}
+
+// getLogRecordCRC 使用crcTable获取LogRecord的crc校验值
+func getLogRecordCRC(r *LogRecord, header []byte, crcTable *crc32.Table) uint32 {
 	if r == nil {
 		return 0
 	}
 
-	crc := crc32.ChecksumIEEE(header)
-	crc = crc32.Update(crc, crc32.IEEETable, r.Key)
-	crc = crc32.Update(crc, crc32.IEEETable, r.Value)
+	crc := crc32.Checksum(header, crcTable)
+	crc = crc32.Update(crc, crcTable, r.Key)
+	crc = crc32.Update(crc, crcTable, r.Value)
 
 	return crc
 }
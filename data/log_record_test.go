@@ -1,7 +1,10 @@
 package data
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"hash/crc32"
 	"testing"
 )
 
@@ -35,6 +38,25 @@ func TestEncodeLogRecord(t *testing.T) {
 				Value: []byte("zhangsan"),
 			},
 			wantLen: 5 + 1 + 1 + 4 + 8,
+		}, {
+			name: "带有过期时间",
+			logRecord: &LogRecord{
+				Type:   LogRecordNormal,
+				Key:    []byte("name"),
+				Value:  []byte("zhangsan"),
+				Expire: 1,
+			},
+			wantLen: 5 + 1 + 1 + 1 + 4 + 8,
+		},
+		{
+			name: "批量写入的记录带有序列号",
+			logRecord: &LogRecord{
+				Type:  LogRecordNormal,
+				Key:   []byte("name"),
+				Value: []byte("zhangsan"),
+				SeqNo: 300,
+			},
+			wantLen: 5 + 1 + 1 + 2 + 4 + 8,
 		},
 	}
 
@@ -67,6 +89,39 @@ func TestDecodeLogRecordHeader(t *testing.T) {
 				valueSize:  8,
 			},
 		},
+		{
+			name:          "K:V=name:zhangsan,normal,expire=1",
+			headerBuf:     []byte{0, 0, 0, 0, 128, 8, 16, 2},
+			wantHeaderLen: 8,
+			wantHeader: &logRecordHeader{
+				recordType: LogRecordNormal,
+				keySize:    4,
+				valueSize:  8,
+				expire:     1,
+			},
+		},
+		{
+			name:          "K:V=name:zhangsan,normal,seq=300",
+			headerBuf:     []byte{0, 0, 0, 0, 16, 8, 16, 172, 2},
+			wantHeaderLen: 9,
+			wantHeader: &logRecordHeader{
+				recordType: LogRecordNormal,
+				keySize:    4,
+				valueSize:  8,
+				seqNo:      300,
+			},
+		},
+		{
+			name:          "K:V=name:zhangsan,normal,lz压缩",
+			headerBuf:     []byte{0, 0, 0, 0, 64, 8, 16},
+			wantHeaderLen: 7,
+			wantHeader: &logRecordHeader{
+				recordType: LogRecordNormal,
+				codec:      CodecLZ,
+				keySize:    4,
+				valueSize:  8,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -81,27 +136,90 @@ func TestDecodeLogRecordHeader(t *testing.T) {
 
 func TestGetLogRecordCRC(t *testing.T) {
 	testCases := []struct {
-		name string
-		log  *LogRecord
-		buf  []byte
-		want uint32
+		name     string
+		log      *LogRecord
+		buf      []byte
+		crcTable *crc32.Table
+		want     uint32
 	}{
 		{
-			name: "K:V=name:zhangsan,normal",
+			name: "K:V=name:zhangsan,normal,IEEE",
 			log: &LogRecord{
 				Type:  LogRecordNormal,
 				Key:   []byte("name"),
 				Value: []byte("zhangsan"),
 			},
-			buf:  []byte{0, 8, 16},
-			want: 0x749093cd,
+			buf:      []byte{0, 8, 16},
+			crcTable: crc32.IEEETable,
+			want:     0x749093cd,
+		},
+		{
+			name: "K:V=name:zhangsan,normal,CRC32C",
+			log: &LogRecord{
+				Type:  LogRecordNormal,
+				Key:   []byte("name"),
+				Value: []byte("zhangsan"),
+			},
+			buf:      []byte{0, 8, 16},
+			crcTable: checksumTable(ChecksumCRC32C),
+			want:     0x9799e805,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			crc := getLogRecordCRC(tc.log, tc.buf)
+			crc := getLogRecordCRC(tc.log, tc.buf, tc.crcTable)
 			assert.Equal(t, tc.want, crc)
 		})
 	}
 }
+
+func TestEncodeLogRecordPos(t *testing.T) {
+	testCases := []struct {
+		name string
+		pos  *LogRecordPos
+	}{
+		{
+			name: "文件开头",
+			pos:  &LogRecordPos{Fid: 0, Offset: 0},
+		}, {
+			name: "大文件id和偏移",
+			pos:  &LogRecordPos{Fid: 4294967295, Offset: 256 * 1024 * 1024, Size: 128},
+		}, {
+			name: "带有过期时间",
+			pos:  &LogRecordPos{Fid: 1, Offset: 1024, Size: 128, Expire: 1700000000000000000},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := EncodeLogRecordPos(tc.pos)
+			assert.Equal(t, tc.pos, DecodeLogRecordPos(buf))
+		})
+	}
+}
+
+// BenchmarkLogRecordCRC 比较两种校验算法在不同长度的value上的吞吐量
+func BenchmarkLogRecordCRC(b *testing.B) {
+	checksums := []struct {
+		name     string
+		checksum Checksum
+	}{
+		{name: "IEEE", checksum: ChecksumIEEE},
+		{name: "CRC32C", checksum: ChecksumCRC32C},
+	}
+	for _, valueSize := range []int{1 << 10, 64 << 10, 1 << 20} {
+		record := &LogRecord{Key: []byte("name"), Value: bytes.Repeat([]byte("zhangsan"), valueSize/8)}
+		header := []byte{0, 8, 16}
+		for _, c := range checksums {
+			b.Run(fmt.Sprintf("%s/%dKB", c.name, valueSize>>10), func(b *testing.B) {
+				crcTable := checksumTable(c.checksum)
+				b.SetBytes(int64(len(record.Key) + len(record.Value)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					getLogRecordCRC(record, header, crcTable)
+				}
+			})
+		}
+	}
+}
@@ -2,23 +2,50 @@ package sirius
 
 import (
 	"Sirius/data"
+	"Sirius/fio"
 	"Sirius/index"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// fileLockName 数据目录中文件锁的文件名
+const fileLockName = "flock"
+
 // DB 存储引擎实例
 type DB struct {
-	options    Options
-	lock       *sync.RWMutex
-	index      index.Indexer             // 内存索引
-	activeFile *data.DataFile            // 当前活跃文件，可以用于写入
-	olderFiles map[uint32]*data.DataFile // 旧文件，只用于读取
-	fileIds    []int                     //只在加载索引时使用
+	options     Options
+	lock        *sync.RWMutex
+	index       index.Indexer             // 内存索引
+	activeFile  *data.DataFile            // 当前活跃文件，可以用于写入
+	olderFiles  map[uint32]*data.DataFile // 旧文件，只用于读取
+	fileIds     []int                     //只在加载索引时使用
+	hintFileIds map[uint32]bool           // 索引快照覆盖的文件id，只在加载索引时使用
+	closed      bool                      // 数据库是否已经关闭
+	seqNo       uint64                    // 批量写入的序列号，全局递增
+	isMerging   bool                      // 是否正在merge
+	fileLock    *fio.FileLock             // 数据目录的文件锁，保证同一时刻只有一个进程使用数据目录
+	reclaimSize int64                     // 可以被merge清理的无效数据量
+	deadBytes   map[uint32]int64          // 每个数据文件中的无效数据量
+	recovery    RecoveryReport            // 启动时处理损坏数据的结果
+
+	mergeStopCh   chan struct{}  // 通知后台自动merge退出
+	mergeStopOnce *sync.Once     // 保证只通知一次
+	mergeWg       sync.WaitGroup // 等待后台自动merge退出
+	iterators     int32          // 正在使用的迭代器数量，有迭代器时不能替换数据文件
+
+	txnTs       uint64                   // 逻辑时间戳，每次更新内存索引时递增
+	activeTxns  map[uint64]int           // 活跃事务的读时间戳以及对应的事务数量
+	lastWrites  map[string]uint64        // 有活跃事务时，记录key最后一次被修改的时间戳，用于冲突检测
+	keyVersions map[string][]*keyVersion // 有活跃事务时，记录key被覆盖之前的旧版本，用于快照读
 }
 
 // Open 打开一个存储引擎实例
@@ -27,8 +54,18 @@ func Open(options Options) (*DB, error) {
 	if err := checkOptions(options); err != nil {
 		return nil, err
 	}
-	// 判断用户传入的目录是否存在，不存在则创建
+	// 内存模式不访问文件系统，不需要数据目录和文件锁，每次打开都是一个空数据库
+	if options.InMemory {
+		db := newDB(options, nil)
+		db.startAutoMerge()
+		return db, nil
+	}
+
+	// 判断用户传入的目录是否存在，不存在则创建，只读模式下不创建
 	if _, err := os.Stat(options.DirPath); os.IsNotExist(err) {
+		if options.ReadOnly {
+			return nil, err
+		}
 		// 创建目录,os.ModePerm是文件的权限，这里是0777,表示所有用户都有读写执行权限
 		err2 := os.MkdirAll(options.DirPath, os.ModePerm)
 		if err2 != nil {
@@ -36,53 +73,185 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
+	// 对数据目录加文件锁，如果已经被其他进程使用则直接返回
+	fileLock, err := lockDir(options)
+	if err != nil {
+		if err == fio.ErrFileLocked {
+			return nil, ErrDatabaseIsUsing
+		}
+		return nil, err
+	}
+
 	// 初始化DB实例
-	db := &DB{
+	db := newDB(options, fileLock)
+	if err := db.load(); err != nil {
+		_ = db.closeFiles()
+		if db.fileLock != nil {
+			_ = db.fileLock.Unlock()
+		}
+		return nil, err
+	}
+
+	// 启动后台自动merge，只读模式下不merge
+	if !options.ReadOnly {
+		db.startAutoMerge()
+	}
+
+	return db, nil
+}
+
+// lockDir 对数据目录加文件锁
+// 只读模式加共享锁，多个只读实例可以同时打开，但是和写入的实例互斥；只读模式不会创建锁文件，
+// 没有锁文件说明数据目录从来没有以写入的方式打开过(例如拷贝出来的备份)，直接打开，不加锁
+func lockDir(options Options) (*fio.FileLock, error) {
+	fileName := filepath.Join(options.DirPath, fileLockName)
+	if !options.ReadOnly {
+		return fio.TryLockFile(fileName)
+	}
+	fileLock, err := fio.TryRLockFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return fileLock, err
+}
+
+// newDB 初始化DB实例
+func newDB(options Options, fileLock *fio.FileLock) *DB {
+	return &DB{
 		options:    options,
 		lock:       &sync.RWMutex{},
 		index:      index.NewIndexer(options.IndexType),
 		olderFiles: make(map[uint32]*data.DataFile),
+		fileLock:   fileLock,
+		deadBytes:  make(map[uint32]int64),
+		activeTxns: make(map[uint64]int),
+	}
+}
+
+// load 加载数据文件并构建内存索引
+func (db *DB) load() error {
+
+	// 加载merge目录，如果有已经完成的merge，用merge生成的数据文件替换原来的数据文件
+	// 只读模式下不替换，原来的数据文件仍然是完整的
+	if !db.options.ReadOnly {
+		if err := db.loadMergeFiles(); err != nil {
+			return err
+		}
 	}
 
 	// 从磁盘中加载数据文件
 	if err := db.loadDataFiles(); err != nil {
-		return nil, err
+		return err
+	}
+
+	// 从索引快照文件中加载索引，快照覆盖的数据文件不需要再读取
+	if err := db.loadIndexFromHintFile(); err != nil {
+		return err
 	}
 
 	// 从数据文件中加载数据到内存索引
 	if err := db.loadIndexFromDataFiles(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return db, nil
+	// 只读模式下不需要切换IO类型，也不能截断数据文件
+	if db.options.ReadOnly {
+		return nil
+	}
+
+	// 加载完成之后将数据文件切换回标准文件IO，后续才能正常写入
+	if db.options.MMapAtStartup {
+		if err := db.resetIoType(); err != nil {
+			return err
+		}
+	}
+
+	// 截断活跃文件末尾写了一半的记录，否则新写入的数据会追加在损坏的数据之后
+	if err := db.truncateActiveFile(); err != nil {
+		return err
+	}
+
+	return db.rotateActiveFile()
+}
+
+// rotateActiveFile 活跃文件是旧版本的格式、没有加密或者使用的不是当前的密钥时，之后的数据写入新的活跃文件
+// 旧的数据文件仍然按照原来的格式和密钥读取，merge之后全部使用当前的格式和密钥重写
+func (db *DB) rotateActiveFile() error {
+	if db.activeFile == nil {
+		return nil
+	}
+	rotate := db.activeFile.Header().Version < data.FormatVersion
+	if keyProvider := db.options.Encryption.KeyProvider; keyProvider != nil {
+		keyID, ok := db.activeFile.KeyID()
+		rotate = rotate || !ok || keyID != keyProvider.ActiveKeyID()
+	}
+	if !rotate {
+		return nil
+	}
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	db.olderFiles[db.activeFile.FileId] = db.activeFile
+	return db.setActiveFile()
+}
+
+// resetIoType 将所有数据文件的IO类型设置为标准文件IO
+func (db *DB) resetIoType() error {
+	if db.activeFile == nil {
+		return nil
+	}
+	if err := db.activeFile.SetIOManager(db.options.DirPath, fio.StandardFIO); err != nil {
+		return err
+	}
+	for _, dataFile := range db.olderFiles {
+		if err := dataFile.SetIOManager(db.options.DirPath, fio.StandardFIO); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Put 添加kv数据到数据库,key不能为空
 func (db *DB) Put(key []byte, value []byte) error {
+	return db.put(key, value, 0)
+}
+
+// PutWithTTL 添加kv数据到数据库，数据在ttl之后过期，过期之后的key和不存在的key一样
+func (db *DB) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.put(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// put 写入kv数据，expire是过期时间的unix纳秒时间戳，0表示永不过期
+func (db *DB) put(key []byte, value []byte, expire int64) error {
 	// 检查key是否为空
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
 
-	// 构造logRecord结构体
+	// 构造logRecord结构体，非批量写入的数据不带序列号
 	logRecord := &data.LogRecord{
-		Key:   key,
-		Value: value,
-		Type:  data.LogRecordNormal,
+		Key:    key,
+		Value:  value,
+		Type:   data.LogRecordNormal,
+		Expire: expire,
 	}
 
 	// 将logRecord追加写入到文件中
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	pos, err := db.appendLogRecord(logRecord)
 	if err != nil {
 		return err
 	}
 
 	//更新内存索引
-	if ok := db.index.Put(key, pos); !ok {
-		return ErrIndexUpdateFailed
-	}
-
-	return nil
+	return db.updateIndex(key, data.LogRecordNormal, pos)
 }
 
 // Get 从数据库中获取key对应的value
@@ -95,20 +264,54 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
 		return nil, ErrKeyIsEmpty
 	}
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
 
-	// 从内存索引中获取数据在文件中的位置
+	// 从内存索引中获取数据在文件中的位置，已经过期的key当做不存在
 	pos := db.index.Get(key)
-	if pos == nil {
+	if pos == nil || pos.IsExpired(time.Now()) {
 		return nil, ErrKeyNotFound
 	}
 
-	// 根据文件id找到对应的数据文件
-	var dataFile *data.DataFile
-	if pos.Fid == db.activeFile.FileId {
-		dataFile = db.activeFile
-	} else {
-		dataFile = db.olderFiles[pos.Fid]
+	return db.getValueByPosition(pos)
+}
+
+// TTL 获取key剩余的存活时间，永不过期的key返回0，key不存在或者已经过期时返回ErrKeyNotFound
+func (db *DB) TTL(key []byte) (time.Duration, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if db.closed {
+		return 0, ErrDatabaseClosed
 	}
+
+	now := time.Now()
+	pos := db.index.Get(key)
+	if pos == nil || pos.IsExpired(now) {
+		return 0, ErrKeyNotFound
+	}
+	if pos.Expire == 0 {
+		return 0, nil
+	}
+	return time.Duration(pos.Expire - now.UnixNano()), nil
+}
+
+// getDataFile 根据文件id找到对应的数据文件，不存在时返回nil
+func (db *DB) getDataFile(fid uint32) *data.DataFile {
+	if db.activeFile != nil && fid == db.activeFile.FileId {
+		return db.activeFile
+	}
+	return db.olderFiles[fid]
+}
+
+// getValueByPosition 根据索引信息从数据文件中读取value，调用方需要持有db.lock
+func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
+	// 根据文件id找到对应的数据文件
+	dataFile := db.getDataFile(pos.Fid)
 	if dataFile == nil {
 		return nil, ErrDataFileNotFound
 	}
@@ -133,6 +336,9 @@ func (db *DB) Delete(key []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
 	// 先检查key是否存在，如果不存在，直接返回
 	if db.index.Get(key) == nil {
 		return nil
@@ -145,24 +351,164 @@ func (db *DB) Delete(key []byte) error {
 	}
 
 	// 写入磁盘数据文件
-	_, err := db.appendLogRecord(logRecord)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	pos, err := db.appendLogRecord(logRecord)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	// 更新内存索引
-	ok := db.index.Delete(key)
-	if !ok {
-		return ErrIndexUpdateFailed
+	return db.updateIndex(key, data.LogRecordDeleted, pos)
+}
+
+// ListKeys 获取数据库中所有的key，按照key从小到大排列
+func (db *DB) ListKeys() ([][]byte, error) {
+	if db.isClosed() {
+		return nil, ErrDatabaseClosed
+	}
+	var keys [][]byte
+	now := time.Now()
+	db.index.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+		if !pos.IsExpired(now) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, nil
+}
+
+// Fold 获取所有的数据，并执行用户指定的操作，函数返回false时终止遍历
+func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		return ErrDatabaseClosed
 	}
 
+	iterator := db.index.Iterator(false)
+	defer iterator.Close()
+	now := time.Now()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		if iterator.Value().IsExpired(now) {
+			continue
+		}
+		value, err := db.getValueByPosition(iterator.Value())
+		if err != nil {
+			return err
+		}
+		if !fn(iterator.Key(), value) {
+			break
+		}
+	}
 	return nil
 }
 
-// appendLogRecord 将logRecord追加写入到活跃文件中
-func (db *DB) appendLogRecord(record *data.LogRecord) (*data.LogRecordPos, error) {
+// Sync 将当前活跃文件持久化到磁盘
+// 当Options.SyncWrites为false时，用户可以通过Sync主动刷盘
+func (db *DB) Sync() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrDatabaseClosed
+	}
+	// 还没有写入过数据，没有需要持久化的内容
+	if db.activeFile == nil {
+		return nil
+	}
+	return db.activeFile.Sync()
+}
+
+// Close 关闭数据库，持久化活跃文件并关闭所有数据文件
+// 关闭之后再调用Put/Get/Delete会返回ErrDatabaseClosed，重复调用Close不会报错
+func (db *DB) Close() error {
+	// 先等待后台自动merge退出，merge过程中需要获取db.lock，不能在持有锁的时候等待
+	db.stopAutoMerge()
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return nil
+	}
+
+	db.closed = true
+
+	// 先持久化活跃文件，再为旧文件写入索引快照，加快下一次启动的速度
+	// 快照中没有最新位置在活跃文件中的key，活跃文件没有持久化时，这些key在旧文件中的版本也不会被加载，所以同步失败时不写入快照
+	// 快照只是用来加快启动，写入失败时下一次启动从数据文件重建索引，仍然需要关闭数据文件并释放文件锁
+	var errs []error
+	synced := true
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			errs = append(errs, err)
+			synced = false
+		}
+	}
+	if synced && len(db.olderFiles) > 0 && !db.options.ReadOnly && !db.options.InMemory {
+		fileIds := make([]uint32, 0, len(db.olderFiles))
+		for fid := range db.olderFiles {
+			fileIds = append(fileIds, fid)
+		}
+		if err := writeHintFile(db.options.DirPath, db.index, fileIds, db.seqNo, db.options.Encryption.KeyProvider); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// 关闭所有数据文件
+	if err := db.closeFiles(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// 释放数据目录的文件锁，内存模式下没有文件锁
+	if db.fileLock != nil {
+		if err := db.fileLock.Unlock(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeFiles 关闭活跃文件以及所有旧文件，某个文件关闭失败时仍然会关闭其他文件
+func (db *DB) closeFiles() error {
+	var errs []error
+	if db.activeFile != nil {
+		if err := db.activeFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, file := range db.olderFiles {
+		if err := file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isClosed 判断数据库是否已经关闭
+func (db *DB) isClosed() bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.closed
+}
+
+// appendLogRecordWithLock 加锁后将logRecord追加写入到活跃文件中
+func (db *DB) appendLogRecordWithLock(record *data.LogRecord) (*data.LogRecordPos, error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
+	return db.appendLogRecord(record)
+}
+
+// appendLogRecord 将logRecord追加写入到活跃文件中，调用方需要持有db.lock
+func (db *DB) appendLogRecord(record *data.LogRecord) (*data.LogRecordPos, error) {
+	// 数据库关闭之后不允许再写入
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
+	if db.options.ReadOnly {
+		return nil, ErrReadOnly
+	}
 
 	// 判断当前活跃文件是否存在，因为数据库在第一次写入之前是没有文件的
 	// 如果不存在则初始化活跃文件
@@ -172,8 +518,12 @@ func (db *DB) appendLogRecord(record *data.LogRecord) (*data.LogRecordPos, error
 		}
 	}
 
-	// 将record进行编码
-	encodedRecord, size := data.EncodeLogRecord(record)
+	// 将record进行编码，只压缩普通记录中足够长的value
+	record.Codec = data.CodecNone
+	if record.Type == data.LogRecordNormal && len(record.Value) >= db.options.CompressionThreshold {
+		record.Codec = db.options.Compression
+	}
+	encodedRecord, size := db.activeFile.EncodeLogRecord(record)
 
 	// 如果写入数据长度已经达到了活跃文件的最大长度，则关闭活跃文件，打开新的文件并写入新文件
 	if db.activeFile.WriteOff+size > db.options.DataFileSize {
@@ -185,26 +535,25 @@ func (db *DB) appendLogRecord(record *data.LogRecord) (*data.LogRecordPos, error
 		// 将活跃文件加入到旧文件中
 		db.olderFiles[db.activeFile.FileId] = db.activeFile
 
-		// 打开新的活跃文件
+		// 打开新的活跃文件，加密时每个数据文件的nonce前缀不同，需要重新编码
 		if err := db.setActiveFile(); err != nil {
 			return nil, err
 		}
-
+		encodedRecord, size = db.activeFile.EncodeLogRecord(record)
 	}
 
-	// 写入活跃文件
+	// 写入活跃文件，DataFile.Write会更新活跃文件的写入偏移
 	writeOff := db.activeFile.WriteOff
 	// 这里的写入是追加写入，所以不需要偏移
 	if err := db.activeFile.Write(encodedRecord); err != nil {
 		return nil, err
 	}
 
-	// 更新活跃文件的写入偏移
-	db.activeFile.WriteOff += size
-
 	// 根据用户配置，是否将数据持久化到磁盘
+	// 持久化失败时截断这条记录，否则写入失败的数据可能在重启之后重新出现
 	if db.options.SyncWrites {
 		if err := db.activeFile.Sync(); err != nil {
+			_ = db.activeFile.Truncate(writeOff)
 			return nil, err
 		}
 	}
@@ -213,6 +562,8 @@ func (db *DB) appendLogRecord(record *data.LogRecord) (*data.LogRecordPos, error
 	pos := &data.LogRecordPos{
 		Fid:    db.activeFile.FileId,
 		Offset: writeOff,
+		Size:   uint32(size),
+		Expire: record.Expire,
 	}
 
 	return pos, nil
@@ -230,7 +581,7 @@ func (db *DB) setActiveFile() error {
 	}
 
 	// 创建新的数据文件
-	dataFile, err := data.OpenDataFile(db.options.DirPath, initialFileId)
+	dataFile, err := db.openDataFile(initialFileId, fio.StandardFIO)
 	if err != nil {
 		return err
 	}
@@ -241,6 +592,28 @@ func (db *DB) setActiveFile() error {
 
 }
 
+// openDataFile 打开数据目录中的数据文件，使用配置的IOManagerFactory创建IOManager
+// 内存模式下数据文件只保存在内存中
+func (db *DB) openDataFile(fileId uint32, ioType fio.FileIOType) (*data.DataFile, error) {
+	if db.options.InMemory {
+		ioType = fio.MemoryIO
+	}
+	return data.OpenDataFileWithOptions(db.options.DirPath, fileId, ioType, data.DataFileOptions{
+		NewIOManager: db.options.IOManagerFactory,
+		KeyProvider:  db.options.Encryption.KeyProvider,
+		Fingerprint:  optionsFingerprint(db.options),
+		Checksum:     db.options.Checksum,
+	})
+}
+
+// optionsFingerprint 计算影响数据文件写入格式的配置项的指纹，记录在新的数据文件头中
+func optionsFingerprint(options Options) uint64 {
+	hash := fnv.New64a()
+	_, _ = fmt.Fprintf(hash, "data-file-size=%d;compression=%d;compression-threshold=%d;encryption=%t;checksum=%d",
+		options.DataFileSize, options.Compression, options.CompressionThreshold, options.Encryption.KeyProvider != nil, options.Checksum)
+	return hash.Sum64()
+}
+
 // loadDataFiles 从磁盘中加载数据文件
 func (db *DB) loadDataFiles() error {
 	dirEntries, err := os.ReadDir(db.options.DirPath)
@@ -269,9 +642,15 @@ func (db *DB) loadDataFiles() error {
 
 	db.fileIds = fileIds
 
+	// 启动时可以使用MMap加速数据文件的读取，只读模式下一直使用MMap，不需要以写的方式打开数据文件
+	ioType := fio.StandardFIO
+	if db.options.MMapAtStartup || db.options.ReadOnly {
+		ioType = fio.MemoryMap
+	}
+
 	// 遍历文件id，打开数据文件
 	for i, fid := range fileIds {
-		dataFile, err := data.OpenDataFile(db.options.DirPath, uint32(fid))
+		dataFile, err := db.openDataFile(uint32(fid), ioType)
 		if err != nil {
 			return err
 		}
@@ -295,6 +674,11 @@ func (db *DB) loadIndexFromDataFiles() error {
 		return nil
 	}
 
+	// 暂存批量写入的数据，key是序列号
+	transactionRecords := make(map[uint64][]*data.TransactionRecord)
+	var currentSeqNo = db.seqNo
+	now := time.Now()
+
 	// 遍历所有文件，处理文件中的记录,fileIds是按照文件id递增排序的
 	for _, fid := range db.fileIds {
 		var fileId = uint32(fid)
@@ -305,29 +689,63 @@ func (db *DB) loadIndexFromDataFiles() error {
 			dataFile = db.olderFiles[fileId]
 		}
 
+		// 索引快照中已经包含了这个文件的索引，不需要再读取，活跃文件需要读取来确定WriteOff
+		if db.hintFileIds[fileId] && fileId != db.activeFile.FileId {
+			continue
+		}
+
 		// 处理文件中的记录
 		var offset int64 = 0
 		for {
 			record, size, err := dataFile.ReadLogRecord(offset)
 			if err != nil { //读文件err
-				if err == io.EOF { //读到文件末尾,正常情况，跳出本次循环
+				if err == io.EOF && offset >= dataFile.WriteOff { //读到文件末尾,正常情况，跳出本次循环
 					break
 				}
-				return err
+				// 没有读到文件末尾，说明数据已经损坏，根据恢复策略处理
+				if offset, err = db.recoverCorruption(dataFile, offset, err); err != nil {
+					return err
+				}
+				continue
 			}
 
 			// 构建内存索引并保存
-			logRecordPos := &data.LogRecordPos{Fid: fileId, Offset: offset}
-			var ok bool
-			// 如果是已经被删除的数据，则从内存索引中删除
-			if record.Type == data.LogRecordDeleted {
-				ok = db.index.Delete(record.Key)
+			logRecordPos := &data.LogRecordPos{Fid: fileId, Offset: offset, Size: uint32(size), Expire: record.Expire}
+			// 已经过期的数据和删除一样，旧的数据以及这条记录本身都是无效数据
+			if record.Type == data.LogRecordNormal && logRecordPos.IsExpired(now) {
+				record.Type = data.LogRecordDeleted
+			}
+
+			// 只有批量写入的记录带有序列号
+			seqNo := record.SeqNo
+			if seqNo == nonTransactionSeqNo {
+				// 非批量写入的数据，直接更新内存索引
+				if err := db.updateIndex(record.Key, record.Type, logRecordPos); err != nil {
+					return err
+				}
+			} else if record.Type == data.LogRecordTxnFinished {
+				// 完成标识本身是无效数据
+				db.addDeadBytes(fileId, size)
+				// 批量写入完成，将这一批的数据更新到内存索引中
+				for _, txnRecord := range transactionRecords[seqNo] {
+					if err := db.updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos); err != nil {
+						return err
+					}
+				}
+				delete(transactionRecords, seqNo)
 			} else {
-				ok = db.index.Put(record.Key, logRecordPos)
+				// 批量写入的数据，先暂存起来，读到完成标识之后再更新索引
+				transactionRecords[seqNo] = append(transactionRecords[seqNo], &data.TransactionRecord{
+					Record: record,
+					Pos:    logRecordPos,
+				})
 			}
-			if !ok {
-				return ErrIndexUpdateFailed
+
+			// 更新最大的序列号
+			if seqNo > currentSeqNo {
+				currentSeqNo = seqNo
 			}
+
 			// 更新offset，下一次从新的位置读取
 			offset += size
 		}
@@ -338,12 +756,55 @@ func (db *DB) loadIndexFromDataFiles() error {
 		}
 
 	}
+
+	// 没有完成的批量写入永远不会生效，也是无效数据
+	for _, txnRecords := range transactionRecords {
+		for _, txnRecord := range txnRecords {
+			db.addDeadBytes(txnRecord.Pos.Fid, int64(txnRecord.Pos.Size))
+		}
+	}
+
+	// 更新序列号，后续的批量写入从这里继续递增
+	db.seqNo = currentSeqNo
+	return nil
+}
+
+// addDeadBytes 累加数据文件中的无效数据量
+func (db *DB) addDeadBytes(fid uint32, size int64) {
+	db.deadBytes[fid] += size
+	db.reclaimSize += size
+}
+
+// updateIndex 根据记录类型更新内存索引，同时累加可以被merge清理的数据量
+func (db *DB) updateIndex(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) error {
+	// 旧的数据被覆盖或者删除之后就变成了无效数据
+	oldPos := db.index.Get(key)
+	if oldPos != nil {
+		db.addDeadBytes(oldPos.Fid, int64(oldPos.Size))
+	}
+	db.txnTs++
+	if len(db.activeTxns) > 0 {
+		db.recordVersion(key, oldPos)
+	}
+
+	// 如果是已经被删除的数据，则从内存索引中删除
+	if typ == data.LogRecordDeleted {
+		// 被删除的key可能本来就不在索引中，这里不需要判断返回值
+		db.index.Delete(key)
+		// 删除标记本身也是无效数据
+		db.addDeadBytes(pos.Fid, int64(pos.Size))
+		return nil
+	}
+	if ok := db.index.Put(key, pos); !ok {
+		return ErrIndexUpdateFailed
+	}
 	return nil
 }
 
 func checkOptions(options Options) error {
 
-	if options.DirPath == "" {
+	// 内存模式下不使用数据目录
+	if options.DirPath == "" && !options.InMemory {
 		return ErrDirPathIsEmpty
 	}
 
@@ -351,6 +812,29 @@ func checkOptions(options Options) error {
 		return ErrDataFileSizeZero
 	}
 
+	if options.MergeRatio < 0 || options.MergeRatio > 1 {
+		return ErrInvalidMergeRatio
+	}
+
+	if options.RecoveryPolicy < RecoveryTruncate || options.RecoveryPolicy > RecoverySkip {
+		return ErrInvalidRecoveryPolicy
+	}
+
+	if options.Compression > LZCompression || options.CompressionThreshold < 0 {
+		return ErrInvalidCompression
+	}
+
+	if keyProvider := options.Encryption.KeyProvider; keyProvider != nil {
+		key, err := keyProvider.Key(keyProvider.ActiveKeyID())
+		if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+			return ErrInvalidEncryptionKey
+		}
+	}
+
+	if options.Checksum > ChecksumIEEE {
+		return ErrInvalidChecksum
+	}
+
 	if options.IndexType == 0 {
 		// 如果用户没有设置索引类型，则默认使用Btree
 		options.IndexType = Btree
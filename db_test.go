@@ -1,13 +1,20 @@
 package sirius
 
 import (
+	"Sirius/data"
+	"Sirius/fio/fiotest"
 	"Sirius/index"
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestOpen(t *testing.T) {
@@ -58,6 +65,7 @@ func TestOpen(t *testing.T) {
 			assert.NotNil(t, db)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantDB.options, tc.option)
+			assert.Nil(t, db.Close())
 		})
 
 	}
@@ -104,6 +112,7 @@ func TestDB_Put(t *testing.T) {
 				assert.NotNil(t, db)
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 检查数据是否被覆盖
@@ -112,6 +121,7 @@ func TestDB_Put(t *testing.T) {
 				value, err2 := db.Get([]byte("hello"))
 				assert.Equal(t, []byte("world"), value)
 				assert.Nil(t, err2)
+				assert.Nil(t, db.Close())
 				// 销毁测试数据文件
 				// 删除所有以.data结尾的文件
 				files, err := os.ReadDir(os.TempDir())
@@ -162,12 +172,13 @@ func TestDB_Put(t *testing.T) {
 				assert.Nil(t, err)
 				assert.NotNil(t, db)
 				for i := 0; i < 1000000; i++ {
-					// 循环插入128字节的key
-					value := make([]byte, 128)
+					// 循环插入256字节的value，总数据量超过一个数据文件的大小
+					value := make([]byte, 256)
 					err2 := db.Put([]byte(fmt.Sprintf("%v,%d", "key_", i)), value)
 					assert.Nil(t, err2)
 				}
 				assert.Greater(t, len(db.olderFiles), 0)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 销毁测试数据文件
@@ -188,14 +199,13 @@ func TestDB_Put(t *testing.T) {
 		{
 			name: "重启之后再进行Put",
 			before: func(t *testing.T) {
-				// 这里使用db.activeFile.Close()模拟关闭数据库
+				// 关闭数据库，模拟重启
 				db, err := Open(DefaultOptions)
 				assert.Nil(t, err)
 				assert.NotNil(t, db)
-				// 这里要先进行Put，否则activeFile为nil
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
-				err = db.activeFile.Close()
+				err = db.Close()
 				assert.Nil(t, err)
 			},
 			after: func(t *testing.T) {
@@ -206,6 +216,7 @@ func TestDB_Put(t *testing.T) {
 				value, err1 := db.Get([]byte("hello"))
 				assert.Equal(t, []byte("world"), value)
 				assert.Nil(t, err1)
+				assert.Nil(t, db.Close())
 				// 销毁测试数据文件
 				err2 := os.Remove(filepath.Join(os.TempDir(), fmt.Sprintf("%09d", 0)+".data"))
 				assert.Nil(t, err2)
@@ -222,6 +233,7 @@ func TestDB_Put(t *testing.T) {
 			db, _ := Open(DefaultOptions)
 			err := db.Put(tc.key, tc.value)
 			assert.Equal(t, tc.wantErr, err)
+			assert.Nil(t, db.Close())
 			tc.after(t)
 		})
 
@@ -249,6 +261,7 @@ func TestDB_Get(t *testing.T) {
 				assert.NotNil(t, db)
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 删除所有以.data结尾的文件
@@ -285,6 +298,7 @@ func TestDB_Get(t *testing.T) {
 				err3 := db.Put([]byte("hello"), []byte("world"))
 				assert.Nil(t, err2)
 				assert.Nil(t, err3)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 删除所有以.data结尾的文件
@@ -313,6 +327,7 @@ func TestDB_Get(t *testing.T) {
 				// 删除数据
 				err3 := db.Delete([]byte("hello"))
 				assert.Nil(t, err3)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 删除所有以.data结尾的文件
@@ -339,12 +354,13 @@ func TestDB_Get(t *testing.T) {
 				err = db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err)
 				for i := 0; i < 1000000; i++ {
-					// 循环插入128字节的key
-					value := make([]byte, 128)
+					// 循环插入256字节的value，总数据量超过一个数据文件的大小
+					value := make([]byte, 256)
 					err2 := db.Put([]byte(fmt.Sprintf("%v,%d", "key_", i)), value)
 					assert.Nil(t, err2)
 				}
 				assert.Greater(t, len(db.olderFiles), 0)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 删除所有以.data结尾的文件
@@ -364,14 +380,13 @@ func TestDB_Get(t *testing.T) {
 		{
 			name: "重启之后再进行Get",
 			before: func(t *testing.T) {
-				// 这里使用db.activeFile.Close()模拟关闭数据库
+				// 关闭数据库，模拟重启
 				db, err := Open(DefaultOptions)
 				assert.Nil(t, err)
 				assert.NotNil(t, db)
-				// 这里要先进行Put，否则activeFile为nil
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
-				err = db.activeFile.Close()
+				err = db.Close()
 				assert.Nil(t, err)
 			},
 			after: func(t *testing.T) {
@@ -382,6 +397,7 @@ func TestDB_Get(t *testing.T) {
 				value, err1 := db.Get([]byte("hello"))
 				assert.Equal(t, []byte("sirius"), value)
 				assert.Nil(t, err1)
+				assert.Nil(t, db.Close())
 				// 删除所有以.data结尾的文件
 				files, err2 := os.ReadDir(os.TempDir())
 				assert.Nil(t, err2)
@@ -405,6 +421,7 @@ func TestDB_Get(t *testing.T) {
 			value, err := db.Get(tc.inputKey)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantValue, value)
+			assert.Nil(t, db.Close())
 			tc.after(t)
 		})
 
@@ -428,6 +445,7 @@ func TestDB_Delete(t *testing.T) {
 				assert.NotNil(t, db)
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 检查数据是否被删除
@@ -438,6 +456,7 @@ func TestDB_Delete(t *testing.T) {
 				assert.Nil(t, value)
 				assert.Equal(t, ErrKeyNotFound, err2)
 
+				assert.Nil(t, db.Close())
 				// 删除所有以.data结尾的文件
 				files, err3 := os.ReadDir(os.TempDir())
 				assert.Nil(t, err3)
@@ -479,6 +498,7 @@ func TestDB_Delete(t *testing.T) {
 				assert.NotNil(t, db)
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 检查数据是否被删除
@@ -496,6 +516,7 @@ func TestDB_Delete(t *testing.T) {
 				assert.Equal(t, []byte("world"), value2)
 				assert.Nil(t, err4)
 
+				assert.Nil(t, db.Close())
 				// 删除所有以.data结尾的文件
 				files, err3 := os.ReadDir(os.TempDir())
 				assert.Nil(t, err3)
@@ -518,6 +539,7 @@ func TestDB_Delete(t *testing.T) {
 				assert.NotNil(t, db)
 				err2 := db.Put([]byte("hello"), []byte("sirius"))
 				assert.Nil(t, err2)
+				assert.Nil(t, db.Close())
 			},
 			after: func(t *testing.T) {
 				// 检查数据是否被删除
@@ -530,9 +552,11 @@ func TestDB_Delete(t *testing.T) {
 				// 再进行Put
 				err3 := db.Put([]byte("hi"), []byte("world"))
 				assert.Nil(t, err3)
-				// close
-				err4 := db.activeFile.Close()
+				// 关闭之后重新打开
+				err4 := db.Close()
 				assert.Nil(t, err4)
+				db, err = Open(DefaultOptions)
+				assert.Nil(t, err)
 
 				// 检查是否能读取到删除的数据
 				value2, err5 := db.Get([]byte("hello"))
@@ -540,6 +564,7 @@ func TestDB_Delete(t *testing.T) {
 				assert.Equal(t, []byte(nil), value2)
 				assert.Equal(t, ErrKeyNotFound, err5)
 
+				assert.Nil(t, db.Close())
 				// 删除所有以.data结尾的文件
 				files, err3 := os.ReadDir(os.TempDir())
 				assert.Nil(t, err3)
@@ -561,8 +586,843 @@ func TestDB_Delete(t *testing.T) {
 			db, _ := Open(DefaultOptions)
 			err := db.Delete(tc.inputKey)
 			assert.Equal(t, tc.wantErr, err)
+			assert.Nil(t, db.Close())
 			tc.after(t)
 		})
 
 	}
 }
+
+func TestDB_Sync(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, db *DB)
+
+		wantErr error
+	}{
+		{
+			name:    "没有写入数据时Sync",
+			before:  func(t *testing.T, db *DB) {},
+			wantErr: nil,
+		},
+		{
+			name: "写入数据后Sync",
+			before: func(t *testing.T, db *DB) {
+				err := db.Put([]byte("hello"), []byte("sirius"))
+				assert.Nil(t, err)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "关闭之后Sync",
+			before: func(t *testing.T, db *DB) {
+				err := db.Close()
+				assert.Nil(t, err)
+			},
+			wantErr: ErrDatabaseClosed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-sync")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			tc.before(t, db)
+			err = db.Sync()
+			assert.Equal(t, tc.wantErr, err)
+			_ = db.Close()
+		})
+	}
+}
+
+func TestDB_Close(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, db *DB)
+		after  func(t *testing.T, db *DB)
+
+		wantErr error
+	}{
+		{
+			name:    "关闭空数据库",
+			before:  func(t *testing.T, db *DB) {},
+			after:   func(t *testing.T, db *DB) {},
+			wantErr: nil,
+		},
+		{
+			name: "关闭之后读写返回ErrDatabaseClosed",
+			before: func(t *testing.T, db *DB) {
+				err := db.Put([]byte("hello"), []byte("sirius"))
+				assert.Nil(t, err)
+			},
+			after: func(t *testing.T, db *DB) {
+				err := db.Put([]byte("hello"), []byte("world"))
+				assert.Equal(t, ErrDatabaseClosed, err)
+				value, err := db.Get([]byte("hello"))
+				assert.Nil(t, value)
+				assert.Equal(t, ErrDatabaseClosed, err)
+				err = db.Delete([]byte("hello"))
+				assert.Equal(t, ErrDatabaseClosed, err)
+				// 重复关闭不会报错
+				err = db.Close()
+				assert.Nil(t, err)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "关闭之后重新打开",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 1000; i++ {
+					err := db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("sirius"))
+					assert.Nil(t, err)
+				}
+				assert.Greater(t, len(db.olderFiles), 0)
+			},
+			after: func(t *testing.T, db *DB) {
+				db2, err := Open(db.options)
+				assert.Nil(t, err)
+				for i := 0; i < 1000; i++ {
+					value, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+					assert.Nil(t, err)
+					assert.Equal(t, []byte("sirius"), value)
+				}
+				err = db2.Close()
+				assert.Nil(t, err)
+			},
+			wantErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-close")
+			opts.DataFileSize = 4 * 1024
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			tc.before(t, db)
+			err = db.Close()
+			assert.Equal(t, tc.wantErr, err)
+			tc.after(t, db)
+		})
+	}
+}
+
+func TestDB_CloseHintFailed(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-close-hint")
+	opts.DataFileSize = 4 * 1024
+	defer os.RemoveAll(opts.DirPath)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("sirius")))
+	}
+
+	// 索引快照的位置被一个非空目录占用，写入索引快照失败
+	hintFileName := filepath.Join(opts.DirPath, data.HintFileName)
+	assert.Nil(t, os.MkdirAll(filepath.Join(hintFileName, "dir"), os.ModePerm))
+	assert.NotNil(t, db.Close())
+
+	// 写入快照失败时仍然关闭了数据库并释放了文件锁
+	assert.Equal(t, ErrDatabaseClosed, db.Put([]byte("key"), []byte("value")))
+	assert.Nil(t, os.RemoveAll(hintFileName))
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("sirius"), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_CloseSyncFailed(t *testing.T) {
+	fs := fiotest.NewFaultFS(1)
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-close-sync")
+	opts.DataFileSize = 4 * 1024
+	opts.IOManagerFactory = fs.NewIOManager
+	defer os.RemoveAll(opts.DirPath)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("old")))
+	}
+	assert.Nil(t, db.Sync())
+	// 覆盖写的数据都在活跃文件中，还没有持久化
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("new")))
+	}
+
+	// 关闭时持久化活跃文件之前断电，不能写入索引快照，否则旧文件中的版本不会被加载
+	fs.PowerCutAfter(0)
+	assert.ErrorIs(t, db.Close(), fiotest.ErrCrashed)
+	_, err = os.Stat(filepath.Join(opts.DirPath, data.HintFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Contains(t, []string{"old", "new"}, string(value))
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_IndexType(t *testing.T) {
+	testCases := []struct {
+		name          string
+		indexType     IndexType
+		mmapAtStartup bool
+	}{
+		{
+			name:      "使用BTree索引",
+			indexType: Btree,
+		},
+		{
+			name:      "使用ART索引",
+			indexType: ART,
+		},
+		{
+			name:          "启动时使用MMap加载数据文件",
+			indexType:     Btree,
+			mmapAtStartup: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-index-type")
+			opts.IndexType = tc.indexType
+			opts.MMapAtStartup = tc.mmapAtStartup
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, db.Put([]byte(fmt.Sprintf("user:%d", i)), []byte("sirius")))
+			}
+			assert.Nil(t, db.Delete([]byte("user:1")))
+			assert.Nil(t, db.Close())
+
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			_, err = db.Get([]byte("user:1"))
+			assert.Equal(t, ErrKeyNotFound, err)
+			value, err := db.Get([]byte("user:10"))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("sirius"), value)
+			// 重启之后可以继续写入
+			assert.Nil(t, db.Put([]byte("user:1"), []byte("sirius")))
+			assert.Nil(t, db.Close())
+		})
+	}
+}
+
+func TestDB_ListKeys(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, db *DB)
+
+		wantKeys [][]byte
+		wantErr  error
+	}{
+		{
+			name:     "空数据库",
+			before:   func(t *testing.T, db *DB) {},
+			wantKeys: nil,
+		},
+		{
+			name: "按照key有序返回，不包含被删除的key",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("c"), []byte("3")))
+				assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, db.Put([]byte("b"), []byte("2")))
+				assert.Nil(t, db.Delete([]byte("b")))
+			},
+			wantKeys: [][]byte{[]byte("a"), []byte("c")},
+		},
+		{
+			name: "数据库已关闭",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Close())
+			},
+			wantKeys: nil,
+			wantErr:  ErrDatabaseClosed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-list-keys")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer db.Close()
+			tc.before(t, db)
+			keys, err := db.ListKeys()
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantKeys, keys)
+		})
+	}
+}
+
+func TestDB_Fold(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stopAt string
+
+		wantPairs []string
+	}{
+		{
+			name:      "遍历所有数据",
+			wantPairs: []string{"a=1", "b=2-new", "d=4"},
+		},
+		{
+			name:      "函数返回false时终止遍历",
+			stopAt:    "b",
+			wantPairs: []string{"a=1", "b=2-new"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-fold")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer db.Close()
+			for _, kv := range [][2]string{{"d", "4"}, {"a", "1"}, {"b", "2"}, {"c", "3"}, {"b", "2-new"}} {
+				assert.Nil(t, db.Put([]byte(kv[0]), []byte(kv[1])))
+			}
+			assert.Nil(t, db.Delete([]byte("c")))
+
+			var gotPairs []string
+			err = db.Fold(func(key []byte, value []byte) bool {
+				gotPairs = append(gotPairs, fmt.Sprintf("%s=%s", key, value))
+				return string(key) != tc.stopAt
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantPairs, gotPairs)
+		})
+	}
+}
+
+// encodeBaselineRecord 按照最初版本的格式编码记录：没有文件头，key前面没有序列号
+func encodeBaselineRecord(key []byte, value []byte, recordType data.LogRecordType) []byte {
+	buf := make([]byte, 5+2*binary.MaxVarintLen32)
+	buf[4] = recordType
+	index := 5
+	index += binary.PutVarint(buf[index:], int64(len(key)))
+	index += binary.PutVarint(buf[index:], int64(len(value)))
+	buf = append(append(buf[:index], key...), value...)
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+func TestDB_OpenBaselineFormat(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-baseline")
+	defer os.RemoveAll(opts.DirPath)
+	assert.Nil(t, os.MkdirAll(opts.DirPath, os.ModePerm))
+
+	// 最初版本写入的数据目录，"alpha"的第一个字节不能被当成序列号
+	var content []byte
+	content = append(content, encodeBaselineRecord([]byte("alpha"), []byte("1"), data.LogRecordNormal)...)
+	content = append(content, encodeBaselineRecord([]byte("beta"), []byte("2"), data.LogRecordNormal)...)
+	content = append(content, encodeBaselineRecord([]byte("gamma"), []byte("3"), data.LogRecordNormal)...)
+	content = append(content, encodeBaselineRecord([]byte("alpha"), []byte("4"), data.LogRecordNormal)...)
+	content = append(content, encodeBaselineRecord([]byte("gamma"), nil, data.LogRecordDeleted)...)
+	assert.Nil(t, os.WriteFile(data.GetDataFileName(opts.DirPath, 0), content, 0644))
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	value, err := db.Get([]byte("alpha"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("4"), value)
+	value, err = db.Get([]byte("beta"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), value)
+	_, err = db.Get([]byte("gamma"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("alpha"), []byte("beta")}, keys)
+
+	// 只有被覆盖和删除的记录是无效数据，merge之后有效数据不会丢失
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	deadSize := len(encodeBaselineRecord([]byte("alpha"), []byte("1"), data.LogRecordNormal)) +
+		len(encodeBaselineRecord([]byte("gamma"), []byte("3"), data.LogRecordNormal)) +
+		len(encodeBaselineRecord([]byte("gamma"), nil, data.LogRecordDeleted))
+	assert.Equal(t, int64(deadSize), stat.ReclaimableSize)
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	keys, err = db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("alpha"), []byte("beta")}, keys)
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_FileLock(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-flock")
+	defer os.RemoveAll(opts.DirPath)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	// 数据目录已经被使用，不能再次打开
+	db2, err := Open(opts)
+	assert.Nil(t, db2)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+
+	// 关闭之后释放文件锁，可以重新打开
+	assert.Nil(t, db.Close())
+	db2, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_PutWithTTL(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 写入数据
+		before func(t *testing.T, db *DB)
+		// 重启之前以及重启之后都需要校验
+		check func(t *testing.T, db *DB)
+	}{
+		{
+			name: "ttl不合法",
+			before: func(t *testing.T, db *DB) {
+				assert.Equal(t, ErrInvalidTTL, db.PutWithTTL([]byte("key"), []byte("value"), 0))
+			},
+			check: func(t *testing.T, db *DB) {
+				_, err := db.Get([]byte("key"))
+				assert.Equal(t, ErrKeyNotFound, err)
+			},
+		},
+		{
+			name: "没有过期的key",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.PutWithTTL([]byte("key"), []byte("value"), time.Hour))
+				assert.Nil(t, db.Put([]byte("forever"), []byte("value")))
+			},
+			check: func(t *testing.T, db *DB) {
+				value, err := db.Get([]byte("key"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("value"), value)
+				ttl, err := db.TTL([]byte("key"))
+				assert.Nil(t, err)
+				assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+				// 永不过期的key返回0
+				ttl, err = db.TTL([]byte("forever"))
+				assert.Nil(t, err)
+				assert.Equal(t, time.Duration(0), ttl)
+			},
+		},
+		{
+			name: "已经过期的key",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, db.PutWithTTL([]byte("b"), []byte("2"), time.Millisecond))
+				// 过期的数据覆盖了旧的数据，旧的数据也不再可见
+				assert.Nil(t, db.Put([]byte("c"), []byte("3")))
+				assert.Nil(t, db.PutWithTTL([]byte("c"), []byte("4"), time.Millisecond))
+				time.Sleep(5 * time.Millisecond)
+			},
+			check: func(t *testing.T, db *DB) {
+				for _, key := range []string{"b", "c"} {
+					_, err := db.Get([]byte(key))
+					assert.Equal(t, ErrKeyNotFound, err)
+					_, err = db.TTL([]byte(key))
+					assert.Equal(t, ErrKeyNotFound, err)
+				}
+				keys, err := db.ListKeys()
+				assert.Nil(t, err)
+				assert.Equal(t, [][]byte{[]byte("a")}, keys)
+
+				iter := db.NewIterator(DefaultIteratorOptions)
+				defer iter.Close()
+				var iterKeys [][]byte
+				for iter.Rewind(); iter.Valid(); iter.Next() {
+					iterKeys = append(iterKeys, iter.Key())
+				}
+				assert.Equal(t, [][]byte{[]byte("a")}, iterKeys)
+			},
+		},
+		{
+			name: "重新写入之后不再过期",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.PutWithTTL([]byte("key"), []byte("v1"), time.Millisecond))
+				assert.Nil(t, db.Put([]byte("key"), []byte("v2")))
+				time.Sleep(5 * time.Millisecond)
+			},
+			check: func(t *testing.T, db *DB) {
+				value, err := db.Get([]byte("key"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("v2"), value)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-ttl")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			tc.before(t, db)
+			tc.check(t, db)
+			assert.Nil(t, db.Close())
+
+			// 重启之后从数据文件以及索引快照中重建索引
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			tc.check(t, db)
+			assert.Nil(t, db.Close())
+		})
+	}
+}
+
+func TestDB_ReadOnlyLock(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-read-only-lock")
+	defer os.RemoveAll(opts.DirPath)
+	readOnlyOpts := opts
+	readOnlyOpts.ReadOnly = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.Nil(t, db.Close())
+
+	// 没有锁文件时只读模式直接打开，不会创建锁文件
+	lockFileName := filepath.Join(opts.DirPath, fileLockName)
+	assert.Nil(t, os.Remove(lockFileName))
+	db, err = Open(readOnlyOpts)
+	assert.Nil(t, err)
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, db.Close())
+	_, err = os.Stat(lockFileName)
+	assert.True(t, os.IsNotExist(err))
+
+	// 多个只读实例可以同时打开，但是不能和写入的实例同时打开
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	_, err = Open(readOnlyOpts)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+	assert.Nil(t, db.Close())
+
+	reader1, err := Open(readOnlyOpts)
+	assert.Nil(t, err)
+	reader2, err := Open(readOnlyOpts)
+	assert.Nil(t, err)
+	_, err = Open(opts)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+	assert.Nil(t, reader1.Close())
+	assert.Nil(t, reader2.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_ReadOnly(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-read-only")
+	opts.DataFileSize = 4 * 1024
+	defer os.RemoveAll(opts.DirPath)
+
+	// 只读模式下数据目录不存在时不会创建
+	readOnlyOpts := opts
+	readOnlyOpts.ReadOnly = true
+	_, err := Open(readOnlyOpts)
+	assert.True(t, os.IsNotExist(err))
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Close())
+	entries, err := os.ReadDir(opts.DirPath)
+	assert.Nil(t, err)
+
+	db, err = Open(readOnlyOpts)
+	assert.Nil(t, err)
+	value, err := db.Get([]byte("key_1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value_1"), value)
+	assert.Equal(t, ErrReadOnly, db.Put([]byte("key_1"), []byte("new")))
+	assert.Equal(t, ErrReadOnly, db.Delete([]byte("key_1")))
+	assert.Equal(t, ErrReadOnly, db.Merge())
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("key_1"), []byte("new")))
+	assert.Equal(t, ErrReadOnly, wb.Commit())
+	assert.Nil(t, db.Close())
+
+	// 只读模式不会修改数据目录中的文件
+	entriesAfter, err := os.ReadDir(opts.DirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, len(entries), len(entriesAfter))
+	for i, entry := range entries {
+		info, _ := entry.Info()
+		infoAfter, _ := entriesAfter[i].Info()
+		assert.Equal(t, info.Name(), infoAfter.Name())
+		assert.Equal(t, info.Size(), infoAfter.Size())
+	}
+}
+
+func TestDB_InMemory(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = ""
+	opts.InMemory = true
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	// 写入足够多的数据，产生多个数据文件
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, db.Delete([]byte(fmt.Sprintf("key_%d", i))))
+	}
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(500), stat.KeyNum)
+	assert.True(t, stat.DataFileNum > 1)
+	assert.True(t, stat.ReclaimableSize > 0)
+
+	// 有正在使用的迭代器时merge的结果会被丢弃
+	iter := db.NewIterator(DefaultIteratorOptions)
+	assert.Equal(t, ErrMergeDiscarded, db.Merge())
+	iter.Close()
+
+	// merge之后直接替换内存中的数据文件
+	assert.Nil(t, db.Merge())
+	mergedStat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(500), mergedStat.KeyNum)
+	assert.Equal(t, int64(0), mergedStat.ReclaimableSize)
+	assert.True(t, mergedStat.DiskSize < stat.DiskSize)
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		if i < 500 {
+			assert.Equal(t, ErrKeyNotFound, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+		}
+	}
+	// merge之后可以继续写入
+	assert.Nil(t, db.Put([]byte("key_0"), []byte("new")))
+	value, err := db.Get([]byte("key_0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), value)
+	assert.Nil(t, db.Close())
+
+	// 重新打开之后是一个空数据库
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	_, err = db.Get([]byte("key_0"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_Compression(t *testing.T) {
+	testCases := []struct {
+		name        string
+		compression Compression
+	}{
+		{name: "flate压缩", compression: FlateCompression},
+		{name: "lz压缩", compression: LZCompression},
+	}
+
+	jsonValue := func(i int) []byte {
+		return []byte(strings.Repeat(fmt.Sprintf(`{"id":%d,"name":"zhangsan","tags":["a","b"]},`, i), 20))
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-compression")
+			defer os.RemoveAll(opts.DirPath)
+
+			// 先写入一部分不压缩的数据
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), jsonValue(i)))
+			}
+			stat, err := db.Stat()
+			assert.Nil(t, err)
+			assert.Nil(t, db.Close())
+
+			// 打开压缩之后旧的数据仍然可以读取，新写入的数据占用的空间更小
+			opts.Compression = tc.compression
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			for i := 100; i < 200; i++ {
+				assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), jsonValue(i)))
+			}
+			// 小于阈值的value不压缩
+			assert.Nil(t, db.Put([]byte("small"), []byte("value")))
+			compressedStat, err := db.Stat()
+			assert.Nil(t, err)
+			assert.Less(t, (compressedStat.DiskSize-stat.DiskSize)*3, stat.DiskSize)
+
+			check := func() {
+				for i := 0; i < 200; i++ {
+					value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+					assert.Nil(t, err)
+					assert.Equal(t, jsonValue(i), value)
+				}
+				value, err := db.Get([]byte("small"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("value"), value)
+			}
+			check()
+
+			// merge之后旧的数据也会被压缩，重启之后仍然可以读取
+			assert.Nil(t, db.Merge())
+			assert.Nil(t, db.Close())
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			check()
+			mergedStat, err := db.Stat()
+			assert.Nil(t, err)
+			assert.Less(t, mergedStat.DiskSize*2, stat.DiskSize)
+			assert.Nil(t, db.Close())
+		})
+	}
+}
+
+func TestDB_InvalidCompression(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-compression")
+	opts.Compression = LZCompression + 1
+	_, err := Open(opts)
+	assert.Equal(t, ErrInvalidCompression, err)
+}
+
+func TestDB_Checksum(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-checksum")
+	opts.DataFileSize = 4 * 1024
+	defer os.RemoveAll(opts.DirPath)
+
+	// 先使用IEEE写入，再切换到CRC32C写入，两种数据文件都可以读取
+	for round, checksum := range []Checksum{ChecksumIEEE, ChecksumCRC32C} {
+		opts.Checksum = checksum
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		for i := round * 300; i < (round+1)*300; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+		}
+		assert.Nil(t, db.Close())
+	}
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	checksums := make(map[Checksum]bool)
+	for _, dataFile := range db.olderFiles {
+		checksums[dataFile.Header().Checksum] = true
+	}
+	assert.Equal(t, map[Checksum]bool{ChecksumIEEE: true, ChecksumCRC32C: true}, checksums)
+	for i := 0; i < 600; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_InvalidChecksum(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-checksum")
+	opts.Checksum = ChecksumIEEE + 1
+	_, err := Open(opts)
+	assert.Equal(t, ErrInvalidChecksum, err)
+}
+
+func TestDB_Encryption(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-encryption")
+	opts.DataFileSize = 4 * 1024
+	defer os.RemoveAll(opts.DirPath)
+	keys := map[uint32][]byte{
+		1: bytes.Repeat([]byte{1}, 16),
+		2: bytes.Repeat([]byte{2}, 32),
+	}
+
+	// 依次使用明文、密钥1、密钥2写入数据
+	for round, keyProvider := range []KeyProvider{nil, &StaticKeyProvider{ActiveID: 1, Keys: keys}, &StaticKeyProvider{ActiveID: 2, Keys: keys}} {
+		opts.Encryption.KeyProvider = keyProvider
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		for i := round * 100; i < (round+1)*100; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("secret_%d", i))))
+		}
+		for i := 0; i < (round+1)*100; i++ {
+			value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("secret_%d", i)), value)
+		}
+		// 写入的数据使用当前的密钥加密
+		if keyProvider != nil {
+			keyID, ok := db.activeFile.KeyID()
+			assert.True(t, ok)
+			assert.Equal(t, keyProvider.ActiveKeyID(), keyID)
+		}
+		if round == 2 {
+			assert.Nil(t, db.Merge())
+		}
+		assert.Nil(t, db.Close())
+	}
+
+	// merge的结果生效之后所有的数据文件以及索引快照都使用新的密钥加密
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	entries, err := os.ReadDir(opts.DirPath)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(opts.DirPath, entry.Name()))
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(content, []byte("secret_")), entry.Name())
+		assert.False(t, bytes.Contains(content, []byte("key_")), entry.Name())
+	}
+	for _, dataFile := range db.olderFiles {
+		keyID, _ := dataFile.KeyID()
+		assert.Equal(t, uint32(2), keyID)
+	}
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(300), stat.KeyNum)
+	assert.Nil(t, db.Close())
+
+	// 没有密钥或者密钥错误时无法打开
+	opts.Encryption.KeyProvider = nil
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrEncryptedFile, err)
+	opts.Encryption.KeyProvider = &StaticKeyProvider{ActiveID: 2, Keys: map[uint32][]byte{2: bytes.Repeat([]byte{3}, 32)}}
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrWrongEncryptionKey, err)
+	opts.Encryption.KeyProvider = &StaticKeyProvider{ActiveID: 2, Keys: map[uint32][]byte{2: []byte("short")}}
+	_, err = Open(opts)
+	assert.Equal(t, ErrInvalidEncryptionKey, err)
+}
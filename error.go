@@ -10,4 +10,21 @@ var (
 	ErrDirPathIsEmpty         = errors.New("dir path is empty")
 	ErrDataFileSizeZero       = errors.New("data file size must be greater than 0")
 	ErrDataDirectoryCorrupted = errors.New("data directory corrupted")
+	ErrDatabaseClosed         = errors.New("database is closed")
+	ErrExceedMaxBatchNum      = errors.New("exceed the max batch num")
+	ErrMergeIsProgress        = errors.New("merge is in progress, try again later")
+	ErrDatabaseIsUsing        = errors.New("the database directory is used by another process")
+	ErrInvalidMergeRatio      = errors.New("invalid merge ratio, must be between 0 and 1")
+	ErrMergeAborted           = errors.New("merge is aborted because the database is closing")
+	ErrInvalidTTL             = errors.New("invalid ttl, must be greater than 0")
+	ErrTxnConflict            = errors.New("transaction conflict, please retry")
+	ErrTxnReadOnly            = errors.New("cannot write in a read-only transaction")
+	ErrTxnClosed              = errors.New("transaction has been committed or rolled back")
+	ErrReadOnly               = errors.New("the database is opened in read-only mode")
+	ErrInvalidRecoveryPolicy  = errors.New("invalid recovery policy")
+	ErrMergeDiscarded         = errors.New("merge result is discarded because the data files are used by iterators or transactions")
+	ErrInvalidCompression     = errors.New("invalid compression")
+	ErrInvalidEncryptionKey   = errors.New("invalid encryption key, must be 16, 24 or 32 bytes")
+	ErrInvalidChecksum        = errors.New("invalid checksum algorithm")
+	ErrMergeFilesOverflow     = errors.New("merge result is discarded because it needs more data files than the merged files")
 )
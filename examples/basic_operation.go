@@ -12,6 +12,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	defer db.Close()
 
 	err = db.Put([]byte("hello"), []byte("sirius"))
 	if err != nil {
@@ -32,6 +32,10 @@ func (f *FileIO) Close() error {
 	return f.fd.Close()
 }
 
+func (f *FileIO) Truncate(size int64) error {
+	return f.fd.Truncate(size)
+}
+
 func (f *FileIO) Size() (int64, error) {
 	stat, err := f.fd.Stat()
 	if err != nil {
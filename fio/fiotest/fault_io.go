@@ -0,0 +1,303 @@
+// Package fiotest 提供可以注入IO故障的fio.IOManager实现，用于测试存储引擎在写入失败以及断电时的行为
+package fiotest
+
+import (
+	"Sirius/fio"
+	"errors"
+	"math/rand"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ErrCrashed 模拟断电之后，断电前打开的IOManager都不能再使用
+var ErrCrashed = errors.New("file system has crashed")
+
+type faultOp int
+
+const (
+	opWrite faultOp = iota
+	opSync
+)
+
+// fault 一个预先设置的故障，在第after+1次对应的操作时触发
+type fault struct {
+	op      faultOp
+	after   int
+	written int // 写入失败之前已经写入的字节数，-1表示随机
+	err     error
+}
+
+// fileState 文件已经持久化的长度，断电之后超过这个长度的数据可能丢失
+// 持久化的状态属于文件本身而不是文件名，file一直打开着这个文件，用来在重命名之后找到文件，
+// 文件被删除之后inode也不会被其他文件复用
+type fileState struct {
+	file       *os.File
+	syncedSize int64
+}
+
+// FaultFS 记录通过它打开的所有文件的持久化状态，并按照预先设置的脚本注入故障
+// 数据仍然写入真实的文件，所以目录操作不受影响，只模拟数据文件内容的丢失，不模拟目录项的丢失
+// 文件被重命名之后仍然使用原来的持久化状态，例如merge生成的文件替换掉同名的旧文件
+type FaultFS struct {
+	mu         sync.Mutex
+	rand       *rand.Rand
+	files      []*fileState
+	faults     []*fault
+	generation int // 每次断电加1，旧的IOManager全部失效
+	cutAfter   int // 第cutAfter+1次Write或者Sync之前断电，-1表示没有计划断电
+}
+
+// NewFaultFS 创建FaultFS，seed用于随机的短写长度以及断电时保留的数据长度，方便复现问题
+func NewFaultFS(seed int64) *FaultFS {
+	return &FaultFS{
+		rand:     rand.New(rand.NewSource(seed)),
+		cutAfter: -1,
+	}
+}
+
+// NewIOManager 实现fio.IOManagerFactory，可以通过sirius.Options.IOManagerFactory接入存储引擎
+// 打开时文件中已有的数据都认为已经持久化
+func (fs *FaultFS) NewIOManager(fileName string, ioType fio.FileIOType) (fio.IOManager, error) {
+	ioManager, err := fio.NewIOManager(fileName, ioType)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fileName)
+	if err != nil {
+		_ = ioManager.Close()
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// 同一个文件可能同时被多个IOManager打开，例如启动时先使用MMap读取，再切换回标准文件IO
+	// 文件名对应的是另一个文件时，例如删除之后重新创建，或者其他文件重命名为这个文件名，不能使用旧的状态
+	state, err := fs.findState(info)
+	if err != nil {
+		_ = ioManager.Close()
+		return nil, err
+	}
+	if state == nil {
+		file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+		if err != nil {
+			_ = ioManager.Close()
+			return nil, err
+		}
+		state = &fileState{file: file, syncedSize: info.Size()}
+		fs.files = append(fs.files, state)
+	} else if state.syncedSize > info.Size() {
+		state.syncedSize = info.Size()
+	}
+	return &faultIO{fs: fs, state: state, ioManager: ioManager, generation: fs.generation}, nil
+}
+
+// findState 查找文件的持久化状态，没有打开过时返回nil，调用方需要持有fs.mu
+func (fs *FaultFS) findState(info os.FileInfo) (*fileState, error) {
+	for _, state := range fs.files {
+		stateInfo, err := state.file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if os.SameFile(stateInfo, info) {
+			return state, nil
+		}
+	}
+	return nil, nil
+}
+
+// FailWrite 第after+1次Write时只写入written个字节，然后返回err
+// written为0表示完全没有写入，为-1表示写入随机长度，例如模拟磁盘空间不足时传入syscall.ENOSPC
+func (fs *FaultFS) FailWrite(after int, written int, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = append(fs.faults, &fault{op: opWrite, after: after, written: written, err: err})
+}
+
+// FailSync 第after+1次Sync时返回err，数据没有被持久化
+func (fs *FaultFS) FailSync(after int, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = append(fs.faults, &fault{op: opSync, after: after, err: err})
+}
+
+// PowerCutAfter 在第ops+1次Write或者Sync之前断电，用来模拟操作进行到一半时断电，触发断电的操作返回ErrCrashed
+func (fs *FaultFS) PowerCutAfter(ops int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.cutAfter = ops
+}
+
+// PowerCut 模拟断电，每个文件只保留已经持久化的数据以及随机长度的未持久化数据
+// 断电之前打开的IOManager都会返回ErrCrashed，没有触发的故障以及计划的断电也会被清除
+func (fs *FaultFS) PowerCut() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.powerCut()
+}
+
+// powerCut 调用方需要持有fs.mu
+// 通过一直打开着的文件截断，断电之前文件被重命名也没有影响，已经被删除的文件不再记录
+func (fs *FaultFS) powerCut() error {
+	fs.generation++
+	fs.faults = nil
+	fs.cutAfter = -1
+
+	files := fs.files[:0]
+	for _, state := range fs.files {
+		info, err := state.file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Sys().(*syscall.Stat_t).Nlink == 0 {
+			_ = state.file.Close()
+			continue
+		}
+		size := info.Size()
+		if size > state.syncedSize {
+			// 未持久化的数据可能有一部分已经被写回磁盘
+			size = state.syncedSize + fs.rand.Int63n(size-state.syncedSize+1)
+			if err := state.file.Truncate(size); err != nil {
+				return err
+			}
+		}
+		state.syncedSize = size
+		files = append(files, state)
+	}
+	fs.files = files
+	return nil
+}
+
+// cutPower 计划的断电到达时执行断电并返回ErrCrashed
+func (fs *FaultFS) cutPower() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.cutAfter < 0 {
+		return nil
+	}
+	if fs.cutAfter > 0 {
+		fs.cutAfter--
+		return nil
+	}
+	if err := fs.powerCut(); err != nil {
+		return err
+	}
+	return ErrCrashed
+}
+
+// takeFault 判断本次操作是否需要触发故障
+func (fs *FaultFS) takeFault(op faultOp) *fault {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for i, f := range fs.faults {
+		if f.op != op {
+			continue
+		}
+		if f.after > 0 {
+			f.after--
+			continue
+		}
+		fs.faults = append(fs.faults[:i], fs.faults[i+1:]...)
+		return f
+	}
+	return nil
+}
+
+// faultIO 包装真实的IOManager，在FaultFS设置的位置注入故障
+type faultIO struct {
+	fs         *FaultFS
+	state      *fileState
+	ioManager  fio.IOManager
+	generation int
+}
+
+func (f *faultIO) crashed() bool {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.generation != f.fs.generation
+}
+
+func (f *faultIO) Read(bytes []byte, offset int64) (int, error) {
+	if f.crashed() {
+		return 0, ErrCrashed
+	}
+	return f.ioManager.Read(bytes, offset)
+}
+
+func (f *faultIO) Write(bytes []byte) (int, error) {
+	if f.crashed() {
+		return 0, ErrCrashed
+	}
+	if err := f.fs.cutPower(); err != nil {
+		return 0, err
+	}
+	flt := f.fs.takeFault(opWrite)
+	if flt == nil {
+		return f.ioManager.Write(bytes)
+	}
+
+	written := flt.written
+	if written < 0 {
+		f.fs.mu.Lock()
+		written = f.fs.rand.Intn(len(bytes) + 1)
+		f.fs.mu.Unlock()
+	}
+	if written > len(bytes) {
+		written = len(bytes)
+	}
+	n, err := f.ioManager.Write(bytes[:written])
+	if err != nil {
+		return n, err
+	}
+	return n, flt.err
+}
+
+func (f *faultIO) Sync() error {
+	if f.crashed() {
+		return ErrCrashed
+	}
+	if err := f.fs.cutPower(); err != nil {
+		return err
+	}
+	if flt := f.fs.takeFault(opSync); flt != nil {
+		return flt.err
+	}
+	if err := f.ioManager.Sync(); err != nil {
+		return err
+	}
+	size, err := f.ioManager.Size()
+	if err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	f.state.syncedSize = size
+	f.fs.mu.Unlock()
+	return nil
+}
+
+func (f *faultIO) Truncate(size int64) error {
+	if f.crashed() {
+		return ErrCrashed
+	}
+	if err := f.ioManager.Truncate(size); err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	if f.state.syncedSize > size {
+		f.state.syncedSize = size
+	}
+	f.fs.mu.Unlock()
+	return nil
+}
+
+// Close 断电之后仍然可以关闭，释放文件描述符
+func (f *faultIO) Close() error {
+	return f.ioManager.Close()
+}
+
+func (f *faultIO) Size() (int64, error) {
+	if f.crashed() {
+		return 0, ErrCrashed
+	}
+	return f.ioManager.Size()
+}
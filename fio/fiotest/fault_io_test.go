@@ -0,0 +1,189 @@
+package fiotest
+
+import (
+	"Sirius/fio"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func openTestFile(t *testing.T, fs *FaultFS) (fio.IOManager, string) {
+	fileName := filepath.Join(t.TempDir(), "a.data")
+	ioManager, err := fs.NewIOManager(fileName, fio.StandardFIO)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = ioManager.Close()
+	})
+	return ioManager, fileName
+}
+
+func TestFaultFS_FailWrite(t *testing.T) {
+	testCases := []struct {
+		name        string
+		written     int
+		err         error
+		wantWritten int
+	}{
+		{name: "短写", written: 3, err: errors.New("short write"), wantWritten: 3},
+		{name: "磁盘空间不足", written: 0, err: syscall.ENOSPC, wantWritten: 0},
+		{name: "写入长度超过数据长度", written: 100, err: syscall.EIO, wantWritten: 5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := NewFaultFS(1)
+			ioManager, _ := openTestFile(t, fs)
+			fs.FailWrite(1, tc.written, tc.err)
+
+			// 第一次写入不受影响，第二次写入失败，之后恢复正常
+			n, err := ioManager.Write([]byte("hello"))
+			assert.Nil(t, err)
+			assert.Equal(t, 5, n)
+			n, err = ioManager.Write([]byte("world"))
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.wantWritten, n)
+			n, err = ioManager.Write([]byte("!"))
+			assert.Nil(t, err)
+			assert.Equal(t, 1, n)
+
+			size, err := ioManager.Size()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(5+tc.wantWritten+1), size)
+		})
+	}
+}
+
+func TestFaultFS_PowerCut(t *testing.T) {
+	fs := NewFaultFS(1)
+	ioManager, fileName := openTestFile(t, fs)
+
+	_, err := ioManager.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Nil(t, ioManager.Sync())
+
+	// 持久化失败的数据和没有持久化的数据在断电之后可能丢失
+	_, err = ioManager.Write([]byte("world"))
+	assert.Nil(t, err)
+	fs.FailSync(0, syscall.EIO)
+	assert.Equal(t, syscall.EIO, ioManager.Sync())
+	_, err = ioManager.Write([]byte("!"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, fs.PowerCut())
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.True(t, len(content) >= 5 && len(content) <= 11)
+	assert.Equal(t, "helloworld!"[:len(content)], string(content))
+
+	// 断电之前打开的IOManager不能再使用
+	_, err = ioManager.Write([]byte("x"))
+	assert.Equal(t, ErrCrashed, err)
+	assert.Equal(t, ErrCrashed, ioManager.Sync())
+
+	// 重新打开之后文件中的数据都已经持久化，再次断电不会丢失
+	ioManager, err = fs.NewIOManager(fileName, fio.StandardFIO)
+	assert.Nil(t, err)
+	defer ioManager.Close()
+	assert.Nil(t, fs.PowerCut())
+	reopened, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, content, reopened)
+}
+
+func TestFaultFS_Truncate(t *testing.T) {
+	fs := NewFaultFS(1)
+	ioManager, fileName := openTestFile(t, fs)
+
+	_, err := ioManager.Write([]byte("hello world"))
+	assert.Nil(t, err)
+	assert.Nil(t, ioManager.Sync())
+	assert.Nil(t, ioManager.Truncate(5))
+	_, err = ioManager.Write([]byte("!"))
+	assert.Nil(t, err)
+
+	// 截断之后的持久化长度不会超过文件长度
+	assert.Nil(t, fs.PowerCut())
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Contains(t, []string{"hello", "hello!"}, string(content))
+}
+
+func TestFaultFS_Rename(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 重命名之前是否打开过目标文件名，打开过时目标文件名有一个已经过期的持久化状态
+		openDest bool
+		// 重命名之后是否重新打开
+		reopen bool
+	}{
+		{name: "重命名为新的文件名", openDest: false},
+		{name: "覆盖持久化长度更小的文件", openDest: true},
+		{name: "覆盖之后重新打开", openDest: true, reopen: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := NewFaultFS(1)
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src.data")
+			dest := filepath.Join(dir, "dest.data")
+
+			if tc.openDest {
+				ioManager, err := fs.NewIOManager(dest, fio.StandardFIO)
+				assert.Nil(t, err)
+				_, err = ioManager.Write([]byte("old"))
+				assert.Nil(t, err)
+				assert.Nil(t, ioManager.Close())
+			}
+			// 完整持久化之后重命名，断电之后不能丢失数据
+			ioManager, err := fs.NewIOManager(src, fio.StandardFIO)
+			assert.Nil(t, err)
+			_, err = ioManager.Write([]byte("hello world"))
+			assert.Nil(t, err)
+			assert.Nil(t, ioManager.Sync())
+			assert.Nil(t, ioManager.Close())
+			assert.Nil(t, os.Rename(src, dest))
+			if tc.reopen {
+				ioManager, err = fs.NewIOManager(dest, fio.StandardFIO)
+				assert.Nil(t, err)
+				assert.Nil(t, ioManager.Close())
+			}
+
+			assert.Nil(t, fs.PowerCut())
+			content, err := os.ReadFile(dest)
+			assert.Nil(t, err)
+			assert.Equal(t, "hello world", string(content))
+		})
+	}
+}
+
+func TestFaultFS_PowerCutAfter(t *testing.T) {
+	fs := NewFaultFS(1)
+	ioManager, fileName := openTestFile(t, fs)
+
+	// 第三次Write或者Sync之前断电
+	fs.PowerCutAfter(2)
+	_, err := ioManager.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Nil(t, ioManager.Sync())
+	_, err = ioManager.Write([]byte("world"))
+	assert.Equal(t, ErrCrashed, err)
+	assert.Equal(t, ErrCrashed, ioManager.Sync())
+
+	// 断电之前持久化的数据不会丢失，触发断电的写入没有写入任何数据
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// 断电之后计划被清除，重新打开的文件不会再次断电
+	ioManager, err = fs.NewIOManager(fileName, fio.StandardFIO)
+	assert.Nil(t, err)
+	defer ioManager.Close()
+	for i := 0; i < 3; i++ {
+		_, err = ioManager.Write([]byte("!"))
+		assert.Nil(t, err)
+	}
+}
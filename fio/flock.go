@@ -0,0 +1,53 @@
+package fio
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var ErrFileLocked = errors.New("file is locked by another process")
+
+// FileLock 基于flock的文件锁，进程退出时操作系统会自动释放
+type FileLock struct {
+	fd *os.File
+}
+
+// TryLockFile 尝试对文件加排他锁，文件已经被锁住时不会阻塞，直接返回ErrFileLocked
+func TryLockFile(fileName string) (*FileLock, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DATA_FILE_PERM)
+	if err != nil {
+		return nil, err
+	}
+	return tryLock(fd, syscall.LOCK_EX)
+}
+
+// TryRLockFile 尝试对文件加共享锁，共享锁之间不互斥，和排他锁互斥
+// 以只读的方式打开文件，文件不存在时返回错误，不会创建文件
+func TryRLockFile(fileName string) (*FileLock, error) {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return tryLock(fd, syscall.LOCK_SH)
+}
+
+// tryLock 以不阻塞的方式对文件加锁，加锁失败时关闭文件
+func tryLock(fd *os.File, how int) (*FileLock, error) {
+	if err := syscall.Flock(int(fd.Fd()), how|syscall.LOCK_NB); err != nil {
+		_ = fd.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrFileLocked
+		}
+		return nil, err
+	}
+	return &FileLock{fd: fd}, nil
+}
+
+// Unlock 释放文件锁
+func (l *FileLock) Unlock() error {
+	if err := syscall.Flock(int(l.fd.Fd()), syscall.LOCK_UN); err != nil {
+		return err
+	}
+	return l.fd.Close()
+}
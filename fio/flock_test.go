@@ -0,0 +1,77 @@
+package fio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLockFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		locked  bool
+		wantErr error
+	}{
+		{
+			name:    "加锁成功",
+			locked:  false,
+			wantErr: nil,
+		}, {
+			name:    "文件已经被锁住",
+			locked:  true,
+			wantErr: ErrFileLocked,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "a.flock")
+			defer destoryFile(path)
+			if tc.locked {
+				lock, err := TryLockFile(path)
+				assert.Nil(t, err)
+				defer lock.Unlock()
+			}
+			lock, err := TryLockFile(path)
+			assert.Equal(t, tc.wantErr, err)
+			if err == nil {
+				assert.Nil(t, lock.Unlock())
+				// 释放之后可以再次加锁
+				lock, err = TryLockFile(path)
+				assert.Nil(t, err)
+				assert.Nil(t, lock.Unlock())
+			}
+		})
+	}
+}
+
+func TestTryRLockFile(t *testing.T) {
+	path := filepath.Join("/tmp", "b.flock")
+	defer destoryFile(path)
+
+	// 共享锁不会创建文件
+	_, err := TryRLockFile(path)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	lock, err := TryLockFile(path)
+	assert.Nil(t, err)
+	// 持有排他锁时不能加共享锁
+	_, err = TryRLockFile(path)
+	assert.Equal(t, ErrFileLocked, err)
+	assert.Nil(t, lock.Unlock())
+
+	// 共享锁之间不互斥，和排他锁互斥
+	rlock1, err := TryRLockFile(path)
+	assert.Nil(t, err)
+	rlock2, err := TryRLockFile(path)
+	assert.Nil(t, err)
+	_, err = TryLockFile(path)
+	assert.Equal(t, ErrFileLocked, err)
+	assert.Nil(t, rlock1.Unlock())
+	assert.Nil(t, rlock2.Unlock())
+	lock, err = TryLockFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Unlock())
+}
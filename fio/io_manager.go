@@ -19,9 +19,37 @@ type IOManager interface {
 
 	// Size 获取文件大小
 	Size() (int64, error)
+
+	// Truncate 将文件截断到指定大小
+	Truncate(int64) error
 }
 
-// NewIOManager 创建一个IOManager实例，目前我们只支持标准FileIO
-func NewIOManager(fileName string) (IOManager, error) {
-	return NewFileIO(fileName)
+type FileIOType = byte
+
+const (
+	// StandardFIO 标准文件IO
+	StandardFIO FileIOType = iota
+
+	// MemoryMap 内存文件映射，只能读取
+	MemoryMap
+
+	// MemoryIO 数据只保存在内存中，不会访问文件系统，文件名会被忽略
+	MemoryIO
+)
+
+// IOManagerFactory 创建IOManager的方法，NewIOManager是默认的实现，测试时可以替换为能注入故障的实现
+type IOManagerFactory func(fileName string, ioType FileIOType) (IOManager, error)
+
+// NewIOManager 根据IO类型创建一个IOManager实例
+func NewIOManager(fileName string, ioType FileIOType) (IOManager, error) {
+	switch ioType {
+	case StandardFIO:
+		return NewFileIO(fileName)
+	case MemoryMap:
+		return NewMMapIOManager(fileName)
+	case MemoryIO:
+		return NewMemIOManager(), nil
+	default:
+		panic("unsupported io type")
+	}
 }
@@ -0,0 +1,65 @@
+package fio
+
+import (
+	"io"
+	"sync"
+)
+
+// MemIO 内存中的数据文件，数据保存在字节切片中，不会访问文件系统
+// 每次创建都是一个新的空文件，关闭之后数据被释放
+type MemIO struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+// NewMemIOManager 初始化内存文件
+func NewMemIOManager() *MemIO {
+	return &MemIO{}
+}
+
+func (m *MemIO) Read(bytes []byte, offset int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if offset >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(bytes, m.data[offset:])
+	if n < len(bytes) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *MemIO) Write(bytes []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append(m.data, bytes...)
+	return len(bytes), nil
+}
+
+// Sync 数据只保存在内存中，不需要持久化
+func (m *MemIO) Sync() error {
+	return nil
+}
+
+func (m *MemIO) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = nil
+	return nil
+}
+
+func (m *MemIO) Size() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.data)), nil
+}
+
+func (m *MemIO) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if size < int64(len(m.data)) {
+		m.data = m.data[:size]
+	}
+	return nil
+}
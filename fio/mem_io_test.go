@@ -0,0 +1,69 @@
+package fio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestMemIO_Read(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		offset  int64
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:    "空文件",
+			input:   nil,
+			offset:  0,
+			want:    []byte{0, 0, 0, 0, 0},
+			wantErr: io.EOF,
+		}, {
+			name:    "从头开始读",
+			input:   []byte("helloworld"),
+			offset:  0,
+			want:    []byte("hello"),
+			wantErr: nil,
+		}, {
+			name:    "读到文件末尾",
+			input:   []byte("helloworld"),
+			offset:  7,
+			want:    []byte{'r', 'l', 'd', 0, 0},
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem, err := NewIOManager("ignored", MemoryIO)
+			assert.Nil(t, err)
+			_, err = mem.Write(tt.input)
+			assert.Nil(t, err)
+			size, err := mem.Size()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(len(tt.input)), size)
+
+			buf := make([]byte, 5)
+			_, err = mem.Read(buf, tt.offset)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, buf)
+			assert.Nil(t, mem.Close())
+		})
+	}
+}
+
+func TestMemIO_Truncate(t *testing.T) {
+	mem := NewMemIOManager()
+	_, err := mem.Write([]byte("helloworld"))
+	assert.Nil(t, err)
+	assert.Nil(t, mem.Truncate(5))
+	_, err = mem.Write([]byte("!"))
+	assert.Nil(t, err)
+
+	buf := make([]byte, 6)
+	_, err = mem.Read(buf, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello!"), buf)
+	assert.Nil(t, mem.Sync())
+}
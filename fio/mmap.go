@@ -0,0 +1,77 @@
+package fio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+var ErrMMapNotWritable = errors.New("mmap io manager is read only")
+
+// MMap 内存文件映射，只用于读取数据，在启动时加速数据文件的加载
+type MMap struct {
+	fd   *os.File
+	data []byte // 映射到内存中的文件内容
+}
+
+// NewMMapIOManager 初始化MMap IO，文件不存在时创建
+func NewMMapIOManager(fileName string) (*MMap, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDONLY, DATA_FILE_PERM)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	// 空文件不能进行映射
+	var data []byte
+	if stat.Size() > 0 {
+		data, err = syscall.Mmap(int(fd.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			_ = fd.Close()
+			return nil, err
+		}
+	}
+	return &MMap{fd: fd, data: data}, nil
+}
+
+func (m *MMap) Read(bytes []byte, offset int64) (int, error) {
+	if offset >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(bytes, m.data[offset:])
+	if n < len(bytes) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *MMap) Write(bytes []byte) (int, error) {
+	return 0, ErrMMapNotWritable
+}
+
+func (m *MMap) Truncate(size int64) error {
+	return ErrMMapNotWritable
+}
+
+func (m *MMap) Sync() error {
+	return nil
+}
+
+func (m *MMap) Close() error {
+	if m.data != nil {
+		if err := syscall.Munmap(m.data); err != nil {
+			return err
+		}
+		m.data = nil
+	}
+	return m.fd.Close()
+}
+
+func (m *MMap) Size() (int64, error) {
+	return int64(len(m.data)), nil
+}
@@ -0,0 +1,65 @@
+package fio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestMMap_Read(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		offset  int64
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:    "空文件",
+			input:   nil,
+			offset:  0,
+			want:    []byte{0, 0, 0, 0, 0},
+			wantErr: io.EOF,
+		}, {
+			name:    "从头开始读",
+			input:   []byte("helloworld"),
+			offset:  0,
+			want:    []byte("hello"),
+			wantErr: nil,
+		}, {
+			name:    "读到文件末尾",
+			input:   []byte("helloworld"),
+			offset:  7,
+			want:    []byte{'r', 'l', 'd', 0, 0},
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "mmap-a.data")
+			defer destoryFile(path)
+			fio, err := NewFileIO(path)
+			assert.Nil(t, err)
+			_, err = fio.Write(tt.input)
+			assert.Nil(t, err)
+			assert.Nil(t, fio.Close())
+
+			mmap, err := NewMMapIOManager(path)
+			assert.Nil(t, err)
+			size, err := mmap.Size()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(len(tt.input)), size)
+
+			buf := make([]byte, 5)
+			_, err = mmap.Read(buf, tt.offset)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, buf)
+
+			// MMap只能读取
+			_, err = mmap.Write([]byte("x"))
+			assert.Equal(t, ErrMMapNotWritable, err)
+			assert.Nil(t, mmap.Close())
+		})
+	}
+}
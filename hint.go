@@ -0,0 +1,226 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"Sirius/index"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// hintMetaKey 索引快照文件中第一条记录的key，记录了快照覆盖的数据文件以及索引条数
+var hintMetaKey = []byte("hint.meta")
+
+// hintMeta 索引快照的元数据
+type hintMeta struct {
+	seqNo      uint64           // 写快照时的序列号
+	entryCount uint64           // 索引条数
+	fileSizes  map[uint32]int64 // 快照覆盖的数据文件以及写快照时的文件大小
+}
+
+// encodeHintMeta 编码索引快照的元数据
+// +-------+------------+-----------+-----+------+-----+
+// | SeqNo | EntryCount | FileCount | Fid | Size | ... |
+// +-------+------------+-----------+-----+------+-----+
+func encodeHintMeta(meta *hintMeta) []byte {
+	buf := make([]byte, 3*binary.MaxVarintLen64+len(meta.fileSizes)*2*binary.MaxVarintLen64)
+	var index = 0
+	index += binary.PutUvarint(buf[index:], meta.seqNo)
+	index += binary.PutUvarint(buf[index:], meta.entryCount)
+	index += binary.PutUvarint(buf[index:], uint64(len(meta.fileSizes)))
+	for fid, size := range meta.fileSizes {
+		index += binary.PutUvarint(buf[index:], uint64(fid))
+		index += binary.PutVarint(buf[index:], size)
+	}
+	return buf[:index]
+}
+
+// decodeHintMeta 解码索引快照的元数据，数据不完整时返回nil
+func decodeHintMeta(buf []byte) *hintMeta {
+	reader := bytes.NewReader(buf)
+	seqNo, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil
+	}
+	entryCount, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil
+	}
+	fileCount, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil
+	}
+	meta := &hintMeta{seqNo: seqNo, entryCount: entryCount, fileSizes: make(map[uint32]int64)}
+	for i := uint64(0); i < fileCount; i++ {
+		fid, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil
+		}
+		size, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil
+		}
+		meta.fileSizes[uint32(fid)] = size
+	}
+	return meta
+}
+
+// writeHintFile 将指定数据文件中的有效索引写入到索引快照文件
+// 先写临时文件，写完之后再rename，保证快照文件要么是完整的，要么是旧的
+func writeHintFile(dirPath string, indexer index.Indexer, fileIds []uint32, seqNo uint64, keyProvider data.KeyProvider) error {
+	meta := &hintMeta{seqNo: seqNo, fileSizes: make(map[uint32]int64)}
+	for _, fid := range fileIds {
+		stat, err := os.Stat(data.GetDataFileName(dirPath, fid))
+		if err != nil {
+			return err
+		}
+		meta.fileSizes[fid] = stat.Size()
+	}
+
+	// 取出位于这些数据文件中的索引
+	var keys [][]byte
+	var positions []*data.LogRecordPos
+	indexer.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+		if _, ok := meta.fileSizes[pos.Fid]; ok {
+			keys = append(keys, key)
+			positions = append(positions, pos)
+		}
+		return true
+	})
+	meta.entryCount = uint64(len(keys))
+
+	tmpFileName := filepath.Join(dirPath, data.HintFileName+".tmp")
+	if err := os.RemoveAll(tmpFileName); err != nil {
+		return err
+	}
+	hintFile, err := data.OpenHintFile(tmpFileName, keyProvider)
+	if err != nil {
+		return err
+	}
+	defer hintFile.Close()
+
+	// 第一条记录是元数据，后面是索引记录
+	if err := hintFile.WriteHintRecordRaw(hintMetaKey, encodeHintMeta(meta)); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if err := hintFile.WriteHintRecord(key, positions[i]); err != nil {
+			return err
+		}
+	}
+	if err := hintFile.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, filepath.Join(dirPath, data.HintFileName))
+}
+
+// hintEntries 索引快照中的全部数据
+type hintEntries struct {
+	meta      *hintMeta
+	keys      [][]byte
+	positions []*data.LogRecordPos
+}
+
+// readHintFile 读取索引快照文件，快照不存在、已经损坏或者元数据没有通过valid校验时返回nil
+// 文件头损坏或者无法打开的快照同样返回nil，数据文件仍然可以重建索引，快照不应该导致数据库无法打开
+// 先校验元数据，避免读取过期快照中的索引记录
+func readHintFile(fileName string, keyProvider data.KeyProvider, valid func(meta *hintMeta) bool) (*hintEntries, error) {
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil, nil
+	}
+	hintFile, err := data.OpenHintFile(fileName, keyProvider)
+	if err != nil {
+		return nil, nil
+	}
+	defer hintFile.Close()
+
+	// 读取并校验元数据
+	record, offset, err := hintFile.ReadLogRecord(0)
+	if err != nil || !bytes.Equal(record.Key, hintMetaKey) {
+		return nil, nil
+	}
+	entries := &hintEntries{meta: decodeHintMeta(record.Value)}
+	if entries.meta == nil || (valid != nil && !valid(entries.meta)) {
+		return nil, nil
+	}
+
+	// 读取全部的索引记录
+	for i := uint64(0); i < entries.meta.entryCount; i++ {
+		record, size, err := hintFile.ReadLogRecord(offset)
+		if err != nil {
+			return nil, nil
+		}
+		entries.keys = append(entries.keys, record.Key)
+		entries.positions = append(entries.positions, data.DecodeLogRecordPos(record.Value))
+		offset += size
+	}
+	// 索引记录之后不应该还有数据
+	if _, _, err := hintFile.ReadLogRecord(offset); err != io.EOF {
+		return nil, nil
+	}
+	return entries, nil
+}
+
+// loadIndexFromHintFile 从索引快照文件中加载索引
+// 快照覆盖的数据文件不需要再从头读取，快照过期或者损坏时直接忽略，从数据文件中重建索引
+func (db *DB) loadIndexFromHintFile() error {
+	entries, err := readHintFile(filepath.Join(db.options.DirPath, data.HintFileName), db.options.Encryption.KeyProvider, db.isHintValid)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		return nil
+	}
+
+	// 快照覆盖的文件中，除了有效数据之外都是可以被清理的无效数据
+	// 快照中记录的是包括文件头的文件长度，已经校验过和数据文件一致，这里使用不包括文件头的长度
+	for fid := range entries.meta.fileSizes {
+		db.addDeadBytes(fid, db.getDataFile(fid).WriteOff)
+	}
+	now := time.Now()
+	for i, key := range entries.keys {
+		pos := entries.positions[i]
+		// 已经过期的数据不再加载到内存索引中
+		if pos.IsExpired(now) {
+			continue
+		}
+		if ok := db.index.Put(key, pos); !ok {
+			return ErrIndexUpdateFailed
+		}
+		db.addDeadBytes(pos.Fid, -int64(pos.Size))
+	}
+	db.seqNo = entries.meta.seqNo
+	db.hintFileIds = make(map[uint32]bool, len(entries.meta.fileSizes))
+	for fid := range entries.meta.fileSizes {
+		db.hintFileIds[fid] = true
+	}
+	return nil
+}
+
+// isHintValid 校验索引快照是否和当前的数据文件匹配
+// 快照覆盖的文件必须都存在并且大小一致，同时不能有比快照更早的、不在快照中的文件
+func (db *DB) isHintValid(meta *hintMeta) bool {
+	var maxFid uint32 = 0
+	for fid, size := range meta.fileSizes {
+		dataFile := db.getDataFile(fid)
+		if dataFile == nil {
+			return false
+		}
+		fileSize, err := dataFile.IoManager.Size()
+		if err != nil || fileSize != size {
+			return false
+		}
+		if fid > maxFid {
+			maxFid = fid
+		}
+	}
+	for _, fid := range db.fileIds {
+		if _, ok := meta.fileSizes[uint32(fid)]; !ok && uint32(fid) < maxFid {
+			return false
+		}
+	}
+	return true
+}
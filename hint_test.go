@@ -0,0 +1,124 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_LoadIndexFromHintFile(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 准备数据，关闭数据库之后修改索引快照
+		before func(t *testing.T, db *DB)
+		after  func(t *testing.T, db *DB)
+
+		wantHint bool
+	}{
+		{
+			name:   "从索引快照加载",
+			before: func(t *testing.T, db *DB) {},
+			after: func(t *testing.T, db *DB) {
+				_, err := os.Stat(filepath.Join(db.options.DirPath, data.HintFileName))
+				assert.Nil(t, err)
+			},
+			wantHint: true,
+		},
+		{
+			name: "快照之后的删除和覆盖写生效",
+			before: func(t *testing.T, db *DB) {
+				// 重新打开，在快照之后的文件中删除和覆盖数据
+				db2, err := Open(db.options)
+				assert.Nil(t, err)
+				assert.Nil(t, db2.Delete([]byte("key_0")))
+				assert.Nil(t, db2.Put([]byte("key_1"), []byte("new")))
+				assert.Nil(t, db2.Close())
+			},
+			after: func(t *testing.T, db *DB) {
+				_, err := db.Get([]byte("key_0"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				value, err := db.Get([]byte("key_1"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("new"), value)
+			},
+			wantHint: true,
+		},
+		{
+			name: "索引快照损坏",
+			before: func(t *testing.T, db *DB) {
+				hintFileName := filepath.Join(db.options.DirPath, data.HintFileName)
+				stat, err := os.Stat(hintFileName)
+				assert.Nil(t, err)
+				// 截断快照文件，模拟写到一半或者损坏
+				assert.Nil(t, os.Truncate(hintFileName, stat.Size()-3))
+			},
+			after:    func(t *testing.T, db *DB) {},
+			wantHint: false,
+		},
+		{
+			name: "索引快照文件头损坏",
+			before: func(t *testing.T, db *DB) {
+				hintFileName := filepath.Join(db.options.DirPath, data.HintFileName)
+				content, err := os.ReadFile(hintFileName)
+				assert.Nil(t, err)
+				// 修改文件头中的创建时间，文件头的crc校验失败
+				content[8] ^= 0xff
+				assert.Nil(t, os.WriteFile(hintFileName, content, 0644))
+			},
+			after:    func(t *testing.T, db *DB) {},
+			wantHint: false,
+		},
+		{
+			name: "索引快照过期",
+			before: func(t *testing.T, db *DB) {
+				hintFileName := filepath.Join(db.options.DirPath, data.HintFileName)
+				staleHint, err := os.ReadFile(hintFileName)
+				assert.Nil(t, err)
+				// merge之后数据文件发生了变化，再换回旧的快照
+				db2, err := Open(db.options)
+				assert.Nil(t, err)
+				assert.Nil(t, db2.Delete([]byte("key_0")))
+				assert.Nil(t, db2.Merge())
+				assert.Nil(t, db2.Close())
+				db2, err = Open(db.options)
+				assert.Nil(t, err)
+				assert.Nil(t, db2.Close())
+				assert.Nil(t, os.WriteFile(hintFileName, staleHint, 0644))
+			},
+			after:    func(t *testing.T, db *DB) {},
+			wantHint: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-hint")
+			opts.DataFileSize = 4 * 1024
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer func() {
+				_ = os.RemoveAll(opts.DirPath)
+			}()
+			for i := 0; i < 1000; i++ {
+				assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+			}
+			assert.Nil(t, db.Close())
+
+			tc.before(t, db)
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantHint, len(db.hintFileIds) > 0)
+			for i := 2; i < 1000; i++ {
+				value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+			}
+			tc.after(t, db)
+			assert.Nil(t, db.Close())
+		})
+	}
+}
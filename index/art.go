@@ -0,0 +1,691 @@
+package index
+
+import (
+	"Sirius/data"
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// artNodeKind 自适应基数树的节点类型，内部节点会根据子节点数量在4/16/48/256之间自动扩缩容
+type artNodeKind uint8
+
+const (
+	artLeaf artNodeKind = iota
+	artNode4
+	artNode16
+	artNode48
+	artNode256
+)
+
+const (
+	node4Max   = 4
+	node16Max  = 16
+	node48Max  = 48
+	node256Max = 256
+
+	// 缩容阈值比扩容阈值小一些，避免在边界上反复扩缩容
+	node16Min  = 3
+	node48Min  = 12
+	node256Min = 37
+)
+
+// artNode 自适应基数树的节点
+// 叶子节点只使用key和pos；内部节点使用prefix(路径压缩)、value以及children
+type artNode struct {
+	kind artNodeKind
+
+	// 叶子节点
+	key []byte
+	pos *data.LogRecordPos
+
+	// 内部节点
+	prefix   []byte     // 压缩的公共前缀
+	value    *artNode   // 恰好在这个节点结束的key对应的叶子，例如同时存在a和ab时，a存储在这里
+	size     int        // 子节点个数
+	keys     []byte     // node4/node16: 有序的子节点字节；node48: 每个字节对应的子节点下标+1，0表示不存在
+	children []*artNode // 子节点
+
+	cow *copyOnWrite // 节点所属的树，不属于当前树的节点被快照共享，修改之前需要先拷贝
+}
+
+// copyOnWrite 标识节点属于哪一棵树，不能是空结构体，否则不同的实例可能有相同的地址
+type copyOnWrite struct {
+	_ byte
+}
+
+// AdaptiveRadixTree 自适应基数树索引
+// 相比BTree，拥有公共前缀的key只会存储一份前缀，内部节点会根据子节点数量选择更紧凑的结构
+// 创建快照时和快照共享所有节点，之后的写入只拷贝需要修改的路径(写时复制)
+type AdaptiveRadixTree struct {
+	root *artNode
+	size int // key的数量
+	cow  *copyOnWrite
+	lock *sync.RWMutex
+}
+
+func NewART() *AdaptiveRadixTree {
+	return &AdaptiveRadixTree{
+		cow:  &copyOnWrite{},
+		lock: &sync.RWMutex{},
+	}
+}
+
+func (art *AdaptiveRadixTree) Put(key []byte, pos *data.LogRecordPos) bool {
+	// 和BTree保持一致，key不允许为nil
+	if key == nil {
+		return false
+	}
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	if art.insert(&art.root, &artNode{kind: artLeaf, key: key, pos: pos, cow: art.cow}, 0) {
+		art.size++
+	}
+	return true
+}
+
+func (art *AdaptiveRadixTree) Get(key []byte) *data.LogRecordPos {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+
+	n := art.root
+	depth := 0
+	for n != nil {
+		if n.kind == artLeaf {
+			if bytes.Equal(n.key, key) {
+				return n.pos
+			}
+			return nil
+		}
+		if !bytes.HasPrefix(key[depth:], n.prefix) {
+			return nil
+		}
+		depth += len(n.prefix)
+		if depth == len(key) {
+			if n.value == nil {
+				return nil
+			}
+			return n.value.pos
+		}
+		idx := n.findChild(key[depth])
+		if idx < 0 {
+			return nil
+		}
+		n = n.children[idx]
+		depth++
+	}
+	return nil
+}
+
+func (art *AdaptiveRadixTree) Delete(key []byte) bool {
+	if key == nil {
+		return false
+	}
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	if !art.delete(&art.root, key, 0) {
+		return false
+	}
+	art.size--
+	return true
+}
+
+func (art *AdaptiveRadixTree) Ascend(fn func(key []byte, pos *data.LogRecordPos) bool) {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	art.root.walk(fn)
+}
+
+func (art *AdaptiveRadixTree) Size() int {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	return art.size
+}
+
+func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
+	return newIndexIterator(art.clone(), reverse)
+}
+
+// clone 返回索引的快照，快照和原来的树共享所有节点
+// 两棵树都换成新的cow，共享的节点不再属于任何一棵树，之后无论哪一方修改都会先拷贝
+func (art *AdaptiveRadixTree) clone() *AdaptiveRadixTree {
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	art.cow = &copyOnWrite{}
+	return &AdaptiveRadixTree{
+		root: art.root,
+		size: art.size,
+		cow:  &copyOnWrite{},
+		lock: &sync.RWMutex{},
+	}
+}
+
+func (art *AdaptiveRadixTree) ascendFrom(pivot []byte, fn func(key []byte, pos *data.LogRecordPos) bool) {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	art.root.ascendFrom(pivot, 0, fn)
+}
+
+func (art *AdaptiveRadixTree) descendFrom(pivot []byte, fn func(key []byte, pos *data.LogRecordPos) bool) {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	if pivot == nil {
+		art.root.walkReverse(fn)
+		return
+	}
+	art.root.descendFrom(pivot, 0, fn)
+}
+
+// mutable 返回可以修改的节点，节点不属于当前树时拷贝一份，调用方需要用返回值替换原来的节点
+func (art *AdaptiveRadixTree) mutable(n *artNode) *artNode {
+	if n.cow == art.cow {
+		return n
+	}
+	c := *n
+	c.cow = art.cow
+	// prefix和叶子的key只会被整体替换，不会原地修改，可以继续共享
+	if n.keys != nil {
+		c.keys = make([]byte, len(n.keys), cap(n.keys))
+		copy(c.keys, n.keys)
+	}
+	if n.children != nil {
+		c.children = make([]*artNode, len(n.children), cap(n.children))
+		copy(c.children, n.children)
+	}
+	return &c
+}
+
+// insert 将叶子节点插入到ref指向的子树中，depth是已经匹配的key长度，返回是否插入了新的key
+func (art *AdaptiveRadixTree) insert(ref **artNode, leaf *artNode, depth int) bool {
+	n := *ref
+	key := leaf.key
+	if n == nil {
+		*ref = leaf
+		return true
+	}
+
+	// 遇到叶子节点，key相同则替换，否则分裂成一个新的内部节点
+	if n.kind == artLeaf {
+		if bytes.Equal(n.key, key) {
+			n = art.mutable(n)
+			n.pos = leaf.pos
+			*ref = n
+			return false
+		}
+		commonLen := longestCommonPrefix(n.key[depth:], key[depth:])
+		newNode := newArtNode4(key[depth:depth+commonLen], art.cow)
+		depth += commonLen
+		newNode.addLeaf(n, depth)
+		newNode.addLeaf(leaf, depth)
+		*ref = newNode
+		return true
+	}
+
+	n = art.mutable(n)
+	*ref = n
+
+	// 内部节点的前缀不匹配，在不匹配的位置分裂
+	commonLen := longestCommonPrefix(n.prefix, key[depth:])
+	if commonLen < len(n.prefix) {
+		newNode := newArtNode4(n.prefix[:commonLen], art.cow)
+		b := n.prefix[commonLen]
+		n.prefix = n.prefix[commonLen+1:]
+		newNode.addChild(b, n)
+		newNode.addLeaf(leaf, depth+commonLen)
+		*ref = newNode
+		return true
+	}
+
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.value != nil {
+			n.value = art.mutable(n.value)
+			n.value.pos = leaf.pos
+			return false
+		}
+		n.value = leaf
+		return true
+	}
+	idx := n.findChild(key[depth])
+	if idx >= 0 {
+		return art.insert(&n.children[idx], leaf, depth+1)
+	}
+	n.addChild(key[depth], leaf)
+	return true
+}
+
+// delete 从ref指向的子树中删除key，返回key是否存在
+func (art *AdaptiveRadixTree) delete(ref **artNode, key []byte, depth int) bool {
+	n := *ref
+	if n == nil {
+		return false
+	}
+	if n.kind == artLeaf {
+		if !bytes.Equal(n.key, key) {
+			return false
+		}
+		*ref = nil
+		return true
+	}
+
+	if !bytes.HasPrefix(key[depth:], n.prefix) {
+		return false
+	}
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.value == nil {
+			return false
+		}
+		n = art.mutable(n)
+		n.value = nil
+	} else {
+		b := key[depth]
+		idx := n.findChild(b)
+		if idx < 0 {
+			return false
+		}
+		if !n.children[idx].contains(key, depth+1) {
+			return false
+		}
+		n = art.mutable(n)
+		childRef := &n.children[idx]
+		if !art.delete(childRef, key, depth+1) {
+			return false
+		}
+		if *childRef == nil {
+			n.removeChild(b)
+		}
+	}
+	*ref = art.shrink(n)
+	return true
+}
+
+// contains 子树中是否存在key，删除之前先确认key存在，避免拷贝不需要修改的节点
+func (n *artNode) contains(key []byte, depth int) bool {
+	for n != nil {
+		if n.kind == artLeaf {
+			return bytes.Equal(n.key, key)
+		}
+		if !bytes.HasPrefix(key[depth:], n.prefix) {
+			return false
+		}
+		depth += len(n.prefix)
+		if depth == len(key) {
+			return n.value != nil
+		}
+		idx := n.findChild(key[depth])
+		if idx < 0 {
+			return false
+		}
+		n = n.children[idx]
+		depth++
+	}
+	return false
+}
+
+func newArtNode4(prefix []byte, cow *copyOnWrite) *artNode {
+	// 拷贝前缀，避免和用户传入的key共享底层数组
+	p := make([]byte, len(prefix))
+	copy(p, prefix)
+	return &artNode{
+		kind:     artNode4,
+		prefix:   p,
+		keys:     make([]byte, 0, node4Max),
+		children: make([]*artNode, 0, node4Max),
+		cow:      cow,
+	}
+}
+
+// addLeaf 将叶子节点挂到内部节点上，depth是内部节点已经匹配的key长度
+func (n *artNode) addLeaf(leaf *artNode, depth int) {
+	if depth == len(leaf.key) {
+		n.value = leaf
+		return
+	}
+	n.addChild(leaf.key[depth], leaf)
+}
+
+// findChild 查找字节b对应的子节点下标，不存在返回-1
+func (n *artNode) findChild(b byte) int {
+	switch n.kind {
+	case artNode4, artNode16:
+		idx := sort.Search(n.size, func(i int) bool { return n.keys[i] >= b })
+		if idx < n.size && n.keys[idx] == b {
+			return idx
+		}
+	case artNode48:
+		if n.keys[b] != 0 {
+			return int(n.keys[b] - 1)
+		}
+	case artNode256:
+		if n.children[b] != nil {
+			return int(b)
+		}
+	}
+	return -1
+}
+
+// addChild 添加子节点，节点已满时先扩容
+func (n *artNode) addChild(b byte, child *artNode) {
+	n.grow()
+	switch n.kind {
+	case artNode4, artNode16:
+		idx := sort.Search(n.size, func(i int) bool { return n.keys[i] >= b })
+		n.keys = append(n.keys, 0)
+		n.children = append(n.children, nil)
+		copy(n.keys[idx+1:], n.keys[idx:])
+		copy(n.children[idx+1:], n.children[idx:])
+		n.keys[idx] = b
+		n.children[idx] = child
+	case artNode48:
+		for i, c := range n.children {
+			if c == nil {
+				n.children[i] = child
+				n.keys[b] = byte(i + 1)
+				break
+			}
+		}
+	case artNode256:
+		n.children[b] = child
+	}
+	n.size++
+}
+
+// removeChild 删除字节b对应的子节点，子节点的位置可能已经被置为nil，所以这里不能通过findChild判断是否存在
+func (n *artNode) removeChild(b byte) {
+	switch n.kind {
+	case artNode4, artNode16:
+		idx := n.findChild(b)
+		if idx < 0 {
+			return
+		}
+		copy(n.keys[idx:], n.keys[idx+1:])
+		copy(n.children[idx:], n.children[idx+1:])
+		n.keys = n.keys[:n.size-1]
+		n.children[n.size-1] = nil
+		n.children = n.children[:n.size-1]
+	case artNode48:
+		if n.keys[b] == 0 {
+			return
+		}
+		n.children[n.keys[b]-1] = nil
+		n.keys[b] = 0
+	case artNode256:
+		n.children[b] = nil
+	}
+	n.size--
+}
+
+// grow 子节点已满时扩容到更大的节点类型
+func (n *artNode) grow() {
+	switch {
+	case n.kind == artNode4 && n.size == node4Max:
+		keys := make([]byte, n.size, node16Max)
+		children := make([]*artNode, n.size, node16Max)
+		copy(keys, n.keys)
+		copy(children, n.children)
+		n.kind, n.keys, n.children = artNode16, keys, children
+	case n.kind == artNode16 && n.size == node16Max:
+		keys := make([]byte, node256Max)
+		children := make([]*artNode, node48Max)
+		for i := 0; i < n.size; i++ {
+			keys[n.keys[i]] = byte(i + 1)
+			children[i] = n.children[i]
+		}
+		n.kind, n.keys, n.children = artNode48, keys, children
+	case n.kind == artNode48 && n.size == node48Max:
+		children := make([]*artNode, node256Max)
+		for b := 0; b < node256Max; b++ {
+			if n.keys[b] != 0 {
+				children[b] = n.children[n.keys[b]-1]
+			}
+		}
+		n.kind, n.keys, n.children = artNode256, nil, children
+	}
+}
+
+// shrink 删除子节点之后缩容，返回替换当前节点的新节点，n必须属于当前树
+func (art *AdaptiveRadixTree) shrink(n *artNode) *artNode {
+	// 没有子节点，只剩下在这里结束的key
+	if n.size == 0 {
+		return n.value
+	}
+
+	// 只有一个子节点，和子节点合并进行路径压缩
+	if n.size == 1 && n.value == nil {
+		var b byte
+		var child *artNode
+		n.ascendChildren(func(cb byte, c *artNode) bool {
+			b, child = cb, c
+			return false
+		})
+		if child.kind == artLeaf {
+			return child
+		}
+		prefix := make([]byte, 0, len(n.prefix)+1+len(child.prefix))
+		prefix = append(prefix, n.prefix...)
+		prefix = append(prefix, b)
+		prefix = append(prefix, child.prefix...)
+		child = art.mutable(child)
+		child.prefix = prefix
+		return child
+	}
+
+	switch {
+	case n.kind == artNode16 && n.size <= node16Min:
+		keys := make([]byte, n.size, node4Max)
+		children := make([]*artNode, n.size, node4Max)
+		copy(keys, n.keys)
+		copy(children, n.children)
+		n.kind, n.keys, n.children = artNode4, keys, children
+	case n.kind == artNode48 && n.size <= node48Min:
+		keys := make([]byte, 0, node16Max)
+		children := make([]*artNode, 0, node16Max)
+		n.ascendChildren(func(b byte, c *artNode) bool {
+			keys = append(keys, b)
+			children = append(children, c)
+			return true
+		})
+		n.kind, n.keys, n.children = artNode16, keys, children
+	case n.kind == artNode256 && n.size <= node256Min:
+		keys := make([]byte, node256Max)
+		children := make([]*artNode, 0, node48Max)
+		n.ascendChildren(func(b byte, c *artNode) bool {
+			children = append(children, c)
+			keys[b] = byte(len(children))
+			return true
+		})
+		n.kind, n.keys, n.children = artNode48, keys, children[:node48Max]
+	}
+	return n
+}
+
+// ascendChildren 按照字节从小到大遍历子节点，fn返回false时停止遍历
+func (n *artNode) ascendChildren(fn func(b byte, child *artNode) bool) bool {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i := 0; i < n.size; i++ {
+			if !fn(n.keys[i], n.children[i]) {
+				return false
+			}
+		}
+	case artNode48:
+		for b := 0; b < node256Max; b++ {
+			if n.keys[b] != 0 {
+				if !fn(byte(b), n.children[n.keys[b]-1]) {
+					return false
+				}
+			}
+		}
+	case artNode256:
+		for b := 0; b < node256Max; b++ {
+			if n.children[b] != nil {
+				if !fn(byte(b), n.children[b]) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// walk 按照key从小到大遍历子树，返回false表示遍历被fn终止
+func (n *artNode) walk(fn func(key []byte, pos *data.LogRecordPos) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		return fn(n.key, n.pos)
+	}
+	// 在当前节点结束的key比所有子节点中的key都小
+	if n.value != nil && !fn(n.value.key, n.value.pos) {
+		return false
+	}
+	return n.ascendChildren(func(_ byte, child *artNode) bool {
+		return child.walk(fn)
+	})
+}
+
+// descendChildren 按照字节从大到小遍历子节点，fn返回false时停止遍历
+func (n *artNode) descendChildren(fn func(b byte, child *artNode) bool) bool {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i := n.size - 1; i >= 0; i-- {
+			if !fn(n.keys[i], n.children[i]) {
+				return false
+			}
+		}
+	case artNode48:
+		for b := node256Max - 1; b >= 0; b-- {
+			if n.keys[b] != 0 {
+				if !fn(byte(b), n.children[n.keys[b]-1]) {
+					return false
+				}
+			}
+		}
+	case artNode256:
+		for b := node256Max - 1; b >= 0; b-- {
+			if n.children[b] != nil {
+				if !fn(byte(b), n.children[b]) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// walkReverse 按照key从大到小遍历子树，返回false表示遍历被fn终止
+func (n *artNode) walkReverse(fn func(key []byte, pos *data.LogRecordPos) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		return fn(n.key, n.pos)
+	}
+	if !n.descendChildren(func(_ byte, child *artNode) bool {
+		return child.walkReverse(fn)
+	}) {
+		return false
+	}
+	return n.value == nil || fn(n.value.key, n.value.pos)
+}
+
+// ascendFrom 按照key从小到大遍历子树中大于等于pivot的key，depth是已经和pivot匹配的长度
+// 只会进入包含pivot的那条路径，路径左边的子树直接跳过，右边的子树全部遍历
+func (n *artNode) ascendFrom(pivot []byte, depth int, fn func(key []byte, pos *data.LogRecordPos) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		if bytes.Compare(n.key, pivot) < 0 {
+			return true
+		}
+		return fn(n.key, n.pos)
+	}
+
+	rest := pivot[depth:]
+	switch comparePrefix(n.prefix, rest) {
+	case 1:
+		return n.walk(fn)
+	case -1:
+		return true
+	}
+	// pivot在这个节点的路径上结束，子树中所有的key都大于等于pivot
+	if len(rest) <= len(n.prefix) {
+		return n.walk(fn)
+	}
+	// 在当前节点结束的key是pivot的前缀，比pivot小
+	depth += len(n.prefix)
+	b := pivot[depth]
+	return n.ascendChildren(func(cb byte, child *artNode) bool {
+		switch {
+		case cb < b:
+			return true
+		case cb == b:
+			return child.ascendFrom(pivot, depth+1, fn)
+		}
+		return child.walk(fn)
+	})
+}
+
+// descendFrom 按照key从大到小遍历子树中小于等于pivot的key，depth是已经和pivot匹配的长度
+func (n *artNode) descendFrom(pivot []byte, depth int, fn func(key []byte, pos *data.LogRecordPos) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		if bytes.Compare(n.key, pivot) > 0 {
+			return true
+		}
+		return fn(n.key, n.pos)
+	}
+
+	rest := pivot[depth:]
+	switch comparePrefix(n.prefix, rest) {
+	case 1:
+		return true
+	case -1:
+		return n.walkReverse(fn)
+	}
+	// pivot是这个节点路径的前缀，子树中所有的key都大于pivot
+	if len(rest) < len(n.prefix) {
+		return true
+	}
+	depth += len(n.prefix)
+	if depth == len(pivot) {
+		// 只有在当前节点结束的key等于pivot，子节点中的key都更大
+		return n.value == nil || fn(n.value.key, n.value.pos)
+	}
+	b := pivot[depth]
+	if !n.descendChildren(func(cb byte, child *artNode) bool {
+		switch {
+		case cb > b:
+			return true
+		case cb == b:
+			return child.descendFrom(pivot, depth+1, fn)
+		}
+		return child.walkReverse(fn)
+	}) {
+		return false
+	}
+	return n.value == nil || fn(n.value.key, n.value.pos)
+}
+
+// comparePrefix 比较节点前缀和pivot剩余部分的公共长度部分
+func comparePrefix(prefix, rest []byte) int {
+	l := len(prefix)
+	if len(rest) < l {
+		l = len(rest)
+	}
+	return bytes.Compare(prefix[:l], rest[:l])
+}
+
+// longestCommonPrefix 返回a和b的公共前缀长度
+func longestCommonPrefix(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
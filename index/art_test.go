@@ -0,0 +1,193 @@
+package index
+
+import (
+	"Sirius/data"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestART_Put(t *testing.T) {
+	testCases := []struct {
+		name string
+		key  []byte
+		pos  *data.LogRecordPos
+		want bool
+	}{
+		{
+			name: "插入成功",
+			key:  []byte("key1"),
+			pos:  &data.LogRecordPos{Fid: 1, Offset: 100},
+			want: true,
+		}, {
+			name: "插入key为nil",
+			key:  nil,
+			pos:  &data.LogRecordPos{Fid: 2, Offset: 200},
+			want: false, //key不可以为nil
+		}, {
+			name: "插入pos为nil",
+			key:  []byte("key2"),
+			pos:  nil,
+			want: true, //pos可以为nil
+		},
+	}
+	for _, tc := range testCases {
+		art := NewART()
+		res := art.Put(tc.key, tc.pos)
+		assert.Equal(t, tc.want, res)
+	}
+}
+
+func TestART_Get(t *testing.T) {
+	testCases := []struct {
+		name string
+		keys []string
+		key  []byte
+		want *data.LogRecordPos
+	}{
+		{
+			name: "key存在",
+			keys: []string{"key1"},
+			key:  []byte("key1"),
+			want: &data.LogRecordPos{Fid: 1, Offset: 0},
+		}, {
+			name: "key不存在",
+			keys: []string{"key1"},
+			key:  []byte("key2"),
+			want: nil,
+		}, {
+			name: "key是其他key的前缀",
+			keys: []string{"user", "user:1", "user:10"},
+			key:  []byte("user:1"),
+			want: &data.LogRecordPos{Fid: 1, Offset: 1},
+		}, {
+			name: "只存在更长的key",
+			keys: []string{"user:1", "user:10"},
+			key:  []byte("user"),
+			want: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			art := NewART()
+			for i, key := range tc.keys {
+				art.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+			assert.Equal(t, tc.want, art.Get(tc.key))
+		})
+	}
+}
+
+func TestART_Delete(t *testing.T) {
+	testCases := []struct {
+		name string
+		keys []string
+		key  []byte
+		want bool
+	}{
+		{
+			name: "key存在",
+			keys: []string{"key1"},
+			key:  []byte("key1"),
+			want: true,
+		}, {
+			name: "key为nil",
+			keys: []string{"key1"},
+			key:  nil,
+			want: false,
+		}, {
+			name: "key不存在",
+			keys: []string{"key1"},
+			key:  []byte("key2"),
+			want: false,
+		}, {
+			name: "删除作为前缀的key",
+			keys: []string{"user", "user:1"},
+			key:  []byte("user"),
+			want: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			art := NewART()
+			for i, key := range tc.keys {
+				art.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+			assert.Equal(t, tc.want, art.Delete(tc.key))
+			assert.Nil(t, art.Get(tc.key))
+		})
+	}
+}
+
+// TestART_Random 随机写入和删除，和map的结果进行比较，覆盖节点的扩容、缩容以及路径压缩
+func TestART_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	art := NewART()
+	expected := make(map[string]*data.LogRecordPos)
+	randomKey := func() []byte {
+		// 使用共享前缀以及较小的字符集，产生大量前缀相互包含的key
+		key := []byte("user:")
+		n := r.Intn(4)
+		for i := 0; i < n; i++ {
+			key = append(key, byte(r.Intn(300)%256))
+		}
+		return key
+	}
+
+	for i := 0; i < 50000; i++ {
+		key := randomKey()
+		if r.Intn(3) == 0 {
+			_, ok := expected[string(key)]
+			assert.Equal(t, ok, art.Delete(key))
+			delete(expected, string(key))
+		} else {
+			pos := &data.LogRecordPos{Fid: uint32(i), Offset: int64(i)}
+			assert.True(t, art.Put(key, pos))
+			expected[string(key)] = pos
+		}
+	}
+
+	for key, pos := range expected {
+		assert.Equal(t, pos, art.Get([]byte(key)))
+	}
+	assert.Equal(t, len(expected), art.Size())
+
+	var wantKeys []string
+	for key := range expected {
+		wantKeys = append(wantKeys, key)
+	}
+	sort.Strings(wantKeys)
+	var gotKeys []string
+	art.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+		gotKeys = append(gotKeys, string(key))
+		return true
+	})
+	assert.Equal(t, wantKeys, gotKeys)
+
+	// 全部删除之后树为空
+	for key := range expected {
+		assert.True(t, art.Delete([]byte(key)))
+	}
+	assert.Nil(t, art.root)
+}
+
+func TestART_Ascend(t *testing.T) {
+	art := NewART()
+	var keys [][]byte
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		keys = append(keys, key)
+		art.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	var gotKeys [][]byte
+	art.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+		gotKeys = append(gotKeys, key)
+		return len(gotKeys) < 10
+	})
+	assert.Equal(t, keys[:10], gotKeys)
+}
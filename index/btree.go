@@ -7,7 +7,7 @@ import (
 )
 
 type BTree struct {
-	tree *btree.BTree // btree在并发写时不安全，需要加锁，而在并发读时是安全的
+	tree *btree.BTree // btree在并发写时不安全，读和写同时进行时也不安全，读也需要加读锁
 	lock *sync.RWMutex
 }
 
@@ -33,7 +33,9 @@ func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) bool {
 
 func (bt *BTree) Get(key []byte) *data.LogRecordPos {
 	it := &Item{key: key}
-	// btree在并发读时是安全的,不需要加锁
+	// 并发读是安全的，但是读的同时可能有写入，需要加读锁
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	btItem := bt.tree.Get(it)
 	if btItem == nil {
 		return nil
@@ -52,3 +54,61 @@ func (bt *BTree) Delete(key []byte) bool {
 	}
 	return true
 }
+
+func (bt *BTree) Ascend(fn func(key []byte, pos *data.LogRecordPos) bool) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	bt.tree.Ascend(func(i btree.Item) bool {
+		it := i.(*Item)
+		return fn(it.key, it.pos)
+	})
+}
+
+func (bt *BTree) Iterator(reverse bool) Iterator {
+	return newIndexIterator(bt.clone(), reverse)
+}
+
+// clone 返回索引的快照，btree的Clone是写时复制的，不需要拷贝节点
+// Clone会修改原来的树，所以需要加写锁
+func (bt *BTree) clone() *BTree {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	return &BTree{
+		tree: bt.tree.Clone(),
+		lock: &sync.RWMutex{},
+	}
+}
+
+func (bt *BTree) ascendFrom(pivot []byte, fn func(key []byte, pos *data.LogRecordPos) bool) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	iter := func(i btree.Item) bool {
+		it := i.(*Item)
+		return fn(it.key, it.pos)
+	}
+	if pivot == nil {
+		bt.tree.Ascend(iter)
+		return
+	}
+	bt.tree.AscendGreaterOrEqual(&Item{key: pivot}, iter)
+}
+
+func (bt *BTree) descendFrom(pivot []byte, fn func(key []byte, pos *data.LogRecordPos) bool) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	iter := func(i btree.Item) bool {
+		it := i.(*Item)
+		return fn(it.key, it.pos)
+	}
+	if pivot == nil {
+		bt.tree.Descend(iter)
+		return
+	}
+	bt.tree.DescendLessOrEqual(&Item{key: pivot}, iter)
+}
+
+func (bt *BTree) Size() int {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return bt.tree.Len()
+}
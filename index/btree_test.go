@@ -2,7 +2,9 @@ package index
 
 import (
 	"Sirius/data"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
 )
 
@@ -64,6 +66,29 @@ func TestBTree_Get(t *testing.T) {
 	}
 }
 
+// TestBTree_ConcurrentGet 写入的同时读取，使用-race运行时可以发现没有加锁的读
+func TestBTree_ConcurrentGet(t *testing.T) {
+	bt := NewBTree()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			bt.Put([]byte(fmt.Sprintf("key_%d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if pos := bt.Get([]byte(fmt.Sprintf("key_%d", i))); pos != nil {
+				assert.Equal(t, int64(i), pos.Offset)
+			}
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, 1000, bt.Size())
+}
+
 func TestBTree_Delete(t *testing.T) {
 	testCases := []struct {
 		name string
@@ -101,3 +126,53 @@ func TestBTree_Delete(t *testing.T) {
 		}
 	}
 }
+
+func TestBTree_Ascend(t *testing.T) {
+	testCases := []struct {
+		name     string
+		keys     []string
+		stopAt   int
+		wantKeys []string
+	}{
+		{
+			name:     "空索引",
+			keys:     nil,
+			wantKeys: nil,
+		}, {
+			name:     "按照key从小到大遍历",
+			keys:     []string{"c", "a", "b"},
+			wantKeys: []string{"a", "b", "c"},
+		}, {
+			name:     "fn返回false时停止遍历",
+			keys:     []string{"c", "a", "b"},
+			stopAt:   2,
+			wantKeys: []string{"a", "b"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bt := NewBTree()
+			for i, key := range tc.keys {
+				bt.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+			var gotKeys []string
+			bt.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+				gotKeys = append(gotKeys, string(key))
+				return tc.stopAt == 0 || len(gotKeys) < tc.stopAt
+			})
+			assert.Equal(t, tc.wantKeys, gotKeys)
+		})
+	}
+}
+
+func TestBTree_Size(t *testing.T) {
+	bt := NewBTree()
+	assert.Equal(t, 0, bt.Size())
+	bt.Put([]byte("key1"), &data.LogRecordPos{Fid: 1, Offset: 100})
+	bt.Put([]byte("key2"), &data.LogRecordPos{Fid: 1, Offset: 200})
+	// 覆盖写不会增加key的数量
+	bt.Put([]byte("key1"), &data.LogRecordPos{Fid: 1, Offset: 300})
+	assert.Equal(t, 2, bt.Size())
+	bt.Delete([]byte("key1"))
+	assert.Equal(t, 1, bt.Size())
+}
@@ -13,6 +13,12 @@ type Indexer interface {
 	Get(key []byte) *data.LogRecordPos
 	// Delete 删除key对应的pos，如果key不存在，则返回false
 	Delete(key []byte) bool
+	// Ascend 按照key从小到大的顺序遍历索引，fn返回false时停止遍历
+	Ascend(fn func(key []byte, pos *data.LogRecordPos) bool)
+	// Iterator 返回索引迭代器，reverse为true时按照key从大到小遍历
+	Iterator(reverse bool) Iterator
+	// Size 索引中的key数量
+	Size() int
 }
 
 type IndexType = int8
@@ -26,8 +32,8 @@ const (
 )
 
 // NewIndexer 根据给定的索引类型创建并返回一个新的索引器实例。
-// 当前支持 Btree 类型的索引器，未来可能支持更多类型如 ART 等。
-// 参数 typ 应为 Indexer 类型的常量，如 Btree 或未来的 ART 等。
+// 当前支持 Btree 和 ART 两种类型的索引器。
+// 参数 typ 应为 Indexer 类型的常量，如 Btree 或 ART。
 // 返回值为 Indexer 接口的实现，具体类型由输入参数 typ 决定。
 func NewIndexer(typ IndexType) Indexer {
 	switch typ {
@@ -36,8 +42,8 @@ func NewIndexer(typ IndexType) Indexer {
 		return NewBTree()
 
 	case ART:
-		//
-		return nil
+		// 返回自适应基数树类型的索引
+		return NewART()
 	default:
 		panic("unsupported index type")
 	}
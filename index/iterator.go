@@ -0,0 +1,107 @@
+package index
+
+import (
+	"Sirius/data"
+	"bytes"
+)
+
+// Iterator 通用的索引迭代器
+type Iterator interface {
+	// Rewind 重新回到迭代器的起点，即第一个数据
+	Rewind()
+	// Seek 根据传入的key查找到第一个大于(或小于)等于的目标key，从这个key开始遍历
+	Seek(key []byte)
+	// Next 跳转到下一个key
+	Next()
+	// Valid 是否有效，即是否已经遍历完了所有的key，用于退出遍历
+	Valid() bool
+	// Key 当前遍历位置的key
+	Key() []byte
+	// Value 当前遍历位置的value
+	Value() *data.LogRecordPos
+	// Close 关闭迭代器，释放相应资源
+	Close()
+}
+
+// snapshot 迭代器遍历的索引快照，快照创建之后不会再被修改
+type snapshot interface {
+	// ascendFrom 按照key从小到大遍历大于等于pivot的key，pivot为nil时从最小的key开始，fn返回false时停止遍历
+	ascendFrom(pivot []byte, fn func(key []byte, pos *data.LogRecordPos) bool)
+	// descendFrom 按照key从大到小遍历小于等于pivot的key，pivot为nil时从最大的key开始，fn返回false时停止遍历
+	descendFrom(pivot []byte, fn func(key []byte, pos *data.LogRecordPos) bool)
+}
+
+// indexIterator 基于索引快照的迭代器
+// 快照通过写时复制和原来的索引共享节点，创建迭代器时不需要拷贝索引中的数据，之后的写入也不会影响正在进行的遍历
+// 每次移动时都在快照中查找下一个key，只会访问实际遍历到的key
+type indexIterator struct {
+	snapshot snapshot
+	reverse  bool  // 是否是反向遍历
+	item     *Item // 当前遍历位置的key+位置索引信息，为nil表示遍历结束
+}
+
+// newIndexIterator 根据索引快照创建迭代器，并定位到第一个数据
+func newIndexIterator(snapshot snapshot, reverse bool) *indexIterator {
+	it := &indexIterator{
+		snapshot: snapshot,
+		reverse:  reverse,
+	}
+	it.Rewind()
+	return it
+}
+
+func (it *indexIterator) Rewind() {
+	it.seek(nil, true)
+}
+
+func (it *indexIterator) Seek(key []byte) {
+	// nil在快照中表示没有边界，这里的key是真实的查找位置
+	if key == nil {
+		key = []byte{}
+	}
+	it.seek(key, true)
+}
+
+func (it *indexIterator) Next() {
+	if it.item == nil {
+		return
+	}
+	it.seek(it.item.key, false)
+}
+
+func (it *indexIterator) Valid() bool {
+	return it.item != nil
+}
+
+func (it *indexIterator) Key() []byte {
+	return it.item.key
+}
+
+func (it *indexIterator) Value() *data.LogRecordPos {
+	return it.item.pos
+}
+
+func (it *indexIterator) Close() {
+	it.snapshot = nil
+	it.item = nil
+}
+
+// seek 定位到pivot之后(反向遍历时是之前)的第一个key，inclusive表示是否包括pivot本身
+func (it *indexIterator) seek(pivot []byte, inclusive bool) {
+	it.item = nil
+	if it.snapshot == nil {
+		return
+	}
+	fn := func(key []byte, pos *data.LogRecordPos) bool {
+		if !inclusive && bytes.Equal(key, pivot) {
+			return true
+		}
+		it.item = &Item{key: key, pos: pos}
+		return false
+	}
+	if it.reverse {
+		it.snapshot.descendFrom(pivot, fn)
+	} else {
+		it.snapshot.ascendFrom(pivot, fn)
+	}
+}
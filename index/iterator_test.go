@@ -0,0 +1,182 @@
+package index
+
+import (
+	"Sirius/data"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestIndexIterator(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reverse  bool
+		seek     []byte
+		wantKeys []string
+	}{
+		{
+			name:     "正向遍历",
+			wantKeys: []string{"a", "ab", "b", "d"},
+		}, {
+			name:     "反向遍历",
+			reverse:  true,
+			wantKeys: []string{"d", "b", "ab", "a"},
+		}, {
+			name:     "正向Seek",
+			seek:     []byte("aa"),
+			wantKeys: []string{"ab", "b", "d"},
+		}, {
+			name:     "反向Seek",
+			reverse:  true,
+			seek:     []byte("c"),
+			wantKeys: []string{"b", "ab", "a"},
+		}, {
+			name:     "Seek超出范围",
+			seek:     []byte("z"),
+			wantKeys: nil,
+		},
+	}
+
+	indexers := map[string]func() Indexer{
+		"BTree": func() Indexer { return NewBTree() },
+		"ART":   func() Indexer { return NewART() },
+	}
+	for indexName, newIndexer := range indexers {
+		for _, tc := range testCases {
+			t.Run(indexName+"/"+tc.name, func(t *testing.T) {
+				indexer := newIndexer()
+				for i, key := range []string{"b", "a", "d", "ab"} {
+					indexer.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+				}
+				it := indexer.Iterator(tc.reverse)
+				defer it.Close()
+				// 创建迭代器之后的写入不影响遍历
+				indexer.Put([]byte("c"), &data.LogRecordPos{Fid: 1, Offset: 10})
+
+				if tc.seek != nil {
+					it.Seek(tc.seek)
+				}
+				var gotKeys []string
+				for ; it.Valid(); it.Next() {
+					assert.NotNil(t, it.Value())
+					gotKeys = append(gotKeys, string(it.Key()))
+				}
+				assert.Equal(t, tc.wantKeys, gotKeys)
+
+				// Rewind之后重新从头遍历
+				it.Rewind()
+				assert.True(t, it.Valid())
+			})
+		}
+	}
+}
+
+func TestIndexIterator_Snapshot(t *testing.T) {
+	indexers := map[string]func() Indexer{
+		"BTree": func() Indexer { return NewBTree() },
+		"ART":   func() Indexer { return NewART() },
+	}
+	for indexName, newIndexer := range indexers {
+		t.Run(indexName, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			// 字母表很小，key之间有大量的公共前缀，覆盖ART的路径压缩以及在内部节点结束的key
+			randKey := func() []byte {
+				key := make([]byte, 1+r.Intn(6))
+				for i := range key {
+					key[i] = "abc\xff"[r.Intn(4)]
+				}
+				return key
+			}
+
+			indexer := newIndexer()
+			model := make(map[string]int64)
+			for i := 0; i < 2000; i++ {
+				key := randKey()
+				indexer.Put(key, &data.LogRecordPos{Offset: int64(i)})
+				model[string(key)] = int64(i)
+			}
+			snapshotKeys := make([]string, 0, len(model))
+			for key := range model {
+				snapshotKeys = append(snapshotKeys, key)
+			}
+			sort.Strings(snapshotKeys)
+			snapshotModel := make(map[string]int64, len(model))
+			for key, offset := range model {
+				snapshotModel[key] = offset
+			}
+
+			forward := indexer.Iterator(false)
+			defer forward.Close()
+			reverse := indexer.Iterator(true)
+			defer reverse.Close()
+
+			// 创建迭代器之后继续写入和删除
+			for i := 0; i < 2000; i++ {
+				key := randKey()
+				if r.Intn(2) == 0 {
+					indexer.Put(key, &data.LogRecordPos{Offset: int64(10000 + i)})
+					model[string(key)] = int64(10000 + i)
+				} else {
+					indexer.Delete(key)
+					delete(model, string(key))
+				}
+			}
+
+			// 迭代器看到的是创建时的数据
+			var gotKeys []string
+			for forward.Rewind(); forward.Valid(); forward.Next() {
+				assert.Equal(t, snapshotModel[string(forward.Key())], forward.Value().Offset)
+				gotKeys = append(gotKeys, string(forward.Key()))
+			}
+			assert.Equal(t, snapshotKeys, gotKeys)
+			gotKeys = nil
+			for reverse.Rewind(); reverse.Valid(); reverse.Next() {
+				gotKeys = append(gotKeys, string(reverse.Key()))
+			}
+			for i, j := 0, len(gotKeys)-1; i < j; i, j = i+1, j-1 {
+				gotKeys[i], gotKeys[j] = gotKeys[j], gotKeys[i]
+			}
+			assert.Equal(t, snapshotKeys, gotKeys)
+
+			// Seek的结果和在有序的key中二分查找一致
+			for i := 0; i < 500; i++ {
+				pivot := randKey()
+				idx := sort.SearchStrings(snapshotKeys, string(pivot))
+				forward.Seek(pivot)
+				if idx < len(snapshotKeys) {
+					assert.Equal(t, snapshotKeys[idx], string(forward.Key()))
+				} else {
+					assert.False(t, forward.Valid())
+				}
+
+				if idx < len(snapshotKeys) && snapshotKeys[idx] != string(pivot) {
+					idx--
+				} else if idx == len(snapshotKeys) {
+					idx--
+				}
+				reverse.Seek(pivot)
+				if idx >= 0 {
+					assert.Equal(t, snapshotKeys[idx], string(reverse.Key()))
+				} else {
+					assert.False(t, reverse.Valid())
+				}
+			}
+
+			// 索引本身是最新的数据
+			assert.Equal(t, len(model), indexer.Size())
+			gotKeys = nil
+			indexer.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+				assert.Equal(t, model[string(key)], pos.Offset)
+				gotKeys = append(gotKeys, string(key))
+				return true
+			})
+			wantKeys := make([]string, 0, len(model))
+			for key := range model {
+				wantKeys = append(wantKeys, key)
+			}
+			sort.Strings(wantKeys)
+			assert.Equal(t, wantKeys, gotKeys)
+		})
+	}
+}
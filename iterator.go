@@ -0,0 +1,145 @@
+package sirius
+
+import (
+	"Sirius/index"
+	"bytes"
+	"sync/atomic"
+	"time"
+)
+
+// Iterator 用户使用的迭代器，遍历索引中的key，并从数据文件中读取对应的value
+type Iterator struct {
+	indexIter index.Iterator // 索引迭代器
+	db        *DB
+	options   IteratorOptions
+	closed    bool
+	// 已经遍历完满足前缀条件的key，索引迭代器中剩下的key不需要再看
+	outOfPrefix bool
+}
+
+// NewIterator 初始化迭代器
+// 迭代器关闭之前，后台自动merge不会替换数据文件，保证迭代器读取的位置一直有效
+func (db *DB) NewIterator(opts IteratorOptions) *Iterator {
+	db.lock.RLock()
+	indexIter := db.index.Iterator(opts.Reverse)
+	atomic.AddInt32(&db.iterators, 1)
+	db.lock.RUnlock()
+
+	it := &Iterator{
+		db:        db,
+		indexIter: indexIter,
+		options:   opts,
+	}
+	it.Rewind()
+	return it
+}
+
+// Rewind 重新回到迭代器的起点，即第一个数据
+// 设置了前缀时直接定位到前缀的起点，反向遍历时定位到前缀的上界
+func (it *Iterator) Rewind() {
+	prefix := it.options.Prefix
+	switch {
+	case len(prefix) == 0:
+		it.indexIter.Rewind()
+	case !it.options.Reverse:
+		it.indexIter.Seek(prefix)
+	default:
+		if upper := prefixUpperBound(prefix); upper != nil {
+			it.indexIter.Seek(upper)
+		} else {
+			it.indexIter.Rewind()
+		}
+	}
+	it.outOfPrefix = false
+	it.skipToNext()
+}
+
+// Seek 根据传入的key查找到第一个大于(或小于)等于的目标key，从这个key开始遍历
+// key在前缀范围之前时从前缀的起点开始遍历
+func (it *Iterator) Seek(key []byte) {
+	prefix := it.options.Prefix
+	if len(prefix) > 0 {
+		if !it.options.Reverse && bytes.Compare(key, prefix) < 0 {
+			key = prefix
+		}
+		if upper := prefixUpperBound(prefix); it.options.Reverse && upper != nil && bytes.Compare(key, upper) > 0 {
+			key = upper
+		}
+	}
+	it.indexIter.Seek(key)
+	it.outOfPrefix = false
+	it.skipToNext()
+}
+
+// Next 跳转到下一个key
+func (it *Iterator) Next() {
+	if it.outOfPrefix {
+		return
+	}
+	it.indexIter.Next()
+	it.skipToNext()
+}
+
+// Valid 是否有效，即是否已经遍历完了所有的key，用于退出遍历
+func (it *Iterator) Valid() bool {
+	return !it.outOfPrefix && it.indexIter.Valid()
+}
+
+// Key 当前遍历位置的key
+func (it *Iterator) Key() []byte {
+	return it.indexIter.Key()
+}
+
+// Value 当前遍历位置的value
+func (it *Iterator) Value() ([]byte, error) {
+	logRecordPos := it.indexIter.Value()
+	it.db.lock.RLock()
+	defer it.db.lock.RUnlock()
+	if it.db.closed {
+		return nil, ErrDatabaseClosed
+	}
+	return it.db.getValueByPosition(logRecordPos)
+}
+
+// Close 关闭迭代器，释放相应资源
+func (it *Iterator) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	it.indexIter.Close()
+	atomic.AddInt32(&it.db.iterators, -1)
+}
+
+// skipToNext 跳过已经过期的key，遇到前缀范围之后的key时结束遍历
+func (it *Iterator) skipToNext() {
+	prefix := it.options.Prefix
+	now := time.Now()
+	for ; it.indexIter.Valid(); it.indexIter.Next() {
+		key := it.indexIter.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			// 反向遍历时定位到的上界本身不满足前缀，跳过之后才进入前缀范围
+			if it.options.Reverse == (bytes.Compare(key, prefix) > 0) {
+				continue
+			}
+			it.outOfPrefix = true
+			return
+		}
+		if !it.indexIter.Value().IsExpired(now) {
+			return
+		}
+	}
+}
+
+// prefixUpperBound 返回比所有以prefix开头的key都大的最小key，prefix全是0xff时没有上界，返回nil
+func prefixUpperBound(prefix []byte) []byte {
+	upper := make([]byte, len(prefix))
+	copy(upper, prefix)
+	for i := len(upper) - 1; i >= 0; i-- {
+		if upper[i] < 0xff {
+			upper[i]++
+			return upper[:i+1]
+		}
+	}
+	return nil
+}
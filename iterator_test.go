@@ -0,0 +1,123 @@
+package sirius
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_NewIterator(t *testing.T) {
+	testCases := []struct {
+		name    string
+		options IteratorOptions
+		seek    []byte
+
+		wantKeys   []string
+		wantValues []string
+	}{
+		{
+			name:       "遍历所有数据",
+			options:    DefaultIteratorOptions,
+			wantKeys:   []string{"order:1", "user", "user:1", "user:2", "user:3", "user;1"},
+			wantValues: []string{"o1", "u", "u1", "u2-new", "u3", "x1"},
+		},
+		{
+			name:       "按照前缀遍历",
+			options:    IteratorOptions{Prefix: []byte("user:")},
+			wantKeys:   []string{"user:1", "user:2", "user:3"},
+			wantValues: []string{"u1", "u2-new", "u3"},
+		},
+		{
+			name:       "按照前缀反向遍历",
+			options:    IteratorOptions{Prefix: []byte("user:"), Reverse: true},
+			wantKeys:   []string{"user:3", "user:2", "user:1"},
+			wantValues: []string{"u3", "u2-new", "u1"},
+		},
+		{
+			name:       "Seek到指定位置",
+			options:    IteratorOptions{Prefix: []byte("user:")},
+			seek:       []byte("user:2"),
+			wantKeys:   []string{"user:2", "user:3"},
+			wantValues: []string{"u2-new", "u3"},
+		},
+		{
+			name:       "反向Seek到前缀范围之后",
+			options:    IteratorOptions{Prefix: []byte("user:"), Reverse: true},
+			seek:       []byte("z"),
+			wantKeys:   []string{"user:3", "user:2", "user:1"},
+			wantValues: []string{"u3", "u2-new", "u1"},
+		},
+		{
+			name:       "Seek到前缀范围之前",
+			options:    IteratorOptions{Prefix: []byte("user:")},
+			seek:       []byte("a"),
+			wantKeys:   []string{"user:1", "user:2", "user:3"},
+			wantValues: []string{"u1", "u2-new", "u3"},
+		},
+		{
+			name:     "Seek到前缀范围之外",
+			options:  IteratorOptions{Prefix: []byte("user:")},
+			seek:     []byte("user;"),
+			wantKeys: nil,
+		},
+		{
+			name:     "前缀不存在",
+			options:  IteratorOptions{Prefix: []byte("item:")},
+			wantKeys: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-iterator")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer db.Close()
+
+			for key, value := range map[string]string{"user:1": "u1", "user:2": "u2", "user:3": "u3", "order:1": "o1", "user:4": "u4", "user": "u", "user;1": "x1"} {
+				assert.Nil(t, db.Put([]byte(key), []byte(value)))
+			}
+			assert.Nil(t, db.Put([]byte("user:2"), []byte("u2-new")))
+			assert.Nil(t, db.Delete([]byte("user:4")))
+
+			it := db.NewIterator(tc.options)
+			defer it.Close()
+			// 迭代器打开期间的写入不影响遍历
+			assert.Nil(t, db.Put([]byte("user:5"), []byte("u5")))
+			assert.Nil(t, db.Put([]byte("user:1"), []byte("u1-new")))
+
+			if tc.seek != nil {
+				it.Seek(tc.seek)
+			}
+			var gotKeys, gotValues []string
+			for ; it.Valid(); it.Next() {
+				value, err := it.Value()
+				assert.Nil(t, err)
+				gotKeys = append(gotKeys, string(it.Key()))
+				gotValues = append(gotValues, string(value))
+			}
+			assert.Equal(t, tc.wantKeys, gotKeys)
+			assert.Equal(t, tc.wantValues, gotValues)
+		})
+	}
+}
+
+func TestDB_IteratorPrefixUpperBound(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix []byte
+		want   []byte
+	}{
+		{name: "最后一个字节加一", prefix: []byte("user:"), want: []byte("user;")},
+		{name: "末尾的0xff进位", prefix: []byte{'a', 0xff, 0xff}, want: []byte{'b'}},
+		{name: "全是0xff没有上界", prefix: []byte{0xff, 0xff}, want: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, prefixUpperBound(tc.prefix))
+		})
+	}
+}
@@ -0,0 +1,528 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"Sirius/fio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// mergeDirName merge目录的名字，merge目录在数据目录之中，例如/tmp/sirius -> /tmp/sirius/merge
+	// 放在数据目录之中保证merge不会在数据目录之外创建或者删除文件
+	mergeDirName = "merge"
+
+	// mergeFinishedKey 标识merge完成的记录，value是没有参与merge的最小文件id
+	mergeFinishedKey = "merge.finished"
+
+	// mergeFileCountKey merge生成的数据文件个数，merge生成的文件id从0开始连续递增
+	// merge生成的文件会覆盖数据目录中同名的文件，所以个数不能超过没有参与merge的最小文件id
+	mergeFileCountKey = "merge.files"
+)
+
+// Merge 清理无效数据，将有效的数据重写到merge目录中，下一次Open时再替换掉原来的数据文件
+func (db *DB) Merge() error {
+	return db.merge(nil)
+}
+
+// merge 执行merge，stopCh被关闭时中止merge，已经写入merge目录的数据会在下一次merge或者Open时丢弃
+func (db *DB) merge(stopCh <-chan struct{}) error {
+	db.lock.Lock()
+	if db.closed {
+		db.lock.Unlock()
+		return ErrDatabaseClosed
+	}
+	if db.options.ReadOnly {
+		db.lock.Unlock()
+		return ErrReadOnly
+	}
+	// 数据库为空，不需要merge
+	if db.activeFile == nil {
+		db.lock.Unlock()
+		return nil
+	}
+	// 同一时刻只能有一个merge在进行
+	if db.isMerging {
+		db.lock.Unlock()
+		return ErrMergeIsProgress
+	}
+	db.isMerging = true
+	defer func() {
+		db.lock.Lock()
+		db.isMerging = false
+		db.lock.Unlock()
+	}()
+
+	// 持久化当前活跃文件，并将其转换为旧文件，打开新的活跃文件，merge期间的写入都会写到新的活跃文件中
+	if err := db.activeFile.Sync(); err != nil {
+		db.lock.Unlock()
+		return err
+	}
+	db.olderFiles[db.activeFile.FileId] = db.activeFile
+	if err := db.setActiveFile(); err != nil {
+		db.lock.Unlock()
+		return err
+	}
+	// 没有参与merge的最小文件id
+	nonMergeFileId := db.activeFile.FileId
+
+	// 取出所有需要merge的文件
+	var mergeFiles []*data.DataFile
+	for _, file := range db.olderFiles {
+		mergeFiles = append(mergeFiles, file)
+	}
+	db.lock.Unlock()
+
+	// 按照文件id从小到大依次merge
+	sort.Slice(mergeFiles, func(i, j int) bool {
+		return mergeFiles[i].FileId < mergeFiles[j].FileId
+	})
+
+	// 如果merge目录存在，说明之前有未完成的merge，直接删除，内存模式下没有merge目录
+	mergePath := db.getMergePath()
+	if _, err := os.Stat(mergePath); err == nil && !db.options.InMemory {
+		if err := os.RemoveAll(mergePath); err != nil {
+			return err
+		}
+	}
+
+	// 在merge目录中打开一个临时的数据库实例，用于写入有效数据
+	mergeOptions := db.options
+	mergeOptions.DirPath = mergePath
+	mergeOptions.SyncWrites = false
+	mergeOptions.MergeRatio = 0
+	mergeDB, err := Open(mergeOptions)
+	if err != nil {
+		return err
+	}
+
+	for _, dataFile := range mergeFiles {
+		var offset int64 = 0
+		for {
+			// 数据库正在关闭，中止merge
+			select {
+			case <-stopCh:
+				_ = mergeDB.Close()
+				return ErrMergeAborted
+			default:
+			}
+
+			record, size, err := dataFile.ReadLogRecord(offset)
+			if err != nil {
+				// 损坏的数据在启动时已经被跳过，不在内存索引中，继续查找下一条记录
+				if db.options.RecoveryPolicy == RecoverySkip && offset < dataFile.WriteOff {
+					offset = findNextRecord(dataFile, offset)
+					continue
+				}
+				if err == io.EOF {
+					break
+				}
+				_ = mergeDB.Close()
+				return err
+			}
+			logRecordPos := db.index.Get(record.Key)
+			// 和内存索引中的位置进行比较，位置一致并且没有过期说明是有效数据，需要重写
+			if logRecordPos != nil && logRecordPos.Fid == dataFile.FileId && logRecordPos.Offset == offset &&
+				!logRecordPos.IsExpired(time.Now()) {
+				// 有效数据都已经生效了，不需要再保留序列号
+				record.SeqNo = nonTransactionSeqNo
+				pos, err := mergeDB.appendLogRecordWithLock(record)
+				if err != nil {
+					_ = mergeDB.Close()
+					return err
+				}
+				// 开启加密或者关闭压缩之后，merge生成的数据可能比原来的多，文件id不能占用没有参与merge的文件
+				if pos.Fid >= nonMergeFileId {
+					_ = mergeDB.Close()
+					if !db.options.InMemory {
+						_ = os.RemoveAll(mergePath)
+					}
+					return ErrMergeFilesOverflow
+				}
+				// 记录有效数据在merge文件中的位置，用于生成索引快照
+				mergeDB.index.Put(record.Key, pos)
+			}
+			offset += size
+		}
+	}
+
+	if db.options.InMemory {
+		return db.applyMemoryMerge(mergeDB, nonMergeFileId)
+	}
+
+	// 关闭merge数据库，Close会将merge生成的数据文件持久化到磁盘
+	var mergeFileCount uint32 = 0
+	if mergeDB.activeFile != nil {
+		mergeFileCount = mergeDB.activeFile.FileId + 1
+	}
+	if err := mergeDB.Close(); err != nil {
+		return err
+	}
+
+	// 为merge生成的所有数据文件写入索引快照，下一次Open时可以直接加载
+	mergeFileIds := make([]uint32, 0, mergeFileCount)
+	for fid := uint32(0); fid < mergeFileCount; fid++ {
+		mergeFileIds = append(mergeFileIds, fid)
+	}
+	if err := writeHintFile(mergePath, mergeDB.index, mergeFileIds, nonTransactionSeqNo, db.options.Encryption.KeyProvider); err != nil {
+		return err
+	}
+
+	// 写入标识merge完成的文件，只有这个文件存在，merge的结果才会在下一次Open时生效
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
+	if err != nil {
+		return err
+	}
+	defer mergeFinishedFile.Close()
+	records := []*data.LogRecord{
+		{Key: []byte(mergeFinishedKey), Value: []byte(strconv.Itoa(int(nonMergeFileId)))},
+		{Key: []byte(mergeFileCountKey), Value: []byte(strconv.Itoa(int(mergeFileCount)))},
+	}
+	for _, record := range records {
+		encRecord, _ := mergeFinishedFile.EncodeLogRecord(record)
+		if err := mergeFinishedFile.Write(encRecord); err != nil {
+			return err
+		}
+	}
+	return mergeFinishedFile.Sync()
+}
+
+// getMergePath 获取merge目录
+func (db *DB) getMergePath() string {
+	return filepath.Join(db.options.DirPath, mergeDirName)
+}
+
+// loadMergeFiles 加载merge目录，用merge生成的数据文件替换掉原来的数据文件
+// 替换过程是幂等的，如果中途宕机，下一次Open会从头再执行一次
+func (db *DB) loadMergeFiles() error {
+	mergePath := db.getMergePath()
+	// merge目录不存在直接返回
+	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+		return nil
+	}
+	dirEntries, err := os.ReadDir(mergePath)
+	if err != nil {
+		return err
+	}
+
+	// 查找标识merge完成的文件，没有完成的merge直接丢弃
+	var mergeFinished bool
+	var mergeFileNames []string
+	for _, entry := range dirEntries {
+		if entry.Name() == data.MergeFinishedFileName {
+			mergeFinished = true
+		}
+		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
+			mergeFileNames = append(mergeFileNames, entry.Name())
+		}
+	}
+	if !mergeFinished {
+		return os.RemoveAll(mergePath)
+	}
+
+	nonMergeFileId, mergeFileCount, err := db.getMergeFinishedInfo(mergePath)
+	if err != nil {
+		return err
+	}
+	// merge生成的文件会覆盖没有参与merge的文件，只能丢弃
+	if mergeFileCount > nonMergeFileId {
+		return os.RemoveAll(mergePath)
+	}
+
+	// 数据目录中原来的索引快照已经过期，先删除
+	hintFileName := filepath.Join(db.options.DirPath, data.HintFileName)
+	if err := os.Remove(hintFileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// 将merge生成的数据文件移动到数据目录中，rename会原子地覆盖掉同名的旧文件
+	for _, fileName := range mergeFileNames {
+		srcPath := filepath.Join(mergePath, fileName)
+		destPath := filepath.Join(db.options.DirPath, fileName)
+		if err := os.Rename(srcPath, destPath); err != nil {
+			return err
+		}
+	}
+
+	// 删除剩下的参与了merge的旧数据文件
+	for fileId := mergeFileCount; fileId < nonMergeFileId; fileId++ {
+		fileName := data.GetDataFileName(db.options.DirPath, fileId)
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// 最后移动merge生成的索引快照
+	mergeHintFileName := filepath.Join(mergePath, data.HintFileName)
+	if _, err := os.Stat(mergeHintFileName); err == nil {
+		if err := os.Rename(mergeHintFileName, hintFileName); err != nil {
+			return err
+		}
+	}
+
+	// 全部替换完成之后才删除merge目录
+	return os.RemoveAll(mergePath)
+}
+
+// getMergeFinishedInfo 读取标识merge完成的文件，返回没有参与merge的最小文件id以及merge生成的文件个数
+func (db *DB) getMergeFinishedInfo(dirPath string) (uint32, uint32, error) {
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer mergeFinishedFile.Close()
+
+	values := make(map[string]uint32)
+	var offset int64 = 0
+	for {
+		record, size, err := mergeFinishedFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, 0, err
+		}
+		value, err := strconv.Atoi(string(record.Value))
+		if err != nil {
+			return 0, 0, ErrDataDirectoryCorrupted
+		}
+		values[string(record.Key)] = uint32(value)
+		offset += size
+	}
+
+	nonMergeFileId, ok1 := values[mergeFinishedKey]
+	mergeFileCount, ok2 := values[mergeFileCountKey]
+	if !ok1 || !ok2 {
+		return 0, 0, ErrDataDirectoryCorrupted
+	}
+	return nonMergeFileId, mergeFileCount, nil
+}
+
+// startAutoMerge 启动后台自动merge
+func (db *DB) startAutoMerge() {
+	if db.options.MergeRatio <= 0 || db.options.MergeCheckInterval <= 0 {
+		return
+	}
+	db.mergeStopCh = make(chan struct{})
+	db.mergeStopOnce = &sync.Once{}
+	db.mergeWg.Add(1)
+	go func() {
+		defer db.mergeWg.Done()
+		ticker := time.NewTicker(db.options.MergeCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.mergeStopCh:
+				return
+			case now := <-ticker.C:
+				if !db.needAutoMerge(now) {
+					continue
+				}
+				// 自动merge失败时等待下一次检查再重试
+				if err := db.merge(db.mergeStopCh); err != nil {
+					continue
+				}
+				_ = db.applyMerge()
+			}
+		}
+	}()
+}
+
+// stopAutoMerge 通知后台自动merge退出，并等待正在进行的merge结束
+func (db *DB) stopAutoMerge() {
+	if db.mergeStopCh == nil {
+		return
+	}
+	db.mergeStopOnce.Do(func() {
+		close(db.mergeStopCh)
+	})
+	db.mergeWg.Wait()
+}
+
+// needAutoMerge 判断当前是否需要自动merge
+func (db *DB) needAutoMerge(now time.Time) bool {
+	if !inMergeWindow(now, db.options.MergeWindowStart, db.options.MergeWindowEnd) {
+		return false
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed || db.isMerging || db.activeFile == nil {
+		return false
+	}
+	var totalSize = db.activeFile.WriteOff
+	for _, dataFile := range db.olderFiles {
+		totalSize += dataFile.WriteOff
+	}
+	if totalSize == 0 {
+		return false
+	}
+	return float32(db.reclaimSize)/float32(totalSize) >= db.options.MergeRatio
+}
+
+// inMergeWindow 判断当前时间是否在允许merge的时间窗口内
+func inMergeWindow(now time.Time, start, end time.Duration) bool {
+	if start == end {
+		return true
+	}
+	year, month, day := now.Date()
+	sinceMidnight := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	if start < end {
+		return sinceMidnight >= start && sinceMidnight < end
+	}
+	// 时间窗口跨越0点，例如22点到次日2点
+	return sinceMidnight >= start || sinceMidnight < end
+}
+
+// applyMerge 在不重启数据库的情况下，用merge生成的数据文件替换原来的数据文件，并更新内存索引
+// 读取索引快照时不持有db.lock，只在替换数据文件和更新内存索引时持有，不需要重新读取数据文件
+func (db *DB) applyMerge() error {
+	// 数据库已经关闭，或者有正在使用的迭代器和事务，留到下一次Open时再替换
+	// 内存模式在merge时已经完成了替换
+	db.lock.Lock()
+	if db.options.InMemory || db.closed || db.isMerging || !db.canApplyMerge() {
+		db.lock.Unlock()
+		return nil
+	}
+	// 读取merge目录期间不允许开始新的merge，新的merge会删除merge目录
+	db.isMerging = true
+	db.lock.Unlock()
+	defer func() {
+		db.lock.Lock()
+		db.isMerging = false
+		db.lock.Unlock()
+	}()
+
+	mergePath := db.getMergePath()
+	if _, err := os.Stat(filepath.Join(mergePath, data.MergeFinishedFileName)); err != nil {
+		return nil
+	}
+	nonMergeFileId, mergeFileCount, err := db.getMergeFinishedInfo(mergePath)
+	if err != nil {
+		return err
+	}
+	if mergeFileCount > nonMergeFileId {
+		_ = os.RemoveAll(mergePath)
+		return ErrMergeFilesOverflow
+	}
+	entries, err := readHintFile(filepath.Join(mergePath, data.HintFileName), db.options.Encryption.KeyProvider, nil)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		return ErrDataDirectoryCorrupted
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	// 读取索引快照期间可能关闭了数据库，或者开始了新的迭代器和事务
+	if db.closed || !db.canApplyMerge() {
+		return nil
+	}
+
+	// 关闭参与了merge的旧数据文件
+	if err := db.closeMergedFiles(nonMergeFileId); err != nil {
+		return err
+	}
+
+	// 替换数据文件，并打开merge生成的数据文件
+	if err := db.loadMergeFiles(); err != nil {
+		return err
+	}
+	for fid := uint32(0); fid < mergeFileCount; fid++ {
+		dataFile, err := db.openDataFile(fid, fio.StandardFIO)
+		if err != nil {
+			return err
+		}
+		db.olderFiles[fid] = dataFile
+		db.addDeadBytes(fid, dataFile.WriteOff)
+	}
+
+	db.updateMergedIndex(nonMergeFileId, entries)
+	return nil
+}
+
+// canApplyMerge 没有正在使用的迭代器和事务时才能替换数据文件，调用方需要持有db.lock
+func (db *DB) canApplyMerge() bool {
+	return atomic.LoadInt32(&db.iterators) == 0 && len(db.activeTxns) == 0
+}
+
+// applyMemoryMerge 内存模式下没有merge目录，merge完成之后直接用merge数据库中的数据文件替换参与了merge的旧文件
+func (db *DB) applyMemoryMerge(mergeDB *DB, nonMergeFileId uint32) error {
+	// 数据文件交给db之后，关闭merge数据库时不能再关闭这些文件
+	mergedFiles := mergeDB.olderFiles
+	if mergeDB.activeFile != nil {
+		mergedFiles[mergeDB.activeFile.FileId] = mergeDB.activeFile
+	}
+	entries := &hintEntries{}
+	mergeDB.index.Ascend(func(key []byte, pos *data.LogRecordPos) bool {
+		entries.keys = append(entries.keys, key)
+		entries.positions = append(entries.positions, pos)
+		return true
+	})
+	mergeDB.activeFile = nil
+	mergeDB.olderFiles = make(map[uint32]*data.DataFile)
+	_ = mergeDB.Close()
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// 有正在使用的迭代器和事务时不能替换数据文件，内存中的merge结果也无法保留到之后再替换
+	if db.closed || !db.canApplyMerge() {
+		for _, dataFile := range mergedFiles {
+			_ = dataFile.Close()
+		}
+		if db.closed {
+			return ErrDatabaseClosed
+		}
+		return ErrMergeDiscarded
+	}
+
+	if err := db.closeMergedFiles(nonMergeFileId); err != nil {
+		return err
+	}
+	for fid, dataFile := range mergedFiles {
+		db.olderFiles[fid] = dataFile
+		db.addDeadBytes(fid, dataFile.WriteOff)
+	}
+	db.updateMergedIndex(nonMergeFileId, entries)
+	return nil
+}
+
+// closeMergedFiles 关闭参与了merge的旧数据文件，调用方需要持有db.lock
+func (db *DB) closeMergedFiles(nonMergeFileId uint32) error {
+	for fid, dataFile := range db.olderFiles {
+		if fid >= nonMergeFileId {
+			continue
+		}
+		if err := dataFile.Close(); err != nil {
+			return err
+		}
+		delete(db.olderFiles, fid)
+		db.reclaimSize -= db.deadBytes[fid]
+		delete(db.deadBytes, fid)
+	}
+	return nil
+}
+
+// updateMergedIndex 将内存索引指向merge生成的数据文件，调用方需要持有db.lock
+// merge期间被覆盖或者删除的key，内存索引已经指向了更新的文件，merge生成的记录也是无效数据
+func (db *DB) updateMergedIndex(nonMergeFileId uint32, entries *hintEntries) {
+	for i, key := range entries.keys {
+		pos := entries.positions[i]
+		db.addDeadBytes(pos.Fid, -int64(pos.Size))
+		oldPos := db.index.Get(key)
+		if oldPos != nil && oldPos.Fid < nonMergeFileId {
+			db.index.Put(key, pos)
+		} else {
+			db.addDeadBytes(pos.Fid, int64(pos.Size))
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Merge(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 准备数据并执行merge
+		before func(t *testing.T, db *DB)
+		// 重启之后校验数据
+		after func(t *testing.T, db *DB)
+	}{
+		{
+			name: "空数据库merge",
+			before: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Merge())
+			},
+			after: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.activeFile)
+			},
+		},
+		{
+			name: "重写有效数据并清理无效数据",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 1000; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v1")))
+				}
+				// 覆盖写一半的数据，删除一部分数据
+				for i := 0; i < 500; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v2")))
+				}
+				for i := 900; i < 1000; i++ {
+					assert.Nil(t, db.Delete([]byte(fmt.Sprintf("key_%d", i))))
+				}
+				assert.Nil(t, db.Merge())
+				// merge期间以及merge之后的写入不受影响
+				assert.Nil(t, db.Put([]byte("key_0"), []byte("v3")))
+			},
+			after: func(t *testing.T, db *DB) {
+				for i := 0; i < 1000; i++ {
+					value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+					switch {
+					case i == 0:
+						assert.Equal(t, []byte("v3"), value)
+					case i < 500:
+						assert.Equal(t, []byte("v2"), value)
+					case i < 900:
+						assert.Equal(t, []byte("v1"), value)
+					default:
+						assert.Equal(t, ErrKeyNotFound, err)
+					}
+				}
+				// merge目录已经被清理
+				_, err := os.Stat(db.getMergePath())
+				assert.True(t, os.IsNotExist(err))
+			},
+		},
+		{
+			name: "merge没有完成时宕机",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 100; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v1")))
+				}
+				assert.Nil(t, db.Merge())
+				// 删除完成标识，模拟merge写到一半
+				assert.Nil(t, os.Remove(filepath.Join(db.getMergePath(), data.MergeFinishedFileName)))
+			},
+			after: func(t *testing.T, db *DB) {
+				for i := 0; i < 100; i++ {
+					value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+					assert.Nil(t, err)
+					assert.Equal(t, []byte("v1"), value)
+				}
+				_, err := os.Stat(db.getMergePath())
+				assert.True(t, os.IsNotExist(err))
+			},
+		},
+		{
+			name: "替换数据文件时宕机",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 1000; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v1")))
+				}
+				for i := 0; i < 1000; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v2")))
+				}
+				assert.Nil(t, db.Merge())
+				// 只移动了第一个merge文件，模拟替换过程中宕机
+				fileName := filepath.Base(data.GetDataFileName("", 0))
+				err := os.Rename(filepath.Join(db.getMergePath(), fileName), filepath.Join(db.options.DirPath, fileName))
+				assert.Nil(t, err)
+			},
+			after: func(t *testing.T, db *DB) {
+				for i := 0; i < 1000; i++ {
+					value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+					assert.Nil(t, err)
+					assert.Equal(t, []byte("v2"), value)
+				}
+			},
+		},
+		{
+			name: "过期数据不会被重写",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 1000; i++ {
+					assert.Nil(t, db.PutWithTTL([]byte(fmt.Sprintf("key_%d", i)), []byte("v1"), time.Millisecond))
+				}
+				assert.Nil(t, db.PutWithTTL([]byte("session"), []byte("v1"), time.Hour))
+				time.Sleep(5 * time.Millisecond)
+				assert.Nil(t, db.Merge())
+			},
+			after: func(t *testing.T, db *DB) {
+				keys, err := db.ListKeys()
+				assert.Nil(t, err)
+				assert.Equal(t, [][]byte{[]byte("session")}, keys)
+				// 索引快照中保留了过期时间
+				ttl, err := db.TTL([]byte("session"))
+				assert.Nil(t, err)
+				assert.Greater(t, ttl, time.Duration(0))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-merge-test")
+			opts.DataFileSize = 4 * 1024
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer func() {
+				_ = os.RemoveAll(opts.DirPath)
+			}()
+			tc.before(t, db)
+			assert.Nil(t, db.Close())
+
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			tc.after(t, db)
+			assert.Nil(t, db.Close())
+		})
+	}
+}
+
+func TestDB_MergeReclaimSpace(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-merge-space")
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(opts.DirPath)
+	}()
+
+	for n := 0; n < 10; n++ {
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", n))))
+		}
+	}
+	fileCount := len(db.olderFiles) + 1
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Less(t, len(db.olderFiles)+1, fileCount)
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_9"), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_MergeDirInsideDataDir(t *testing.T) {
+	parentDir := filepath.Join(os.TempDir(), "sirius-merge-parent")
+	defer os.RemoveAll(parentDir)
+	opts := DefaultOptions
+	// 数据目录以分隔符结尾，例如os.TempDir()，merge目录也不能跑到数据目录之外
+	opts.DirPath = filepath.Join(parentDir, "db") + string(filepath.Separator)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Merge())
+
+	_, err = os.Stat(filepath.Join(opts.DirPath, mergeDirName, data.MergeFinishedFileName))
+	assert.Nil(t, err)
+	entries, err := os.ReadDir(parentDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Nil(t, db.Close())
+
+	// merge的结果生效之后删除merge目录
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	_, err = os.Stat(db.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_MergeOutputLargerThanInput(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-merge-overflow")
+	opts.DataFileSize = 1024
+	defer os.RemoveAll(opts.DirPath)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Close())
+
+	// 开启加密之后每条记录都变大，merge生成的数据文件比参与merge的文件多
+	opts.Encryption.KeyProvider = &StaticKeyProvider{ActiveID: 1, Keys: map[uint32][]byte{1: bytes.Repeat([]byte{1}, 16)}}
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMergeFilesOverflow, db.Merge())
+	assert.Nil(t, db.Put([]byte("after-merge"), []byte("ok")))
+	assert.Nil(t, db.Close())
+
+	// merge的结果被丢弃，不会覆盖merge之后写入的数据文件
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	value, err := db.Get([]byte("after-merge"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ok"), value)
+	for i := 0; i < 200; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_MergeWithConcurrentWrites(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-merge-concurrent")
+	opts.DataFileSize = 4 * 1024
+	defer os.RemoveAll(opts.DirPath)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v1")))
+	}
+
+	// merge读取内存索引的同时写入数据，使用-race运行时不应该有数据竞争
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("v2")))
+		}
+	}()
+	assert.Nil(t, db.Merge())
+	<-done
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v2"), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_AutoMerge(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-auto-merge")
+	opts.DataFileSize = 4 * 1024
+	opts.MergeRatio = 0.5
+	opts.MergeCheckInterval = 10 * time.Millisecond
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(opts.DirPath)
+	}()
+
+	for n := 0; n < 10; n++ {
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", n))))
+		}
+	}
+	// 无效数据超过阈值，后台merge会在不重启的情况下替换数据文件
+	assert.Eventually(t, func() bool {
+		stat, err := db.Stat()
+		assert.Nil(t, err)
+		return float32(stat.ReclaimableSize) < float32(stat.DiskSize)*opts.MergeRatio
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_9"), value)
+	}
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_9"), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_AutoMergeWithIterator(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-auto-merge-iter")
+	opts.DataFileSize = 4 * 1024
+	opts.MergeRatio = 0.5
+	opts.MergeCheckInterval = 10 * time.Millisecond
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(opts.DirPath)
+	}()
+
+	iter := db.NewIterator(DefaultIteratorOptions)
+	for n := 0; n < 10; n++ {
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", n))))
+		}
+	}
+	// 迭代器没有关闭时，merge的结果留在merge目录中，不会替换数据文件
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(db.getMergePath(), data.MergeFinishedFileName))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = os.Stat(data.GetDataFileName(opts.DirPath, 0))
+	assert.Nil(t, err)
+	iter.Close()
+	iter.Close()
+	assert.Equal(t, int32(0), db.iterators)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_9"), value)
+	}
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_AutoMergeOptions(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-auto-merge-opts")
+	defer func() {
+		_ = os.RemoveAll(opts.DirPath)
+	}()
+
+	opts.MergeRatio = 1.5
+	_, err := Open(opts)
+	assert.Equal(t, ErrInvalidMergeRatio, err)
+
+	// 关闭自动merge时不启动后台goroutine
+	opts.MergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.mergeStopCh)
+	assert.Nil(t, db.Close())
+}
+
+func Test_inMergeWindow(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, 1, 1, hour, 30, 0, 0, time.Local)
+	}
+	testCases := []struct {
+		name  string
+		now   time.Time
+		start time.Duration
+		end   time.Duration
+		want  bool
+	}{
+		{name: "不限制时间窗口", now: at(12), want: true},
+		{name: "在时间窗口内", now: at(3), start: 2 * time.Hour, end: 5 * time.Hour, want: true},
+		{name: "在时间窗口外", now: at(12), start: 2 * time.Hour, end: 5 * time.Hour, want: false},
+		{name: "跨越0点的时间窗口内", now: at(23), start: 22 * time.Hour, end: 2 * time.Hour, want: true},
+		{name: "跨越0点的时间窗口内-次日", now: at(1), start: 22 * time.Hour, end: 2 * time.Hour, want: true},
+		{name: "跨越0点的时间窗口外", now: at(12), start: 22 * time.Hour, end: 2 * time.Hour, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, inMergeWindow(tc.now, tc.start, tc.end))
+		})
+	}
+}
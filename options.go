@@ -1,6 +1,11 @@
 package sirius
 
-import "os"
+import (
+	"Sirius/data"
+	"Sirius/fio"
+	"os"
+	"time"
+)
 
 type Options struct {
 	// 数据库数据目录
@@ -14,6 +19,46 @@ type Options struct {
 
 	// 索引类型
 	IndexType IndexType
+
+	// 启动时是否使用MMap加载数据文件
+	MMapAtStartup bool
+
+	// 无效数据占比达到这个阈值时在后台自动merge，为0时不自动merge
+	MergeRatio float32
+
+	// 后台检查是否需要自动merge的时间间隔
+	MergeCheckInterval time.Duration
+
+	// 允许自动merge的时间窗口，是一天中距离0点的时间，例如2*time.Hour表示凌晨两点
+	// Start和End相等时不限制时间，End小于Start时表示跨越0点
+	MergeWindowStart time.Duration
+	MergeWindowEnd   time.Duration
+
+	// 只读模式，不能写入数据，也不会修改或者创建数据目录中的文件
+	// 只读模式对数据目录加共享锁，多个只读实例可以同时打开，但是不能和写入的实例同时打开
+	ReadOnly bool
+
+	// 启动时发现数据文件损坏的处理策略
+	RecoveryPolicy RecoveryPolicy
+
+	// 内存模式，数据文件只保存在内存中，不会访问文件系统，关闭之后数据全部丢失
+	// 内存模式下不需要设置DirPath
+	InMemory bool
+
+	// value的压缩算法，只影响之后写入的数据，已经写入的数据按照记录中的压缩算法读取
+	Compression Compression
+
+	// 小于这个长度的value不压缩，压缩很短的数据几乎没有收益
+	CompressionThreshold int
+
+	// 数据文件加密配置，默认不加密
+	Encryption EncryptionOptions
+
+	// 记录的crc校验算法，只影响之后创建的数据文件，已经存在的数据文件按照文件头中记录的算法读写
+	Checksum Checksum
+
+	// 创建数据文件IOManager的方法，为nil时使用fio.NewIOManager，测试时可以用来注入IO故障
+	IOManagerFactory fio.IOManagerFactory
 }
 
 type IndexType = int8
@@ -26,9 +71,98 @@ const (
 	ART
 )
 
+// RecoveryPolicy 启动时数据文件损坏的处理策略
+// 进程在写入时崩溃，活跃文件的末尾会留下写了一半的记录
+type RecoveryPolicy = int8
+
+const (
+	// RecoveryTruncate 将活跃文件截断到最后一条完整的记录，旧文件损坏时返回错误，是默认的策略
+	RecoveryTruncate RecoveryPolicy = iota
+
+	// RecoveryFail 任何数据文件损坏都返回错误
+	RecoveryFail
+
+	// RecoverySkip 跳过所有数据文件中损坏的数据，活跃文件末尾损坏的数据仍然会被截断
+	RecoverySkip
+)
+
+// EncryptionOptions 数据文件加密配置，开启之后每条记录的key和value都使用AES-GCM加密
+// 开启加密之前创建的数据文件仍然以明文读取，merge之后全部加密
+type EncryptionOptions struct {
+	// 提供加密使用的密钥，为nil时不加密
+	// 轮换密钥时修改ActiveKeyID，新的数据文件使用新的密钥，旧的密钥在merge完成之前仍然需要保留
+	KeyProvider KeyProvider
+}
+
+// KeyProvider 提供加密数据文件使用的密钥
+type KeyProvider = data.KeyProvider
+
+// StaticKeyProvider 保存在内存中的一组密钥
+type StaticKeyProvider = data.StaticKeyProvider
+
+// Compression value的压缩算法
+type Compression = data.Codec
+
+const (
+	// NoCompression 不压缩，是默认的配置
+	NoCompression Compression = data.CodecNone
+
+	// FlateCompression deflate压缩，压缩率高，适合冷数据
+	FlateCompression Compression = data.CodecFlate
+
+	// LZCompression LZ77压缩，压缩率不如deflate，但是写入和读取的速度快很多
+	LZCompression Compression = data.CodecLZ
+)
+
+// Checksum 记录的crc校验算法
+type Checksum = data.Checksum
+
+const (
+	// ChecksumCRC32C CRC32C校验，大部分CPU上有硬件加速，是默认的配置
+	ChecksumCRC32C Checksum = data.ChecksumCRC32C
+
+	// ChecksumIEEE IEEE校验，和旧版本写入的数据文件一致
+	ChecksumIEEE Checksum = data.ChecksumIEEE
+)
+
 var DefaultOptions = Options{
-	DirPath:      os.TempDir(),
-	DataFileSize: 256 * 1024 * 1024,
-	SyncWrites:   false,
-	IndexType:    Btree,
+	DirPath:              os.TempDir(),
+	DataFileSize:         256 * 1024 * 1024,
+	SyncWrites:           false,
+	IndexType:            Btree,
+	MMapAtStartup:        true,
+	MergeRatio:           0.5,
+	MergeCheckInterval:   10 * time.Minute,
+	RecoveryPolicy:       RecoveryTruncate,
+	Compression:          NoCompression,
+	CompressionThreshold: 128,
+	Checksum:             ChecksumCRC32C,
+}
+
+// IteratorOptions 迭代器配置项
+type IteratorOptions struct {
+	// 遍历前缀为指定值的key，默认为空
+	Prefix []byte
+
+	// 是否反向遍历，默认false是正向
+	Reverse bool
+}
+
+var DefaultIteratorOptions = IteratorOptions{
+	Prefix:  nil,
+	Reverse: false,
+}
+
+// WriteBatchOptions 批量写入配置项
+type WriteBatchOptions struct {
+	// 一个批次中最多的数据量
+	MaxBatchNum uint
+
+	// 提交时是否持久化到磁盘
+	SyncWrites bool
+}
+
+var DefaultWriteBatchOptions = WriteBatchOptions{
+	MaxBatchNum: 10000,
+	SyncWrites:  true,
 }
@@ -0,0 +1,95 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"io"
+	"log"
+)
+
+// CorruptedRegion 启动时在数据文件中发现的一段损坏的数据
+type CorruptedRegion struct {
+	Fid    uint32 // 数据文件id
+	Offset int64  // 损坏数据的起始位置
+	Size   int64  // 损坏数据的长度，以字节为单位
+	Err    error  // 读取这段数据时的错误
+
+	// Truncated 是否已经从活跃文件中截断，为false时表示被跳过，数据仍然在文件中
+	// 只读模式下不会修改数据文件，活跃文件末尾损坏的数据也只是被跳过
+	Truncated bool
+}
+
+// RecoveryReport 打开数据库时处理损坏数据的结果
+type RecoveryReport struct {
+	// Regions 被截断或者跳过的损坏数据，按照文件id和偏移排序，数据文件完好时为空
+	Regions []CorruptedRegion
+}
+
+// Recovery 返回打开数据库时处理损坏数据的结果
+func (db *DB) Recovery() RecoveryReport {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return RecoveryReport{Regions: append([]CorruptedRegion(nil), db.recovery.Regions...)}
+}
+
+// recoverCorruption 加载索引时在offset处读到了无法解析的数据，根据恢复策略决定如何处理
+// 返回下一条记录的偏移，返回数据文件的长度表示这个文件剩余的数据都不需要再读取
+func (db *DB) recoverCorruption(dataFile *data.DataFile, offset int64, cause error) (int64, error) {
+	// 记录不完整时ReadLogRecord返回的是io.EOF，但是并没有读到文件末尾
+	if cause == io.EOF {
+		cause = io.ErrUnexpectedEOF
+	}
+	isActive := dataFile.FileId == db.activeFile.FileId
+
+	var next = dataFile.WriteOff
+	switch db.options.RecoveryPolicy {
+	case RecoveryFail:
+		return 0, cause
+	case RecoveryTruncate:
+		if !isActive {
+			return 0, cause
+		}
+	case RecoverySkip:
+		next = findNextRecord(dataFile, offset)
+	}
+
+	region := CorruptedRegion{Fid: dataFile.FileId, Offset: offset, Size: next - offset, Err: cause}
+	db.recovery.Regions = append(db.recovery.Regions, region)
+	if isActive && next == dataFile.WriteOff {
+		// 活跃文件末尾的损坏数据在加载完成之后截断，后续的写入从这里继续
+		log.Printf("sirius: found %d corrupted bytes at the end of active data file %d at offset %d: %v",
+			region.Size, region.Fid, region.Offset, cause)
+	} else {
+		// 被跳过的数据不会再被读取，merge时会被清理
+		log.Printf("sirius: skipped %d corrupted bytes in data file %d at offset %d: %v",
+			region.Size, region.Fid, region.Offset, cause)
+		db.addDeadBytes(dataFile.FileId, region.Size)
+	}
+	return next, nil
+}
+
+// truncateActiveFile 截断活跃文件末尾损坏的数据，需要在数据文件切换回标准文件IO之后调用
+func (db *DB) truncateActiveFile() error {
+	if len(db.recovery.Regions) == 0 {
+		return nil
+	}
+	last := &db.recovery.Regions[len(db.recovery.Regions)-1]
+	if last.Fid != db.activeFile.FileId || last.Offset+last.Size < db.activeFile.WriteOff {
+		return nil
+	}
+	if err := db.activeFile.Truncate(last.Offset); err != nil {
+		return err
+	}
+	last.Truncated = true
+	return nil
+}
+
+// findNextRecord 从offset之后逐字节查找下一条可以完整解析并且通过校验的记录
+// 找不到时返回数据文件的长度
+func findNextRecord(dataFile *data.DataFile, offset int64) int64 {
+	for offset++; offset < dataFile.WriteOff; offset++ {
+		if _, _, err := dataFile.ReadLogRecord(offset); err == nil {
+			return offset
+		}
+	}
+	return dataFile.WriteOff
+}
@@ -0,0 +1,201 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 每条记录21字节，每个数据文件5条记录，20条记录写满4个数据文件，3号文件是活跃文件
+const recoveryTestRecordSize = 21
+
+func recoveryTestKey(i int) []byte {
+	return []byte(fmt.Sprintf("key_%02d", i))
+}
+
+func recoveryTestValue(i int) []byte {
+	return []byte(fmt.Sprintf("value_%02d", i))
+}
+
+// corruptFile 修改数据文件中offset处的一个字节，offset是不包括文件头的偏移
+func corruptFile(t *testing.T, dirPath string, fid uint32, offset int64) {
+	fileName := data.GetDataFileName(dirPath, fid)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	content[data.FileHeaderSize+offset] ^= 0xff
+	assert.Nil(t, os.WriteFile(fileName, content, 0644))
+}
+
+// appendTornRecord 在活跃文件末尾写入半条记录，模拟写入时进程崩溃
+func appendTornRecord(t *testing.T, dirPath string) {
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   recoveryTestKey(20),
+		Value: recoveryTestValue(20),
+	})
+	file, err := os.OpenFile(data.GetDataFileName(dirPath, 3), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write(encRecord[:15])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+}
+
+func TestDB_Recovery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policy   RecoveryPolicy
+		readOnly bool
+		// 关闭数据库之后破坏数据文件
+		corrupt func(t *testing.T, dirPath string)
+
+		wantErr     error
+		wantRegions []CorruptedRegion
+		// 重新打开之后丢失的key
+		lostKeys []int
+		// 活跃文件的大小
+		wantActiveSize int64
+	}{
+		{
+			name:           "数据文件完好",
+			policy:         RecoveryFail,
+			corrupt:        func(t *testing.T, dirPath string) {},
+			wantActiveSize: 5 * recoveryTestRecordSize,
+		},
+		{
+			name:           "截断活跃文件末尾写了一半的记录",
+			policy:         RecoveryTruncate,
+			corrupt:        appendTornRecord,
+			wantRegions:    []CorruptedRegion{{Fid: 3, Offset: 105, Size: 15, Err: io.ErrUnexpectedEOF, Truncated: true}},
+			wantActiveSize: 5 * recoveryTestRecordSize,
+		},
+		{
+			name:   "截断活跃文件中校验失败的记录",
+			policy: RecoveryTruncate,
+			corrupt: func(t *testing.T, dirPath string) {
+				corruptFile(t, dirPath, 3, 5*recoveryTestRecordSize-1)
+			},
+			wantRegions:    []CorruptedRegion{{Fid: 3, Offset: 84, Size: 21, Err: data.ErrInvalidCRC, Truncated: true}},
+			lostKeys:       []int{19},
+			wantActiveSize: 4 * recoveryTestRecordSize,
+		},
+		{
+			name:           "只读模式下不截断",
+			policy:         RecoveryTruncate,
+			readOnly:       true,
+			corrupt:        appendTornRecord,
+			wantRegions:    []CorruptedRegion{{Fid: 3, Offset: 105, Size: 15, Err: io.ErrUnexpectedEOF}},
+			wantActiveSize: 5*recoveryTestRecordSize + 15,
+		},
+		{
+			name:    "失败策略下写了一半的记录返回错误",
+			policy:  RecoveryFail,
+			corrupt: appendTornRecord,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "截断策略下旧文件损坏返回错误",
+			policy: RecoveryTruncate,
+			corrupt: func(t *testing.T, dirPath string) {
+				corruptFile(t, dirPath, 1, 2*recoveryTestRecordSize+20)
+			},
+			wantErr: data.ErrInvalidCRC,
+		},
+		{
+			name:   "跳过旧文件中损坏的数据",
+			policy: RecoverySkip,
+			corrupt: func(t *testing.T, dirPath string) {
+				corruptFile(t, dirPath, 1, 2*recoveryTestRecordSize+20)
+				corruptFile(t, dirPath, 2, 0)
+				appendTornRecord(t, dirPath)
+			},
+			wantRegions: []CorruptedRegion{
+				{Fid: 1, Offset: 42, Size: 21, Err: data.ErrInvalidCRC},
+				{Fid: 2, Offset: 0, Size: 21, Err: data.ErrInvalidCRC},
+				{Fid: 3, Offset: 105, Size: 15, Err: io.ErrUnexpectedEOF, Truncated: true},
+			},
+			lostKeys:       []int{7, 10},
+			wantActiveSize: 5 * recoveryTestRecordSize,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-recovery")
+			opts.DataFileSize = 5 * recoveryTestRecordSize
+			opts.RecoveryPolicy = tc.policy
+			defer os.RemoveAll(opts.DirPath)
+
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			for i := 0; i < 20; i++ {
+				assert.Nil(t, db.Put(recoveryTestKey(i), recoveryTestValue(i)))
+			}
+			assert.Nil(t, db.Close())
+			// 删除索引快照，重启时读取所有的数据文件
+			assert.Nil(t, os.Remove(filepath.Join(opts.DirPath, data.HintFileName)))
+			tc.corrupt(t, opts.DirPath)
+
+			opts.ReadOnly = tc.readOnly
+			db, err = Open(opts)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantRegions, db.Recovery().Regions)
+			for i := 0; i < 20; i++ {
+				value, err := db.Get(recoveryTestKey(i))
+				if containsInt(tc.lostKeys, i) {
+					assert.Equal(t, ErrKeyNotFound, err)
+				} else {
+					assert.Nil(t, err)
+					assert.Equal(t, recoveryTestValue(i), value)
+				}
+			}
+			info, err := os.Stat(data.GetDataFileName(opts.DirPath, 3))
+			assert.Nil(t, err)
+			assert.Equal(t, data.FileHeaderSize+tc.wantActiveSize, info.Size())
+			if tc.readOnly {
+				assert.Nil(t, db.Close())
+				return
+			}
+
+			// 恢复之后可以继续写入，merge也能正常完成，重启之后数据不会丢失
+			assert.Nil(t, db.Put(recoveryTestKey(20), recoveryTestValue(20)))
+			assert.Nil(t, db.Merge())
+			assert.Nil(t, db.Close())
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			assert.Empty(t, db.Recovery().Regions)
+			for i := 0; i <= 20; i++ {
+				_, err := db.Get(recoveryTestKey(i))
+				if containsInt(tc.lostKeys, i) {
+					assert.Equal(t, ErrKeyNotFound, err)
+				} else {
+					assert.Nil(t, err)
+				}
+			}
+			assert.Nil(t, db.Close())
+		})
+	}
+}
+
+func containsInt(keys []int, i int) bool {
+	for _, key := range keys {
+		if key == i {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDB_InvalidRecoveryPolicy(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-recovery")
+	opts.RecoveryPolicy = RecoverySkip + 1
+	_, err := Open(opts)
+	assert.Equal(t, ErrInvalidRecoveryPolicy, err)
+}
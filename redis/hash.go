@@ -0,0 +1,78 @@
+package redis
+
+import (
+	sirius "Sirius"
+)
+
+// HSet 设置Hash中field对应的value，field是新增的返回true
+func (rds *DataStructure) HSet(key, field, value []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, Hash)
+	if err != nil {
+		return false, err
+	}
+	fieldKey := subKey(key, meta.version, field)
+
+	// 判断field是否已经存在
+	var exist = true
+	if _, err := rds.db.Get(fieldKey); err == sirius.ErrKeyNotFound {
+		exist = false
+	} else if err != nil {
+		return false, err
+	}
+
+	// 元数据和数据部分一起原子写入
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	if !exist {
+		meta.size++
+		_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	}
+	_ = wb.Put(fieldKey, value)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return !exist, nil
+}
+
+// HGet 获取Hash中field对应的value，不存在时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) HGet(key, field []byte) ([]byte, error) {
+	meta, err := rds.findMetadata(key, Hash)
+	if err != nil {
+		return nil, err
+	}
+	if meta.size == 0 {
+		return nil, sirius.ErrKeyNotFound
+	}
+	return rds.db.Get(subKey(key, meta.version, field))
+}
+
+// HDel 删除Hash中的field，field存在并且被删除时返回true
+func (rds *DataStructure) HDel(key, field []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, Hash)
+	if err != nil {
+		return false, err
+	}
+	if meta.size == 0 {
+		return false, nil
+	}
+	fieldKey := subKey(key, meta.version, field)
+	if _, err := rds.db.Get(fieldKey); err == sirius.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	meta.size--
+	_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	_ = wb.Delete(fieldKey)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
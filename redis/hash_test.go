@@ -0,0 +1,41 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataStructure_Hash(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-hash")
+
+	ok, err := rds.HSet([]byte("user"), []byte("name"), []byte("zhangsan"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// 覆盖已经存在的field
+	ok, err = rds.HSet([]byte("user"), []byte("name"), []byte("lisi"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.HSet([]byte("user"), []byte("age"), []byte("18"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	value, err := rds.HGet([]byte("user"), []byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("lisi"), value)
+	_, err = rds.HGet([]byte("user"), []byte("email"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+
+	ok, err = rds.HDel([]byte("user"), []byte("name"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.HDel([]byte("user"), []byte("name"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.HGet([]byte("user"), []byte("name"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+
+	// 类型不匹配
+	_, err = rds.SAdd([]byte("user"), []byte("m1"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"encoding/binary"
+)
+
+// LPush 在List的头部插入元素，返回插入之后List的长度
+func (rds *DataStructure) LPush(key, element []byte) (uint32, error) {
+	return rds.pushInner(key, element, true)
+}
+
+// RPush 在List的尾部插入元素，返回插入之后List的长度
+func (rds *DataStructure) RPush(key, element []byte) (uint32, error) {
+	return rds.pushInner(key, element, false)
+}
+
+// LPop 弹出List头部的元素，List为空时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) LPop(key []byte) ([]byte, error) {
+	return rds.popInner(key, true)
+}
+
+// RPop 弹出List尾部的元素，List为空时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) RPop(key []byte) ([]byte, error) {
+	return rds.popInner(key, false)
+}
+
+// pushInner 插入元素，head为[head, tail)区间的左端，tail为右端
+func (rds *DataStructure) pushInner(key, element []byte, isLeft bool) (uint32, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, List)
+	if err != nil {
+		return 0, err
+	}
+
+	var index = meta.tail
+	if isLeft {
+		index = meta.head - 1
+	}
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	meta.size++
+	if isLeft {
+		meta.head--
+	} else {
+		meta.tail++
+	}
+	_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	_ = wb.Put(listElementKey(key, meta.version, index), element)
+	if err := wb.Commit(); err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// popInner 弹出元素
+func (rds *DataStructure) popInner(key []byte, isLeft bool) ([]byte, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, List)
+	if err != nil {
+		return nil, err
+	}
+	if meta.size == 0 {
+		return nil, sirius.ErrKeyNotFound
+	}
+
+	var index = meta.tail - 1
+	if isLeft {
+		index = meta.head
+	}
+	elementKey := listElementKey(key, meta.version, index)
+	element, err := rds.db.Get(elementKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	meta.size--
+	if isLeft {
+		meta.head++
+	} else {
+		meta.tail--
+	}
+	_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	_ = wb.Delete(elementKey)
+	if err := wb.Commit(); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// listElementKey List中元素的key，元素的位置使用8字节大端编码
+func listElementKey(key []byte, version int64, index uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	return subKey(key, version, buf)
+}
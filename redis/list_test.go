@@ -0,0 +1,37 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataStructure_List(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-list")
+
+	_, err := rds.LPop([]byte("queue"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+
+	// b a c
+	size, err := rds.LPush([]byte("queue"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), size)
+	size, err = rds.LPush([]byte("queue"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), size)
+	size, err = rds.RPush([]byte("queue"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+
+	element, err := rds.LPop([]byte("queue"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), element)
+	element, err = rds.RPop([]byte("queue"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), element)
+	element, err = rds.RPop([]byte("queue"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), element)
+	_, err = rds.RPop([]byte("queue"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+}
@@ -0,0 +1,199 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// metaKeyTag 元数据的key的第一个字节
+	metaKeyTag byte = iota + 1
+	// subKeyTag 数据部分的key的第一个字节，元数据和数据部分的key不会重叠
+	subKeyTag
+)
+
+const (
+	// maxMetadataSize 元数据编码之后的最大长度
+	maxMetadataSize = 1 + binary.MaxVarintLen64*2 + binary.MaxVarintLen32
+
+	// extraListMetaSize List元数据额外的head和tail的最大长度
+	extraListMetaSize = binary.MaxVarintLen64 * 2
+
+	// initialListMark List的head和tail的初始值，从中间开始，两端都可以继续插入
+	initialListMark = math.MaxUint64 / 2
+)
+
+// metadata 集合的元数据
+type metadata struct {
+	dataType DataType // 数据类型
+	expire   int64    // 过期时间，unix纳秒时间戳，0表示永不过期
+	version  int64    // 版本号，重新创建集合时会生成新的版本号
+	size     uint32   // 集合中的数据量
+	head     uint64   // List专用，第一个元素的位置
+	tail     uint64   // List专用，最后一个元素的下一个位置
+}
+
+// encodeMetadata 编码元数据
+// +----------+--------+---------+------+----------------+
+// | Type(1B) | Expire | Version | Size | [Head] [Tail]  |
+// +----------+--------+---------+------+----------------+
+func encodeMetadata(meta *metadata) []byte {
+	var size = maxMetadataSize
+	if meta.dataType == List {
+		size += extraListMetaSize
+	}
+	buf := make([]byte, size)
+
+	buf[0] = meta.dataType
+	var index = 1
+	index += binary.PutVarint(buf[index:], meta.expire)
+	index += binary.PutVarint(buf[index:], meta.version)
+	index += binary.PutVarint(buf[index:], int64(meta.size))
+	if meta.dataType == List {
+		index += binary.PutUvarint(buf[index:], meta.head)
+		index += binary.PutUvarint(buf[index:], meta.tail)
+	}
+	return buf[:index]
+}
+
+// decodeMetadata 解码元数据，数据不完整时返回ErrInvalidMetadata
+func decodeMetadata(buf []byte) (*metadata, error) {
+	if len(buf) == 0 {
+		return nil, ErrInvalidMetadata
+	}
+	dataType := buf[0]
+	var index = 1
+	var fields [3]int64
+	for i := range fields {
+		value, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, ErrInvalidMetadata
+		}
+		fields[i] = value
+		index += n
+	}
+
+	meta := &metadata{dataType: dataType, expire: fields[0], version: fields[1], size: uint32(fields[2])}
+	if dataType == List {
+		var n int
+		if meta.head, n = binary.Uvarint(buf[index:]); n <= 0 {
+			return nil, ErrInvalidMetadata
+		}
+		index += n
+		if meta.tail, n = binary.Uvarint(buf[index:]); n <= 0 {
+			return nil, ErrInvalidMetadata
+		}
+	}
+	return meta, nil
+}
+
+// readMetadata 读取元数据，不判断是否过期
+func (rds *DataStructure) readMetadata(key []byte) (*metadata, error) {
+	metaBuf, err := rds.db.Get(metaKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(metaBuf)
+}
+
+// getMetadata 获取没有过期的元数据，元数据不存在或者已经过期时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) getMetadata(key []byte) (*metadata, error) {
+	meta, err := rds.readMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+	if meta.expire != 0 && meta.expire <= time.Now().UnixNano() {
+		return nil, sirius.ErrKeyNotFound
+	}
+	return meta, nil
+}
+
+// findMetadata 查找元数据，集合不存在或者已经过期时初始化一个新版本的元数据
+func (rds *DataStructure) findMetadata(key []byte, dataType DataType) (*metadata, error) {
+	meta, err := rds.getMetadata(key)
+	if err != nil && err != sirius.ErrKeyNotFound {
+		return nil, err
+	}
+	if err == sirius.ErrKeyNotFound {
+		meta = &metadata{
+			dataType: dataType,
+			version:  time.Now().UnixNano(),
+		}
+		if dataType == List {
+			meta.head = initialListMark
+			meta.tail = initialListMark
+		}
+		return meta, nil
+	}
+	if meta.dataType != dataType {
+		return nil, ErrWrongTypeOperation
+	}
+	return meta, nil
+}
+
+// findMetadataForUpdate 写入之前查找元数据，调用方需要持有rds.mu
+// 集合已经过期时会使用新的版本，旧版本的数据部分交给后台清理
+func (rds *DataStructure) findMetadataForUpdate(key []byte, dataType DataType) (*metadata, error) {
+	old, err := rds.readMetadata(key)
+	if err != nil && err != sirius.ErrKeyNotFound {
+		return nil, err
+	}
+	if err == nil && old.expire != 0 && old.expire <= time.Now().UnixNano() {
+		rds.markStale(key)
+	}
+	return rds.findMetadata(key, dataType)
+}
+
+// metaKey 编码集合元数据的key
+// +-------------+-----+
+// | MetaTag(1B) | Key |
+// +-------------+-----+
+func metaKey(key []byte) []byte {
+	buf := make([]byte, 1+len(key))
+	buf[0] = metaKeyTag
+	copy(buf[1:], key)
+	return buf
+}
+
+// subKeyPrefix 集合所有版本的数据部分共同的前缀，key带有长度，不会是其他集合的前缀
+// +------------+---------+-----+
+// | SubTag(1B) | KeySize | Key |
+// +------------+---------+-----+
+func subKeyPrefix(key []byte) []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen32+len(key))
+	buf[0] = subKeyTag
+	var index = 1
+	index += binary.PutUvarint(buf[index:], uint64(len(key)))
+	index += copy(buf[index:], key)
+	return buf[:index]
+}
+
+// subKey 编码集合数据部分的key
+// +------------+---------+-----+---------+------+
+// | SubTag(1B) | KeySize | Key | Version | Part |
+// +------------+---------+-----+---------+------+
+func subKey(key []byte, version int64, parts ...[]byte) []byte {
+	buf := subKeyPrefix(key)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(version))
+	for _, part := range parts {
+		buf = append(buf, part...)
+	}
+	return buf
+}
+
+// decodeSubKey 从数据部分的key中解析出集合的key和版本号
+func decodeSubKey(buf []byte) ([]byte, int64, bool) {
+	if len(buf) == 0 || buf[0] != subKeyTag {
+		return nil, 0, false
+	}
+	keySize, n := binary.Uvarint(buf[1:])
+	if n <= 0 || uint64(len(buf)-1-n) < keySize+8 {
+		return nil, 0, false
+	}
+	var index = 1 + n
+	key := buf[index : index+int(keySize)]
+	index += int(keySize)
+	return key, int64(binary.BigEndian.Uint64(buf[index:])), true
+}
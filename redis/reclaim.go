@@ -0,0 +1,117 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"bytes"
+	"log"
+)
+
+// reclaimer 在后台删除旧版本的数据部分
+// Del以及集合过期之后只修改元数据，旧版本的数据部分不会再被读取，由后台按批次删除，不会阻塞其他操作
+type reclaimer struct {
+	// pending 等待清理的集合，由rds.mu保护
+	pending map[string]struct{}
+	notify  chan struct{}
+	closeCh chan struct{}
+	done    chan struct{}
+}
+
+// markStale 记录集合存在需要清理的旧版本，调用方需要持有rds.mu
+func (rds *DataStructure) markStale(key []byte) {
+	rds.reclaimer.pending[string(key)] = struct{}{}
+	select {
+	case rds.reclaimer.notify <- struct{}{}:
+	default:
+	}
+}
+
+// runReclaimer 后台清理的主循环，启动时先清理一遍所有的数据部分，包括进程崩溃之前没有清理完的
+func (rds *DataStructure) runReclaimer() {
+	defer close(rds.reclaimer.done)
+	if err := rds.reclaim([]byte{subKeyTag}); err != nil {
+		log.Printf("sirius redis: reclaim stale sub keys failed: %v", err)
+	}
+	for {
+		select {
+		case <-rds.reclaimer.closeCh:
+			return
+		case <-rds.reclaimer.notify:
+		}
+		if err := rds.reclaimPending(); err != nil {
+			log.Printf("sirius redis: reclaim stale sub keys failed: %v", err)
+		}
+	}
+}
+
+// reclaimPending 清理所有等待清理的集合，失败的集合留到下一次
+func (rds *DataStructure) reclaimPending() error {
+	rds.mu.Lock()
+	pending := rds.reclaimer.pending
+	rds.reclaimer.pending = make(map[string]struct{})
+	rds.mu.Unlock()
+
+	for key := range pending {
+		if err := rds.reclaim(subKeyPrefix([]byte(key))); err != nil {
+			rds.mu.Lock()
+			rds.markStale([]byte(key))
+			rds.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// reclaim 删除prefix下所有版本和元数据不一致的数据部分
+// 迭代器是创建时的快照，快照中的数据部分写入时元数据已经在同一个批次中写入了，
+// 之后元数据的版本不一致或者已经过期，说明这个版本已经被删除，不会再被读写，不需要持有rds.mu
+func (rds *DataStructure) reclaim(prefix []byte) error {
+	it := rds.db.NewIterator(sirius.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+
+	var (
+		lastKey     []byte
+		liveVersion int64
+		live        bool
+	)
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	var count uint
+	for ; it.Valid(); it.Next() {
+		select {
+		case <-rds.reclaimer.closeCh:
+			return nil
+		default:
+		}
+		key, version, ok := decodeSubKey(it.Key())
+		if !ok {
+			continue
+		}
+		if lastKey == nil || !bytes.Equal(key, lastKey) {
+			lastKey = append([]byte{}, key...)
+			meta, err := rds.getMetadata(key)
+			if err != nil && err != sirius.ErrKeyNotFound {
+				return err
+			}
+			live = err == nil
+			if live {
+				liveVersion = meta.version
+			}
+		}
+		if live && version == liveVersion {
+			continue
+		}
+
+		_ = wb.Delete(it.Key())
+		count++
+		if count == rds.wbOptions.MaxBatchNum {
+			if err := wb.Commit(); err != nil {
+				return err
+			}
+			wb = rds.db.NewWriteBatch(rds.wbOptions)
+			count = 0
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return wb.Commit()
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	sirius "Sirius"
+)
+
+// SAdd 向Set中添加member，member是新增的返回true
+func (rds *DataStructure) SAdd(key, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, Set)
+	if err != nil {
+		return false, err
+	}
+	memberKey := subKey(key, meta.version, member)
+	if _, err := rds.db.Get(memberKey); err == nil {
+		return false, nil
+	} else if err != sirius.ErrKeyNotFound {
+		return false, err
+	}
+
+	// Set只需要key，数据部分的value为空
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	meta.size++
+	_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	_ = wb.Put(memberKey, nil)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SIsMember 判断member是否在Set中
+func (rds *DataStructure) SIsMember(key, member []byte) (bool, error) {
+	meta, err := rds.findMetadata(key, Set)
+	if err != nil {
+		return false, err
+	}
+	if meta.size == 0 {
+		return false, nil
+	}
+	_, err = rds.db.Get(subKey(key, meta.version, member))
+	if err == sirius.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SRem 从Set中删除member，member存在并且被删除时返回true
+func (rds *DataStructure) SRem(key, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, Set)
+	if err != nil {
+		return false, err
+	}
+	if meta.size == 0 {
+		return false, nil
+	}
+	memberKey := subKey(key, meta.version, member)
+	if _, err := rds.db.Get(memberKey); err == sirius.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	meta.size--
+	_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	_ = wb.Delete(memberKey)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataStructure_Set(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-set")
+
+	ok, err := rds.SIsMember([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = rds.SAdd([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.SAdd([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SIsMember([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = rds.SRem([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.SRem([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SIsMember([]byte("tags"), []byte("go"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWrongTypeOperation = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrInvalidMetadata    = errors.New("invalid metadata")
+)
+
+// DataType Redis数据结构的类型
+type DataType = byte
+
+const (
+	Hash DataType = iota + 1
+	Set
+	List
+	ZSet
+)
+
+// DataStructure Redis数据结构服务，基于sirius.DB实现
+// 每个集合由一条元数据以及若干条数据部分组成，数据部分的key包含集合的key和元数据的版本号
+// 删除整个集合或者集合过期之后，旧版本的数据部分不会再被读取，由后台删除，打开时会清理上一次没有删除完的数据部分
+type DataStructure struct {
+	db        *sirius.DB
+	mu        *sync.Mutex // 保证元数据的读-改-写是串行的
+	wbOptions sirius.WriteBatchOptions
+	reclaimer *reclaimer
+}
+
+// NewDataStructure 初始化Redis数据结构服务
+func NewDataStructure(options sirius.Options) (*DataStructure, error) {
+	db, err := sirius.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	// 元数据和数据部分一起写入时，和单独的写入一样使用数据库的持久化配置
+	wbOptions := sirius.DefaultWriteBatchOptions
+	wbOptions.SyncWrites = options.SyncWrites
+	rds := &DataStructure{
+		db:        db,
+		mu:        &sync.Mutex{},
+		wbOptions: wbOptions,
+		reclaimer: &reclaimer{
+			pending: make(map[string]struct{}),
+			notify:  make(chan struct{}, 1),
+			closeCh: make(chan struct{}),
+			done:    make(chan struct{}),
+		},
+	}
+	go rds.runReclaimer()
+	return rds, nil
+}
+
+// Close 停止后台清理，然后关闭底层的存储引擎，没有清理完的数据部分在下一次打开时清理
+func (rds *DataStructure) Close() error {
+	close(rds.reclaimer.closeCh)
+	<-rds.reclaimer.done
+	return rds.db.Close()
+}
+
+// Del 删除整个集合，只删除元数据，时间复杂度是O(1)，旧版本的数据部分由后台删除
+func (rds *DataStructure) Del(key []byte) error {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	if err := rds.db.Delete(metaKey(key)); err != nil {
+		return err
+	}
+	rds.markStale(key)
+	return nil
+}
+
+// Type 获取集合的类型，集合不存在或者已经过期时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) Type(key []byte) (DataType, error) {
+	meta, err := rds.getMetadata(key)
+	if err != nil {
+		return 0, err
+	}
+	return meta.dataType, nil
+}
+
+// Expire 设置集合的过期时间，集合不存在时返回false
+func (rds *DataStructure) Expire(key []byte, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, sirius.ErrInvalidTTL
+	}
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.getMetadata(key)
+	if err == sirius.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	meta.expire = time.Now().Add(ttl).UnixNano()
+	if err := rds.db.Put(metaKey(key), encodeMetadata(meta)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TTL 获取集合剩余的存活时间，没有设置过期时间的集合返回0，集合不存在时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) TTL(key []byte) (time.Duration, error) {
+	meta, err := rds.getMetadata(key)
+	if err != nil {
+		return 0, err
+	}
+	if meta.expire == 0 {
+		return 0, nil
+	}
+	return time.Duration(meta.expire - time.Now().UnixNano()), nil
+}
@@ -0,0 +1,279 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDataStructure 在临时目录中打开一个Redis数据结构服务，测试结束时清理
+func openTestDataStructure(t *testing.T, name string) *DataStructure {
+	opts := sirius.DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), name)
+	rds, err := NewDataStructure(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(opts.DirPath)
+	})
+	return rds
+}
+
+func TestDataStructure_Del(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-del")
+
+	ok, err := rds.HSet([]byte("hash"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	typ, err := rds.Type([]byte("hash"))
+	assert.Nil(t, err)
+	assert.Equal(t, Hash, typ)
+
+	// 删除之后重新创建的集合是新的版本，看不到旧的数据
+	assert.Nil(t, rds.Del([]byte("hash")))
+	_, err = rds.Type([]byte("hash"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+	_, err = rds.HGet([]byte("hash"), []byte("f1"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+	// 旧版本的数据部分在后台删除
+	assert.Nil(t, rds.reclaim(subKeyPrefix([]byte("hash"))))
+	assert.Equal(t, 0, subKeyCount(t, rds, []byte("hash")))
+	ok, err = rds.HSet([]byte("hash"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, err = rds.HGet([]byte("hash"), []byte("f1"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+}
+
+func TestDataStructure_DelLargeCollection(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-del-large")
+	// 数据部分比一个批次多，需要分多次删除
+	rds.wbOptions.MaxBatchNum = 3
+	for i := 0; i < 10; i++ {
+		_, err := rds.SAdd([]byte("set"), []byte{byte(i)})
+		assert.Nil(t, err)
+	}
+	// 前缀相同的其他集合不受影响
+	_, err := rds.SAdd([]byte("set2"), []byte("m"))
+	assert.Nil(t, err)
+
+	// Del只删除元数据
+	assert.Nil(t, rds.Del([]byte("set")))
+	assert.Nil(t, rds.Del([]byte("not-exist")))
+	ok, err := rds.SIsMember([]byte("set"), []byte{0})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Nil(t, rds.reclaim([]byte{subKeyTag}))
+	assert.Equal(t, 0, subKeyCount(t, rds, []byte("set")))
+	assert.Equal(t, 1, subKeyCount(t, rds, []byte("set2")))
+	ok, err = rds.SIsMember([]byte("set2"), []byte("m"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestDataStructure_ReclaimAtStartup(t *testing.T) {
+	opts := sirius.DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-redis-reclaim")
+	defer os.RemoveAll(opts.DirPath)
+	rds, err := NewDataStructure(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := rds.HSet([]byte("hash"), []byte{byte(i)}, []byte("v"))
+		assert.Nil(t, err)
+	}
+	// 模拟删除元数据之后，后台还没有清理数据部分进程就退出了
+	assert.Nil(t, rds.db.Delete(metaKey([]byte("hash"))))
+	_, err = rds.HSet([]byte("live"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Nil(t, rds.Close())
+
+	rds, err = NewDataStructure(opts)
+	assert.Nil(t, err)
+	defer rds.Close()
+	assert.Eventually(t, func() bool {
+		return subKeyCount(t, rds, []byte("hash")) == 0
+	}, time.Second, time.Millisecond)
+	value, err := rds.HGet([]byte("live"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+}
+
+func TestDataStructure_BinaryKeys(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-binary")
+
+	_, err := rds.SAdd([]byte("a"), []byte("m"))
+	assert.Nil(t, err)
+	meta, err := rds.getMetadata([]byte("a"))
+	assert.Nil(t, err)
+	memberKey := subKey([]byte("a"), meta.version, []byte("m"))
+
+	testCases := []struct {
+		name string
+		key  []byte
+	}{
+		{name: "以集合的key和版本号开头的key", key: append(binary.BigEndian.AppendUint64([]byte("a"), uint64(meta.version)), 'x')},
+		{name: "和数据部分编码相同的key", key: memberKey},
+		{name: "和元数据编码相同的key", key: metaKey([]byte("a"))},
+	}
+	for _, tc := range testCases {
+		_, err := rds.HSet(tc.key, []byte("f"), []byte("v"))
+		assert.Nil(t, err)
+	}
+	// 其他集合不会覆盖a的元数据和数据部分
+	ok, err := rds.SIsMember([]byte("a"), []byte("m"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 删除a不会影响其他集合
+	assert.Nil(t, rds.Del([]byte("a")))
+	assert.Nil(t, rds.reclaim([]byte{subKeyTag}))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := rds.HGet(tc.key, []byte("f"))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("v"), value)
+		})
+	}
+	assert.Equal(t, 0, subKeyCount(t, rds, []byte("a")))
+}
+
+func TestNewDataStructure_SyncWrites(t *testing.T) {
+	for _, syncWrites := range []bool{true, false} {
+		opts := sirius.DefaultOptions
+		opts.DirPath = filepath.Join(os.TempDir(), "sirius-redis-sync")
+		opts.SyncWrites = syncWrites
+		rds, err := NewDataStructure(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, syncWrites, rds.wbOptions.SyncWrites)
+		assert.Nil(t, rds.Close())
+		assert.Nil(t, os.RemoveAll(opts.DirPath))
+	}
+}
+
+func TestDataStructure_Expire(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-expire")
+
+	ok, err := rds.Expire([]byte("set"), time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	_, err = rds.SAdd([]byte("set"), []byte("m1"))
+	assert.Nil(t, err)
+	ttl, err := rds.TTL([]byte("set"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	_, err = rds.Expire([]byte("set"), 0)
+	assert.Equal(t, sirius.ErrInvalidTTL, err)
+	ok, err = rds.Expire([]byte("set"), time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ttl, err = rds.TTL([]byte("set"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+
+	// 过期之后整个集合都不存在了
+	ok, err = rds.Expire([]byte("set"), time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	time.Sleep(5 * time.Millisecond)
+	ok, err = rds.SIsMember([]byte("set"), []byte("m1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.TTL([]byte("set"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+
+	// 过期之后重新写入时使用新的版本，旧版本的数据部分在后台删除
+	_, err = rds.SAdd([]byte("set"), []byte("m2"))
+	assert.Nil(t, err)
+	assert.Nil(t, rds.reclaim(subKeyPrefix([]byte("set"))))
+	assert.Equal(t, 1, subKeyCount(t, rds, []byte("set")))
+	ok, err = rds.SIsMember([]byte("set"), []byte("m1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+// subKeyCount 统计集合所有版本的数据部分的数量，不包括元数据
+func subKeyCount(t *testing.T, rds *DataStructure, key []byte) int {
+	keys, err := rds.db.ListKeys()
+	assert.Nil(t, err)
+	count := 0
+	for _, k := range keys {
+		if bytes.HasPrefix(k, subKeyPrefix(key)) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMetadata(t *testing.T) {
+	testCases := []struct {
+		name string
+		meta *metadata
+	}{
+		{
+			name: "Hash",
+			meta: &metadata{dataType: Hash, expire: 0, version: time.Now().UnixNano(), size: 10},
+		},
+		{
+			name: "List",
+			meta: &metadata{dataType: List, expire: 1, version: 2, size: 3, head: initialListMark - 1, tail: initialListMark + 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meta, err := decodeMetadata(encodeMetadata(tc.meta))
+			assert.Nil(t, err)
+			assert.Equal(t, tc.meta, meta)
+		})
+	}
+}
+
+func TestDecodeMetadata_Invalid(t *testing.T) {
+	listMeta := encodeMetadata(&metadata{dataType: List, version: 2, head: initialListMark, tail: initialListMark})
+	testCases := []struct {
+		name string
+		buf  []byte
+	}{
+		{name: "空数据", buf: nil},
+		{name: "只有类型", buf: []byte{Hash}},
+		{name: "缺少size", buf: encodeMetadata(&metadata{dataType: Hash, version: 1})[:2]},
+		{name: "List缺少tail", buf: listMeta[:len(listMeta)-1]},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeMetadata(tc.buf)
+			assert.Equal(t, ErrInvalidMetadata, err)
+		})
+	}
+}
+
+func TestDecodeSubKey(t *testing.T) {
+	testCases := []struct {
+		name        string
+		buf         []byte
+		wantKey     []byte
+		wantVersion int64
+		wantOk      bool
+	}{
+		{name: "数据部分", buf: subKey([]byte("key"), 7, []byte("field")), wantKey: []byte("key"), wantVersion: 7, wantOk: true},
+		{name: "空的key", buf: subKey(nil, 7), wantKey: []byte{}, wantVersion: 7, wantOk: true},
+		{name: "元数据", buf: metaKey([]byte("key"))},
+		{name: "缺少版本号", buf: subKeyPrefix([]byte("key"))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, version, ok := decodeSubKey(tc.buf)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantKey, key)
+			assert.Equal(t, tc.wantVersion, version)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// zsetMemberTag 保存member对应score的数据部分
+	zsetMemberTag byte = iota
+	// zsetScoreTag 按照score排序的数据部分，用于范围查询
+	zsetScoreTag
+)
+
+// ZAdd 向Sorted Set中添加member，已经存在时更新score，member是新增的返回true
+func (rds *DataStructure) ZAdd(key []byte, score float64, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	meta, err := rds.findMetadataForUpdate(key, ZSet)
+	if err != nil {
+		return false, err
+	}
+
+	memberKey := subKey(key, meta.version, []byte{zsetMemberTag}, member)
+	var exist = true
+	oldScore, err := rds.db.Get(memberKey)
+	if err == sirius.ErrKeyNotFound {
+		exist = false
+	} else if err != nil {
+		return false, err
+	}
+	newScore := encodeScore(score)
+	if exist && string(oldScore) == string(newScore) {
+		return false, nil
+	}
+
+	wb := rds.db.NewWriteBatch(rds.wbOptions)
+	if !exist {
+		meta.size++
+		_ = wb.Put(metaKey(key), encodeMetadata(meta))
+	} else {
+		// 删除旧的score对应的排序数据
+		_ = wb.Delete(subKey(key, meta.version, []byte{zsetScoreTag}, oldScore, member))
+	}
+	_ = wb.Put(memberKey, newScore)
+	_ = wb.Put(subKey(key, meta.version, []byte{zsetScoreTag}, newScore, member), nil)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return !exist, nil
+}
+
+// ZScore 获取member的score，member不存在时返回sirius.ErrKeyNotFound
+func (rds *DataStructure) ZScore(key []byte, member []byte) (float64, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, sirius.ErrKeyNotFound
+	}
+	score, err := rds.db.Get(subKey(key, meta.version, []byte{zsetMemberTag}, member))
+	if err != nil {
+		return 0, err
+	}
+	return decodeScore(score), nil
+}
+
+// ZRange 按照score从小到大返回排名在[start, stop]之间的member，score相同时按照member排序
+// 和Redis一样，负数表示从末尾开始计算排名，-1表示最后一个member
+func (rds *DataStructure) ZRange(key []byte, start, stop int) ([][]byte, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(meta.size)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop {
+		return nil, nil
+	}
+
+	prefix := subKey(key, meta.version, []byte{zsetScoreTag})
+	iter := rds.db.NewIterator(sirius.IteratorOptions{Prefix: prefix})
+	defer iter.Close()
+
+	var members [][]byte
+	var rank = 0
+	for iter.Rewind(); iter.Valid() && rank <= stop; iter.Next() {
+		if rank >= start {
+			// 排序数据的key是前缀+8字节的score+member
+			members = append(members, iter.Key()[len(prefix)+8:])
+		}
+		rank++
+	}
+	return members, nil
+}
+
+// encodeScore 将score编码为可以按照字节序比较大小的8字节数据
+// 正数翻转符号位，负数翻转所有位，编码之后的字节序和浮点数的大小顺序一致
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, bits)
+	return buf
+}
+
+// decodeScore 解码score
+func decodeScore(buf []byte) float64 {
+	bits := binary.BigEndian.Uint64(buf)
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	sirius "Sirius"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestDataStructure_ZSet(t *testing.T) {
+	rds := openTestDataStructure(t, "sirius-redis-zset")
+
+	for member, score := range map[string]float64{"a": 3, "b": -1.5, "c": 10, "d": 0} {
+		ok, err := rds.ZAdd([]byte("rank"), score, []byte(member))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	// 更新已经存在的member
+	ok, err := rds.ZAdd([]byte("rank"), 20, []byte("a"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	score, err := rds.ZScore([]byte("rank"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(20), score)
+	_, err = rds.ZScore([]byte("rank"), []byte("e"))
+	assert.Equal(t, sirius.ErrKeyNotFound, err)
+
+	testCases := []struct {
+		name  string
+		start int
+		stop  int
+		want  []string
+	}{
+		{name: "全部", start: 0, stop: -1, want: []string{"b", "d", "c", "a"}},
+		{name: "部分", start: 1, stop: 2, want: []string{"d", "c"}},
+		{name: "负数排名", start: -2, stop: -1, want: []string{"c", "a"}},
+		{name: "超出范围", start: 3, stop: 100, want: []string{"a"}},
+		{name: "空区间", start: 3, stop: 1, want: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			members, err := rds.ZRange([]byte("rank"), tc.start, tc.stop)
+			assert.Nil(t, err)
+			var got []string
+			for _, member := range members {
+				got = append(got, string(member))
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestEncodeScore(t *testing.T) {
+	scores := []float64{math.Inf(-1), -100.5, -1, math.Copysign(0, -1), 0, 1e-9, 1, 100.5, math.Inf(1)}
+	for i, score := range scores {
+		assert.Equal(t, score, decodeScore(encodeScore(score)))
+		if i > 0 {
+			assert.True(t, string(encodeScore(scores[i-1])) < string(encodeScore(score)))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// Stat 存储引擎的统计信息
+type Stat struct {
+	KeyNum          uint  // 没有过期的key的数量
+	DataFileNum     uint  // 数据文件的数量
+	ReclaimableSize int64 // 可以被merge清理的无效数据量，以字节为单位
+	DiskSize        int64 // 数据目录所占的磁盘空间大小，以字节为单位，内存模式下是数据文件占用的内存大小
+}
+
+// Stat 返回数据库的统计信息
+func (db *DB) Stat() (*Stat, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
+
+	var dataFiles = uint(len(db.olderFiles))
+	if db.activeFile != nil {
+		dataFiles += 1
+	}
+
+	// 内存模式下统计数据文件占用的内存大小
+	var diskSize int64
+	if db.options.InMemory {
+		for _, dataFile := range db.olderFiles {
+			diskSize += dataFile.WriteOff
+		}
+		if db.activeFile != nil {
+			diskSize += db.activeFile.WriteOff
+		}
+	} else {
+		size, err := dirSize(db.options.DirPath)
+		if err != nil {
+			return nil, err
+		}
+		diskSize = size
+	}
+	// 过期的key在被覆盖写或者merge清理之前仍然在索引中，不计入key的数量
+	var keyNum uint
+	now := time.Now()
+	db.index.Ascend(func(_ []byte, pos *data.LogRecordPos) bool {
+		if !pos.IsExpired(now) {
+			keyNum++
+		}
+		return true
+	})
+	return &Stat{
+		KeyNum:          keyNum,
+		DataFileNum:     dataFiles,
+		ReclaimableSize: db.reclaimSize,
+		DiskSize:        diskSize,
+	}, nil
+}
+
+// dirSize 获取目录下所有文件的大小
+func dirSize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dirPath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,115 @@
+package sirius
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Stat(t *testing.T) {
+	// 每条记录的大小：crc(4)+type(1)+keySize(1)+valueSize(1)+key(5)+value(5)
+	const recordSize = 4 + 1 + 1 + 1 + 5 + 5
+	// 删除标记没有value
+	const deletedSize = recordSize - 5
+
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, db *DB)
+
+		wantKeyNum      uint
+		wantReclaimable int64
+	}{
+		{
+			name:   "空数据库",
+			before: func(t *testing.T, db *DB) {},
+		},
+		{
+			name: "只有新写入的数据",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 10; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("value")))
+				}
+			},
+			wantKeyNum:      10,
+			wantReclaimable: 0,
+		},
+		{
+			name: "覆盖写和删除产生无效数据",
+			before: func(t *testing.T, db *DB) {
+				for i := 0; i < 10; i++ {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("value")))
+				}
+				assert.Nil(t, db.Put([]byte("key_0"), []byte("VALUE")))
+				assert.Nil(t, db.Delete([]byte("key_1")))
+			},
+			wantKeyNum:      9,
+			wantReclaimable: recordSize + recordSize + deletedSize,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-stat")
+			opts.DataFileSize = 64
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			tc.before(t, db)
+
+			stat, err := db.Stat()
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantKeyNum, stat.KeyNum)
+			assert.Equal(t, tc.wantReclaimable, stat.ReclaimableSize)
+			var wantDataFileNum = uint(len(db.olderFiles))
+			if db.activeFile != nil {
+				wantDataFileNum += 1
+			}
+			assert.Equal(t, wantDataFileNum, stat.DataFileNum)
+			assert.GreaterOrEqual(t, stat.DiskSize, stat.ReclaimableSize)
+			assert.Nil(t, db.Close())
+
+			// 重启之后统计信息保持一致，旧文件从索引快照中加载
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			stat, err = db.Stat()
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantKeyNum, stat.KeyNum)
+			assert.Equal(t, tc.wantReclaimable, stat.ReclaimableSize)
+			assert.Nil(t, db.Close())
+
+			_, err = db.Stat()
+			assert.Equal(t, ErrDatabaseClosed, err)
+		})
+	}
+}
+
+func TestDB_StatExpiredKeys(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-stat-expired")
+	defer os.RemoveAll(opts.DirPath)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("value")))
+	}
+	assert.Nil(t, db.PutWithTTL([]byte("key_0"), []byte("value"), time.Millisecond))
+	assert.Nil(t, db.PutWithTTL([]byte("key_1"), []byte("value"), time.Hour))
+	time.Sleep(10 * time.Millisecond)
+
+	// 过期的key还在索引中，但是不计入数量
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(9), stat.KeyNum)
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	stat, err = db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(9), stat.KeyNum)
+	assert.Nil(t, db.Close())
+}
@@ -0,0 +1,429 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Txn 事务，基于快照隔离以及提交时的冲突检测实现可串行化
+// 事务中的读取只能看到事务开始之前已经提交的数据以及事务自己的写入，写入在提交之前暂存在内存中
+// 提交时如果读过或者写过的key在事务开始之后被其他写入修改过，返回ErrTxnConflict，调用方可以重试整个事务
+type Txn struct {
+	db            *DB
+	mu            *sync.Mutex
+	readOnly      bool
+	readTs        uint64                     // 事务开始时的逻辑时间戳
+	pendingWrites map[string]*data.LogRecord // 暂存事务中的写入
+	reads         map[string]struct{}        // 事务中读过的key，用于冲突检测
+	scans         [][]byte                   // 事务中遍历过的前缀，用于检测遍历范围内新增的key(幻读)
+	done          bool                       // 是否已经提交或者回滚
+}
+
+// keyVersion key被覆盖之前的旧版本，replacedTs之前开始的事务看到的是这个版本
+type keyVersion struct {
+	replacedTs uint64
+	pos        *data.LogRecordPos // 为nil表示key在这个版本中不存在
+}
+
+// Begin 开启一个事务，只读事务不能写入数据
+func (db *DB) Begin(readOnly bool) (*Txn, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
+
+	// 登记活跃事务，之后的写入会保留旧版本，直到这个事务结束
+	db.activeTxns[db.txnTs]++
+	return &Txn{
+		db:            db,
+		mu:            &sync.Mutex{},
+		readOnly:      readOnly,
+		readTs:        db.txnTs,
+		pendingWrites: make(map[string]*data.LogRecord),
+		reads:         make(map[string]struct{}),
+	}, nil
+}
+
+// Get 读取事务快照中key对应的value
+func (txn *Txn) Get(key []byte) ([]byte, error) {
+	value, _, err := txn.GetWithTTL(key)
+	return value, err
+}
+
+// TTL 获取事务快照中key剩余的存活时间，永不过期的key返回0，key不存在或者已经过期时返回ErrKeyNotFound
+func (txn *Txn) TTL(key []byte) (time.Duration, error) {
+	_, ttl, err := txn.get(key, false)
+	return ttl, err
+}
+
+// GetWithTTL 使用同一个时间点读取事务快照中key对应的value以及剩余的存活时间，永不过期的key返回的ttl为0
+// 分别调用Get和TTL时key可能在两次调用之间过期
+func (txn *Txn) GetWithTTL(key []byte) ([]byte, time.Duration, error) {
+	return txn.get(key, true)
+}
+
+// get 读取key剩余的存活时间，readValue为true时同时读取value
+func (txn *Txn) get(key []byte, readValue bool) ([]byte, time.Duration, error) {
+	if len(key) == 0 {
+		return nil, 0, ErrKeyIsEmpty
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return nil, 0, ErrTxnClosed
+	}
+
+	now := time.Now()
+	var value []byte
+	var expire int64
+	// 优先读取事务自己的写入
+	if record, ok := txn.pendingWrites[string(key)]; ok {
+		if record.Type == data.LogRecordDeleted || isRecordExpired(record, now) {
+			return nil, 0, ErrKeyNotFound
+		}
+		value, expire = record.Value, record.Expire
+	} else {
+		txn.reads[string(key)] = struct{}{}
+		txn.db.lock.RLock()
+		defer txn.db.lock.RUnlock()
+		if txn.db.closed {
+			return nil, 0, ErrDatabaseClosed
+		}
+		pos := txn.db.snapshotPos(key, txn.readTs)
+		if pos == nil || pos.IsExpired(now) {
+			return nil, 0, ErrKeyNotFound
+		}
+		if readValue {
+			var err error
+			if value, err = txn.db.getValueByPosition(pos); err != nil {
+				return nil, 0, err
+			}
+		}
+		expire = pos.Expire
+	}
+	if expire == 0 {
+		return value, 0, nil
+	}
+	return value, time.Duration(expire - now.UnixNano()), nil
+}
+
+// Put 在事务中写入数据，提交之后才会生效
+func (txn *Txn) Put(key []byte, value []byte) error {
+	return txn.put(key, value, 0)
+}
+
+// PutWithTTL 在事务中写入数据，数据在ttl之后过期，提交之后才会生效
+func (txn *Txn) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return txn.put(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// put 在事务中暂存写入，expire是过期时间的unix纳秒时间戳，0表示永不过期
+func (txn *Txn) put(key []byte, value []byte, expire int64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return ErrTxnClosed
+	}
+	if txn.readOnly {
+		return ErrTxnReadOnly
+	}
+
+	txn.pendingWrites[string(key)] = &data.LogRecord{Key: key, Value: value, Type: data.LogRecordNormal, Expire: expire}
+	return nil
+}
+
+// Delete 在事务中删除数据，提交之后才会生效
+func (txn *Txn) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return ErrTxnClosed
+	}
+	if txn.readOnly {
+		return ErrTxnReadOnly
+	}
+
+	txn.pendingWrites[string(key)] = &data.LogRecord{Key: key, Type: data.LogRecordDeleted}
+	return nil
+}
+
+// Commit 提交事务，检测到冲突时返回ErrTxnConflict，事务中的写入全部不生效
+// 无论提交是否成功，事务都会结束，不能再继续使用
+func (txn *Txn) Commit() error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return ErrTxnClosed
+	}
+
+	db := txn.db
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	defer txn.finish()
+
+	if len(txn.pendingWrites) == 0 {
+		return nil
+	}
+	if db.closed {
+		return ErrDatabaseClosed
+	}
+
+	// 读过或者写过的key在事务开始之后被修改过，说明和其他写入存在冲突
+	for key := range txn.reads {
+		if db.lastWrites[key] > txn.readTs {
+			return ErrTxnConflict
+		}
+	}
+	for key := range txn.pendingWrites {
+		if db.lastWrites[key] > txn.readTs {
+			return ErrTxnConflict
+		}
+	}
+	// 遍历过的范围内在事务开始之后新增了key，遍历的结果已经不是最新的
+	if len(txn.scans) > 0 {
+		for key, ts := range db.lastWrites {
+			if ts > txn.readTs && txn.scanned([]byte(key)) {
+				return ErrTxnConflict
+			}
+		}
+	}
+
+	// 和WriteBatch一样写入，保证事务中的数据要么全部生效，要么全部不生效
+	return db.writeBatchRecords(txn.pendingWrites, db.options.SyncWrites)
+}
+
+// scanned key是否在事务遍历过的范围内
+func (txn *Txn) scanned(key []byte) bool {
+	for _, prefix := range txn.scans {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRecordExpired 事务中暂存的写入在now时刻是否已经过期
+func isRecordExpired(record *data.LogRecord, now time.Time) bool {
+	return record.Expire > 0 && record.Expire <= now.UnixNano()
+}
+
+// Rollback 回滚事务，丢弃事务中的写入，重复调用不会报错
+func (txn *Txn) Rollback() error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return nil
+	}
+
+	txn.db.lock.Lock()
+	defer txn.db.lock.Unlock()
+	txn.finish()
+	return nil
+}
+
+// finish 结束事务，并清理不再需要的旧版本，调用方需要持有db.lock
+func (txn *Txn) finish() {
+	txn.done = true
+	txn.pendingWrites = nil
+	txn.db.releaseTxn(txn.readTs)
+}
+
+// recordVersion 记录key被修改的时间戳以及被覆盖的旧版本，调用方需要持有db.lock
+func (db *DB) recordVersion(key []byte, oldPos *data.LogRecordPos) {
+	if db.lastWrites == nil {
+		db.lastWrites = make(map[string]uint64)
+		db.keyVersions = make(map[string][]*keyVersion)
+	}
+	db.lastWrites[string(key)] = db.txnTs
+	db.keyVersions[string(key)] = append(db.keyVersions[string(key)], &keyVersion{
+		replacedTs: db.txnTs,
+		pos:        oldPos,
+	})
+}
+
+// releaseTxn 注销活跃事务，清理所有活跃事务都不再需要的旧版本，调用方需要持有db.lock
+func (db *DB) releaseTxn(readTs uint64) {
+	db.activeTxns[readTs]--
+	if db.activeTxns[readTs] <= 0 {
+		delete(db.activeTxns, readTs)
+	}
+	if len(db.activeTxns) == 0 {
+		db.lastWrites = nil
+		db.keyVersions = nil
+		return
+	}
+
+	// 在最早的活跃事务开始之前被覆盖的版本，不会再被任何事务读取
+	var minReadTs uint64 = db.txnTs
+	for ts := range db.activeTxns {
+		if ts < minReadTs {
+			minReadTs = ts
+		}
+	}
+	for key, versions := range db.keyVersions {
+		i := sort.Search(len(versions), func(i int) bool {
+			return versions[i].replacedTs > minReadTs
+		})
+		if i == len(versions) {
+			delete(db.keyVersions, key)
+			delete(db.lastWrites, key)
+		} else {
+			db.keyVersions[key] = versions[i:]
+		}
+	}
+}
+
+// snapshotPos 获取readTs时刻key在内存索引中的位置，调用方需要持有db.lock
+func (db *DB) snapshotPos(key []byte, readTs uint64) *data.LogRecordPos {
+	if db.lastWrites[string(key)] <= readTs {
+		return db.index.Get(key)
+	}
+	// key在事务开始之后被修改过，找到事务开始之后第一次被覆盖的版本
+	for _, version := range db.keyVersions[string(key)] {
+		if version.replacedTs > readTs {
+			return version.pos
+		}
+	}
+	return db.index.Get(key)
+}
+
+// txnItem 事务迭代器中的一条数据，pos为nil时是事务自己写入的数据
+type txnItem struct {
+	key   []byte
+	pos   *data.LogRecordPos
+	value []byte
+}
+
+// TxnIterator 事务迭代器，遍历事务快照以及事务自己的写入
+type TxnIterator struct {
+	txn     *Txn
+	items   []*txnItem
+	index   int
+	options IteratorOptions
+}
+
+// Iterator 初始化事务迭代器，创建时就确定了遍历的数据，之后的写入对迭代器不可见
+// 遍历的前缀会被记录下来，提交时这个范围内的key在事务开始之后被修改过或者新增了key都会返回ErrTxnConflict
+func (txn *Txn) Iterator(opts IteratorOptions) (*TxnIterator, error) {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return nil, ErrTxnClosed
+	}
+	txn.scans = append(txn.scans, opts.Prefix)
+
+	db := txn.db
+	db.lock.RLock()
+	if db.closed {
+		db.lock.RUnlock()
+		return nil, ErrDatabaseClosed
+	}
+	// 先取出事务快照中的数据，事务开始之后被删除的key不在内存索引中，需要从旧版本中找回来
+	now := time.Now()
+	views := make(map[string]*txnItem)
+	addItem := func(key []byte, pos *data.LogRecordPos) {
+		if pos != nil && !pos.IsExpired(now) && bytes.HasPrefix(key, opts.Prefix) {
+			views[string(key)] = &txnItem{key: key, pos: pos}
+		}
+	}
+	// 只遍历索引中满足前缀的范围
+	indexIter := db.index.Iterator(false)
+	for indexIter.Seek(opts.Prefix); indexIter.Valid() && bytes.HasPrefix(indexIter.Key(), opts.Prefix); indexIter.Next() {
+		addItem(indexIter.Key(), db.snapshotPos(indexIter.Key(), txn.readTs))
+	}
+	indexIter.Close()
+	for key := range db.keyVersions {
+		if _, ok := views[key]; !ok {
+			addItem([]byte(key), db.snapshotPos([]byte(key), txn.readTs))
+		}
+	}
+	db.lock.RUnlock()
+
+	// 再用事务自己的写入覆盖快照中的数据
+	for key, record := range txn.pendingWrites {
+		if !bytes.HasPrefix(record.Key, opts.Prefix) {
+			continue
+		}
+		if record.Type == data.LogRecordDeleted || isRecordExpired(record, now) {
+			delete(views, key)
+		} else {
+			views[key] = &txnItem{key: record.Key, value: record.Value}
+		}
+	}
+
+	items := make([]*txnItem, 0, len(views))
+	for key, item := range views {
+		txn.reads[key] = struct{}{}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if opts.Reverse {
+			return bytes.Compare(items[i].key, items[j].key) > 0
+		}
+		return bytes.Compare(items[i].key, items[j].key) < 0
+	})
+	return &TxnIterator{txn: txn, items: items, options: opts}, nil
+}
+
+// Rewind 重新回到迭代器的起点，即第一个数据
+func (it *TxnIterator) Rewind() {
+	it.index = 0
+}
+
+// Seek 根据传入的key查找到第一个大于(或小于)等于的目标key，从这个key开始遍历
+func (it *TxnIterator) Seek(key []byte) {
+	it.index = sort.Search(len(it.items), func(i int) bool {
+		if it.options.Reverse {
+			return bytes.Compare(it.items[i].key, key) <= 0
+		}
+		return bytes.Compare(it.items[i].key, key) >= 0
+	})
+}
+
+// Next 跳转到下一个key
+func (it *TxnIterator) Next() {
+	it.index++
+}
+
+// Valid 是否有效，即是否已经遍历完了所有的key，用于退出遍历
+func (it *TxnIterator) Valid() bool {
+	return it.index < len(it.items)
+}
+
+// Key 当前遍历位置的key
+func (it *TxnIterator) Key() []byte {
+	return it.items[it.index].key
+}
+
+// Value 当前遍历位置的value
+func (it *TxnIterator) Value() ([]byte, error) {
+	item := it.items[it.index]
+	if item.pos == nil {
+		return item.value, nil
+	}
+	db := it.txn.db
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		return nil, ErrDatabaseClosed
+	}
+	return db.getValueByPosition(item.pos)
+}
+
+// Close 关闭迭代器，释放相应资源
+func (it *TxnIterator) Close() {
+	it.items = nil
+}
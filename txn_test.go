@@ -0,0 +1,288 @@
+package sirius
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTxn(t *testing.T) {
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, db *DB)
+	}{
+		{
+			name: "提交之后数据生效",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("b"), []byte("1")))
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				assert.Nil(t, txn.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, txn.Delete([]byte("b")))
+				// 事务自己的写入可见，其他人在提交之前看不到
+				value, err := txn.Get([]byte("a"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				_, err = txn.Get([]byte("b"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				_, err = db.Get([]byte("a"))
+				assert.Equal(t, ErrKeyNotFound, err)
+
+				assert.Nil(t, txn.Commit())
+				value, err = db.Get([]byte("a"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				_, err = db.Get([]byte("b"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				// 事务结束之后不能再使用
+				assert.Equal(t, ErrTxnClosed, txn.Put([]byte("a"), []byte("2")))
+				assert.Equal(t, ErrTxnClosed, txn.Commit())
+			},
+		},
+		{
+			name: "回滚之后数据不生效",
+			run: func(t *testing.T, db *DB) {
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				assert.Nil(t, txn.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, txn.Rollback())
+				assert.Nil(t, txn.Rollback())
+				_, err = db.Get([]byte("a"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				assert.Equal(t, 0, len(db.activeTxns))
+			},
+		},
+		{
+			name: "只读事务不能写入",
+			run: func(t *testing.T, db *DB) {
+				txn, err := db.Begin(true)
+				assert.Nil(t, err)
+				assert.Equal(t, ErrTxnReadOnly, txn.Put([]byte("a"), []byte("1")))
+				assert.Equal(t, ErrTxnReadOnly, txn.Delete([]byte("a")))
+				assert.Nil(t, txn.Commit())
+			},
+		},
+		{
+			name: "快照读",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, db.Put([]byte("b"), []byte("1")))
+				txn, err := db.Begin(true)
+				assert.Nil(t, err)
+				// 事务开始之后的修改、删除以及新增对事务都不可见
+				assert.Nil(t, db.Put([]byte("a"), []byte("2")))
+				assert.Nil(t, db.Put([]byte("a"), []byte("3")))
+				assert.Nil(t, db.Delete([]byte("b")))
+				assert.Nil(t, db.Put([]byte("c"), []byte("1")))
+
+				value, err := txn.Get([]byte("a"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				value, err = txn.Get([]byte("b"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				_, err = txn.Get([]byte("c"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				assert.Nil(t, txn.Commit())
+
+				// 没有活跃事务之后，旧版本会被清理
+				assert.Nil(t, db.keyVersions)
+			},
+		},
+		{
+			name: "写写冲突",
+			run: func(t *testing.T, db *DB) {
+				txn1, err := db.Begin(false)
+				assert.Nil(t, err)
+				txn2, err := db.Begin(false)
+				assert.Nil(t, err)
+				assert.Nil(t, txn1.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, txn2.Put([]byte("a"), []byte("2")))
+				assert.Nil(t, txn1.Commit())
+				assert.Equal(t, ErrTxnConflict, txn2.Commit())
+
+				value, err := db.Get([]byte("a"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+			},
+		},
+		{
+			name: "读写冲突",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("balance"), []byte("100")))
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				_, err = txn.Get([]byte("balance"))
+				assert.Nil(t, err)
+				// 读过的key在提交之前被其他写入修改了
+				assert.Nil(t, db.Put([]byte("balance"), []byte("50")))
+				assert.Nil(t, txn.Put([]byte("balance-copy"), []byte("100")))
+				assert.Equal(t, ErrTxnConflict, txn.Commit())
+				_, err = db.Get([]byte("balance-copy"))
+				assert.Equal(t, ErrKeyNotFound, err)
+			},
+		},
+		{
+			name: "不相交的事务都可以提交",
+			run: func(t *testing.T, db *DB) {
+				txn1, err := db.Begin(false)
+				assert.Nil(t, err)
+				txn2, err := db.Begin(false)
+				assert.Nil(t, err)
+				_, _ = txn1.Get([]byte("a"))
+				assert.Nil(t, txn1.Put([]byte("a"), []byte("1")))
+				_, _ = txn2.Get([]byte("b"))
+				assert.Nil(t, txn2.Put([]byte("b"), []byte("2")))
+				assert.Nil(t, txn1.Commit())
+				assert.Nil(t, txn2.Commit())
+			},
+		},
+		{
+			name: "事务迭代器",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+				assert.Nil(t, db.Put([]byte("b"), []byte("1")))
+				assert.Nil(t, db.Put([]byte("c"), []byte("1")))
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				assert.Nil(t, db.Delete([]byte("a")))
+				assert.Nil(t, db.Put([]byte("d"), []byte("1")))
+				assert.Nil(t, txn.Put([]byte("b"), []byte("2")))
+				assert.Nil(t, txn.Delete([]byte("c")))
+				assert.Nil(t, txn.Put([]byte("e"), []byte("2")))
+
+				iter, err := txn.Iterator(IteratorOptions{Reverse: true})
+				assert.Nil(t, err)
+				defer iter.Close()
+				var keys, values []string
+				for iter.Rewind(); iter.Valid(); iter.Next() {
+					value, err := iter.Value()
+					assert.Nil(t, err)
+					keys = append(keys, string(iter.Key()))
+					values = append(values, string(value))
+				}
+				assert.Equal(t, []string{"e", "b", "a"}, keys)
+				assert.Equal(t, []string{"2", "2", "1"}, values)
+
+				iter.Seek([]byte("c"))
+				assert.True(t, iter.Valid())
+				assert.Equal(t, []byte("b"), iter.Key())
+				// 遍历过的key被其他写入删除了
+				assert.Equal(t, ErrTxnConflict, txn.Commit())
+			},
+		},
+		{
+			name: "事务中的过期时间",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.PutWithTTL([]byte("a"), []byte("1"), time.Hour))
+				assert.Nil(t, db.Put([]byte("b"), []byte("1")))
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				ttl, err := txn.TTL([]byte("a"))
+				assert.Nil(t, err)
+				assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+				ttl, err = txn.TTL([]byte("b"))
+				assert.Nil(t, err)
+				assert.Equal(t, time.Duration(0), ttl)
+				_, err = txn.TTL([]byte("c"))
+				assert.Equal(t, ErrKeyNotFound, err)
+
+				assert.Equal(t, ErrInvalidTTL, txn.PutWithTTL([]byte("c"), []byte("1"), 0))
+				assert.Nil(t, txn.PutWithTTL([]byte("c"), []byte("1"), time.Minute))
+				// 事务自己写入的过期时间
+				ttl, err = txn.TTL([]byte("c"))
+				assert.Nil(t, err)
+				assert.True(t, ttl > 59*time.Second && ttl <= time.Minute)
+
+				// 同时读取value和过期时间
+				value, ttl, err := txn.GetWithTTL([]byte("a"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+				value, ttl, err = txn.GetWithTTL([]byte("c"))
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("1"), value)
+				assert.True(t, ttl > 59*time.Second && ttl <= time.Minute)
+				_, _, err = txn.GetWithTTL([]byte("d"))
+				assert.Equal(t, ErrKeyNotFound, err)
+				assert.Nil(t, txn.Commit())
+
+				ttl, err = db.TTL([]byte("c"))
+				assert.Nil(t, err)
+				assert.True(t, ttl > 59*time.Second && ttl <= time.Minute)
+			},
+		},
+		{
+			name: "遍历范围内新增key冲突",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("order:1"), []byte("1")))
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				iter, err := txn.Iterator(IteratorOptions{Prefix: []byte("order:")})
+				assert.Nil(t, err)
+				iter.Close()
+				assert.Nil(t, txn.Put([]byte("order-count"), []byte("1")))
+				// 遍历范围内新增了key，事务看到的数量已经不对了
+				assert.Nil(t, db.Put([]byte("order:2"), []byte("1")))
+				assert.Equal(t, ErrTxnConflict, txn.Commit())
+			},
+		},
+		{
+			name: "遍历范围之外的写入不冲突",
+			run: func(t *testing.T, db *DB) {
+				assert.Nil(t, db.Put([]byte("order:1"), []byte("1")))
+				txn, err := db.Begin(false)
+				assert.Nil(t, err)
+				iter, err := txn.Iterator(IteratorOptions{Prefix: []byte("order:")})
+				assert.Nil(t, err)
+				iter.Close()
+				assert.Nil(t, txn.Put([]byte("order-count"), []byte("1")))
+				assert.Nil(t, db.Put([]byte("user:1"), []byte("1")))
+				assert.Nil(t, txn.Commit())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.DirPath = filepath.Join(os.TempDir(), "sirius-txn")
+			defer os.RemoveAll(opts.DirPath)
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer db.Close()
+			tc.run(t, db)
+		})
+	}
+}
+
+func TestTxn_Restart(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-txn-restart")
+	defer os.RemoveAll(opts.DirPath)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	txn, err := db.Begin(false)
+	assert.Nil(t, err)
+	assert.Nil(t, txn.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, txn.Commit())
+	// 没有提交的事务不会写入磁盘
+	txn, err = db.Begin(false)
+	assert.Nil(t, err)
+	assert.Nil(t, txn.Put([]byte("b"), []byte("1")))
+	assert.Nil(t, db.Close())
+	_, err = db.Begin(false)
+	assert.Equal(t, ErrDatabaseClosed, err)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	value, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+	_, err = db.Get([]byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Close())
+}
@@ -0,0 +1,88 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"Sirius/fio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UpgradedFile 升级了格式的数据文件
+type UpgradedFile struct {
+	Fid         uint32
+	FromVersion uint16
+}
+
+// Upgrade 将数据目录中旧版本格式的数据文件重写为当前的格式，返回升级了的数据文件
+// 数据库不能处于打开状态，升级之前会先完成已经结束但是还没有替换的merge
+// 升级只修改文件格式，不会加密或者压缩已经写入的数据，这些需要在打开数据库之后merge
+func Upgrade(options Options) ([]UpgradedFile, error) {
+	if options.DirPath == "" {
+		return nil, ErrDirPathIsEmpty
+	}
+	if _, err := os.Stat(options.DirPath); err != nil {
+		return nil, err
+	}
+
+	fileLock, err := fio.TryLockFile(filepath.Join(options.DirPath, fileLockName))
+	if err != nil {
+		if err == fio.ErrFileLocked {
+			return nil, ErrDatabaseIsUsing
+		}
+		return nil, err
+	}
+	defer fileLock.Unlock()
+
+	// merge生成的数据文件也可能是旧的格式，先替换到数据目录中
+	db := newDB(options, fileLock)
+	if err := db.loadMergeFiles(); err != nil {
+		return nil, err
+	}
+
+	dirEntries, err := os.ReadDir(options.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	var fileIds []int
+	for _, entry := range dirEntries {
+		name := entry.Name()
+		// 上一次升级时崩溃留下的临时文件
+		if strings.HasSuffix(name, data.DataFileNameSuffix+data.UpgradeTmpFileSuffix) {
+			if err := os.Remove(filepath.Join(options.DirPath, name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if strings.HasSuffix(name, data.DataFileNameSuffix) {
+			fileId, err := strconv.Atoi(strings.TrimSuffix(name, data.DataFileNameSuffix))
+			if err != nil {
+				return nil, ErrDataDirectoryCorrupted
+			}
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	sort.Ints(fileIds)
+
+	var upgraded []UpgradedFile
+	for _, fid := range fileIds {
+		version, err := data.UpgradeDataFile(data.GetDataFileName(options.DirPath, uint32(fid)))
+		if err != nil {
+			return upgraded, err
+		}
+		if version < data.FormatVersion {
+			upgraded = append(upgraded, UpgradedFile{Fid: uint32(fid), FromVersion: version})
+		}
+	}
+
+	// 索引快照中记录的是升级之前的文件长度，删除之后下一次Open时从数据文件中重建索引
+	if len(upgraded) > 0 {
+		hintFileName := filepath.Join(options.DirPath, data.HintFileName)
+		if err := os.Remove(hintFileName); err != nil && !os.IsNotExist(err) {
+			return upgraded, err
+		}
+	}
+	return upgraded, nil
+}
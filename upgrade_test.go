@@ -0,0 +1,140 @@
+package sirius
+
+import (
+	"Sirius/data"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stripFileHeaders 去掉数据目录中所有文件的文件头，模拟旧版本写入的数据目录
+func stripFileHeaders(t *testing.T, dirPath string) {
+	entries, err := os.ReadDir(dirPath)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) && entry.Name() != data.HintFileName {
+			continue
+		}
+		fileName := filepath.Join(dirPath, entry.Name())
+		content, err := os.ReadFile(fileName)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(fileName, content[data.FileHeaderSize:], 0644))
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "sirius-upgrade")
+	opts.DataFileSize = 4 * 1024
+	defer os.RemoveAll(opts.DirPath)
+
+	// 旧版本只支持IEEE校验
+	opts.Checksum = ChecksumIEEE
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Close())
+	stripFileHeaders(t, opts.DirPath)
+	opts.Checksum = ChecksumCRC32C
+
+	// 旧版本的数据文件仍然可以读取，新写入的数据写入当前版本的活跃文件
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	legacyFileNum := len(db.olderFiles)
+	assert.Equal(t, data.FormatVersion, db.activeFile.Header().Version)
+	assert.Equal(t, ChecksumCRC32C, db.activeFile.Header().Checksum)
+	assert.Nil(t, db.Put([]byte("key_300"), []byte("value_300")))
+	_, err = Upgrade(opts)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+	assert.Nil(t, db.Close())
+
+	upgraded, err := Upgrade(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, legacyFileNum, len(upgraded))
+	for i, file := range upgraded {
+		assert.Equal(t, UpgradedFile{Fid: uint32(i), FromVersion: 0}, file)
+	}
+	_, err = os.Stat(filepath.Join(opts.DirPath, data.HintFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for _, dataFile := range db.olderFiles {
+		assert.Equal(t, data.FormatVersion, dataFile.Header().Version)
+		// 升级之后旧的记录仍然使用IEEE校验
+		if dataFile.FileId < uint32(legacyFileNum) {
+			assert.Equal(t, ChecksumIEEE, dataFile.Header().Checksum)
+		}
+	}
+	for i := 0; i <= 300; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+	}
+	assert.Nil(t, db.Close())
+
+	// 已经是当前版本时不需要升级
+	upgraded, err = Upgrade(opts)
+	assert.Nil(t, err)
+	assert.Empty(t, upgraded)
+}
+
+func TestUpgrade_BaselineFormat(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = t.TempDir()
+
+	// 最初版本写入的数据文件，key中可能包含任意字节，包括看起来像是变长编码序列号的前缀
+	records := []struct {
+		typ   data.LogRecordType
+		key   string
+		value string
+	}{
+		{data.LogRecordNormal, "name", "zhangsan"},
+		{data.LogRecordNormal, "\x02txn-key", "raw"},
+		{data.LogRecordNormal, "age", "18"},
+		{data.LogRecordDeleted, "age", ""},
+		{data.LogRecordNormal, "name", "lisi"},
+		{data.LogRecordNormal, "txn-fin", "not a finish record"},
+	}
+	var content []byte
+	for _, r := range records {
+		content = append(content, encodeBaselineRecord([]byte(r.key), []byte(r.value), r.typ)...)
+	}
+	assert.Nil(t, os.WriteFile(data.GetDataFileName(opts.DirPath, 0), content, 0644))
+
+	upgraded, err := Upgrade(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []UpgradedFile{{Fid: 0, FromVersion: 0}}, upgraded)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	testCases := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "覆盖写之后读取最新的值", key: "name", want: "lisi"},
+		{name: "以变长编码字节开头的key", key: "\x02txn-key", want: "raw"},
+		{name: "删除的key", key: "age", wantErr: ErrKeyNotFound},
+		{name: "和事务完成标记同名的key", key: "txn-fin", want: "not a finish record"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := db.Get([]byte(tc.key))
+			assert.Equal(t, tc.wantErr, err)
+			if tc.wantErr == nil {
+				assert.Equal(t, []byte(tc.want), value)
+			}
+		})
+	}
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(keys))
+	assert.Nil(t, db.Close())
+}